@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"log"
+	"time"
+)
+
+// checkBackoff tracks a backend's consecutive failed health checks and when
+// it is next due to be checked
+type checkBackoff struct {
+	failures int
+	delay    time.Duration
+	next     time.Time
+}
+
+// due reports whether a backend should be probed in the check round started
+// at now. Backends that keep failing are skipped until their backoff expires.
+func (hc *DefaultHealthChecker) due(b *Backend, now time.Time) bool {
+	if hc.options.MaxBackoff <= 0 {
+		return true
+	}
+
+	hc.backoffMu.Lock()
+	defer hc.backoffMu.Unlock()
+
+	backoff, ok := hc.backoffs[b.Key()]
+	if !ok {
+		return true
+	}
+
+	// Rounds don't start exactly one interval apart; allow for the drift
+	interval, _ := hc.Timing()
+	return !now.Before(backoff.next.Add(-interval / 2))
+}
+
+// recordCheck updates a backend's backoff after a check from the round
+// started at now. Each further consecutive failure doubles the wait before
+// the next check, up to MaxBackoff; a passing check resets it.
+func (hc *DefaultHealthChecker) recordCheck(b *Backend, healthy bool, now time.Time) {
+	if hc.options.MaxBackoff <= 0 {
+		return
+	}
+
+	hc.backoffMu.Lock()
+	defer hc.backoffMu.Unlock()
+
+	key := b.Key()
+	if healthy {
+		delete(hc.backoffs, key)
+		return
+	}
+
+	backoff, ok := hc.backoffs[key]
+	if !ok {
+		backoff = &checkBackoff{}
+		hc.backoffs[key] = backoff
+	}
+	backoff.failures++
+
+	interval, _ := hc.Timing()
+	delay := interval
+	for i := 1; i < backoff.failures && delay < hc.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, hc.options.MaxBackoff)
+	backoff.next = now.Add(delay)
+
+	// Log only when the wait grows, not for every check at the maximum
+	if delay > interval && delay != backoff.delay {
+		backoff.delay = delay
+		log.Printf("Backend %s failed %d consecutive health checks, next check in %v",
+			b.URL.String(), backoff.failures, delay)
+	}
+}
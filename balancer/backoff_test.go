@@ -0,0 +1,33 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthCheckBackoff(t *testing.T) {
+	interval := 10 * time.Second
+	hc := NewHealthChecker(NewRoundRobinBalancer(), interval, time.Second, HealthCheckOptions{MaxBackoff: 80 * time.Second})
+	backend := newTestBackends(1)[0]
+
+	// Each failure doubles the wait before the next check, up to MaxBackoff
+	now := time.Now()
+	for _, wait := range []time.Duration{10, 20, 40, 80, 80} {
+		wait *= time.Second
+		hc.recordCheck(backend, false, now)
+		if hc.due(backend, now.Add(wait-interval)) {
+			t.Fatalf("backend due %v after a failed check, want %v", wait-interval, wait)
+		}
+		if !hc.due(backend, now.Add(wait)) {
+			t.Fatalf("backend not due %v after a failed check", wait)
+		}
+		now = now.Add(wait)
+	}
+
+	// A passing check resets it
+	hc.recordCheck(backend, true, now)
+	hc.recordCheck(backend, false, now)
+	if !hc.due(backend, now.Add(interval)) {
+		t.Errorf("backend not due one interval after a failure following a pass")
+	}
+}
@@ -0,0 +1,65 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkSelectBackend compares the cost of SelectBackend across algorithms
+// and pool sizes, e.g. for one algorithm:
+//
+//	go test ./balancer -run '^$' -bench 'SelectBackend/least-connections'
+func BenchmarkSelectBackend(b *testing.B) {
+	algorithms := []struct {
+		name string
+		new  func() LoadBalancer
+	}{
+		{"round-robin", func() LoadBalancer { return NewRoundRobinBalancer() }},
+		{"weighted-round-robin", func() LoadBalancer { return NewWeightedRoundRobinBalancer(0) }},
+		{"least-connections", func() LoadBalancer { return NewLeastConnectionsBalancer(TieBreakFirst) }},
+		{"ip-hash", func() LoadBalancer { return NewIPHashBalancer(IPHashFallbackRoundRobin, IPHashRetryNext) }},
+		{"p2c", func() LoadBalancer { return NewP2CBalancer() }},
+		{"least-response-time", func() LoadBalancer { return NewLeastResponseTimeBalancer() }},
+		{"weighted-random", func() LoadBalancer { return NewWeightedRandomBalancer(0) }},
+	}
+
+	for _, algorithm := range algorithms {
+		for _, size := range []int{3, 10, 100, 1000} {
+			b.Run(fmt.Sprintf("%s/%d", algorithm.name, size), func(b *testing.B) {
+				benchmarkSelection(b, algorithm.new(), size)
+			})
+		}
+	}
+}
+
+// benchmarkSelection measures SelectBackend on a pool of the given size, with
+// requests from a rotating set of client addresses
+func benchmarkSelection(b *testing.B, lb LoadBalancer, size int) {
+	for i := 0; i < size; i++ {
+		backendURL, _ := url.Parse(fmt.Sprintf("http://10.0.%d.%d:8080", i/256, i%256))
+		lb.AddBackend(&Backend{URL: backendURL, Alive: true, Ready: true, Weight: 1 + i%5})
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	clientAddrs := make([]string, 256)
+	for i := range clientAddrs {
+		clientAddrs[i] = "192.168." + strconv.Itoa(i) + ".1:40000"
+	}
+	tracker, tracksConnections := lb.(ConnectionTracker)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		request.RemoteAddr = clientAddrs[i%len(clientAddrs)]
+		backend := lb.SelectBackend(request)
+
+		// Keep connection counts steady for counting algorithms
+		if backend != nil && tracksConnections {
+			tracker.DecrementConnections(backend)
+		}
+	}
+}
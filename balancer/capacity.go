@@ -0,0 +1,24 @@
+package balancer
+
+import "sync/atomic"
+
+// AtCapacity reports whether a backend has as many connections as its
+// MaxConnections cap allows
+func (b *Backend) AtCapacity() bool {
+	return b.MaxConnections > 0 && atomic.LoadInt32(&b.Connections) >= b.MaxConnections
+}
+
+// ReserveConnection counts a connection to the backend unless that would
+// exceed its MaxConnections cap. Checking the cap and counting in one step
+// keeps concurrent requests from pushing the backend past it.
+func (b *Backend) ReserveConnection() bool {
+	for {
+		connections := atomic.LoadInt32(&b.Connections)
+		if b.MaxConnections > 0 && connections >= b.MaxConnections {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&b.Connections, connections, connections+1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSelectionRespectsCap(t *testing.T) {
+	algorithms := []struct {
+		name string
+		new  func() LoadBalancer
+	}{
+		{"round-robin", func() LoadBalancer { return NewRoundRobinBalancer() }},
+		{"weighted-round-robin", func() LoadBalancer { return NewWeightedRoundRobinBalancer(0) }},
+		{"least-connections", func() LoadBalancer { return NewLeastConnectionsBalancer(TieBreakFirst) }},
+		{"ip-hash", func() LoadBalancer { return NewIPHashBalancer(IPHashFallbackRoundRobin, IPHashRetryNext) }},
+		{"p2c", func() LoadBalancer { return NewP2CBalancer() }},
+		{"least-response-time", func() LoadBalancer { return NewLeastResponseTimeBalancer() }},
+		{"weighted-random", func() LoadBalancer { return NewWeightedRandomBalancer(0) }},
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.name, func(t *testing.T) {
+			lb := algorithm.new()
+			backends := newTestBackends(4)
+			for _, backend := range backends {
+				backend.MaxConnections = 5
+			}
+			addBackends(lb, backends)
+
+			// No connection is released, so once 20 are claimed every
+			// further request must find all backends at their cap
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			selected := 0
+			for i := range 64 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					request, _ := http.NewRequest("GET", "/", nil)
+					request.RemoteAddr = fmt.Sprintf("192.168.0.%d:40000", i)
+					if lb.SelectBackend(request) != nil {
+						mu.Lock()
+						selected++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if selected != 20 {
+				t.Errorf("got %d selections, want 20", selected)
+			}
+			for _, backend := range backends {
+				if backend.Connections > backend.MaxConnections {
+					t.Errorf("backend %s has %d connections, over its cap of %d",
+						backend.URL, backend.Connections, backend.MaxConnections)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Diagnosis is the result of a connectivity self-check of a backend
+type Diagnosis struct {
+	// DialError is set when the backend host could not be reached over TCP
+	DialError error
+
+	// HealthError is set when the host is reachable but the health check fails
+	HealthError error
+
+	// HealthStatus is the status code returned by the health endpoint, if any
+	HealthStatus int
+}
+
+// Healthy reports whether the backend is reachable and passes its health check
+func (d Diagnosis) Healthy() bool {
+	return d.DialError == nil && d.HealthError == nil
+}
+
+// String describes the diagnosis, distinguishing an unreachable host from a
+// reachable host with a missing or failing health endpoint
+func (d Diagnosis) String() string {
+	switch {
+	case d.DialError != nil:
+		return fmt.Sprintf("host unreachable (check host and port): %v", d.DialError)
+	case d.HealthStatus != 0 && d.HealthError != nil:
+		return fmt.Sprintf("host reachable, but health endpoint is misconfigured or failing (check health path): %v", d.HealthError)
+	case d.HealthError != nil:
+		return fmt.Sprintf("host reachable, but health check failed: %v", d.HealthError)
+	default:
+		return "host reachable, health check passed"
+	}
+}
+
+// Diagnose checks TCP reachability of a backend, or of the proxy used to
+// reach it, separately from its health endpoint. It does not update the
+// backend's status or counters.
+func (hc *DefaultHealthChecker) Diagnose(backend *Backend) Diagnosis {
+	_, timeout := hc.Timing()
+
+	address := DialAddr(backend.URL)
+	if hc.options.Proxy != nil {
+		if proxyURL, err := hc.options.Proxy(&http.Request{URL: backend.URL}); err == nil && proxyURL != nil {
+			address = DialAddr(proxyURL)
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return Diagnosis{DialError: err}
+	}
+	conn.Close()
+
+	var diagnosis Diagnosis
+	if err := hc.probe(backend); err != nil {
+		diagnosis.HealthError = err
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			diagnosis.HealthStatus = statusErr.code
+		}
+	}
+	return diagnosis
+}
+
+// BackendDiagnosis is the diagnosis of one backend
+type BackendDiagnosis struct {
+	Backend *Backend
+	Diagnosis
+}
+
+// DiagnoseAll runs Diagnose concurrently on every backend of the primary
+// balancer and of the pools, in that order
+func (hc *DefaultHealthChecker) DiagnoseAll() []BackendDiagnosis {
+	backends := hc.balancer.GetBackends()
+	for _, pool := range hc.pools {
+		backends = append(backends, pool.GetBackends()...)
+	}
+	diagnoses := make([]BackendDiagnosis, len(backends))
+
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, b *Backend) {
+			defer wg.Done()
+			diagnoses[i] = BackendDiagnosis{Backend: b, Diagnosis: hc.Diagnose(b)}
+		}(i, backend)
+	}
+	wg.Wait()
+
+	return diagnoses
+}
@@ -0,0 +1,40 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+)
+
+// excludedKey is the context key under which excluded backends are stored
+type excludedKey struct{}
+
+// WithExcludedBackends returns a shallow copy of r whose context tells
+// SelectBackend to skip the given backends, e.g. ones that already failed
+// the request. Balancers return nil if no other alive backend remains.
+func WithExcludedBackends(r *http.Request, backends []*Backend) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), excludedKey{}, backends))
+}
+
+// excludedBackends returns the backends excluded for a request
+func excludedBackends(r *http.Request) []*Backend {
+	if r == nil {
+		return nil
+	}
+	excluded, _ := r.Context().Value(excludedKey{}).([]*Backend)
+	return excluded
+}
+
+// isSelectable reports whether a backend may serve a request: it must be
+// alive, ready, not draining, below its connection cap and not among the
+// request's excluded backends
+func isSelectable(backend *Backend, excluded []*Backend) bool {
+	if !backend.Alive || !backend.Ready || backend.Draining || backend.AtCapacity() {
+		return false
+	}
+	for _, b := range excluded {
+		if b == backend {
+			return false
+		}
+	}
+	return true
+}
@@ -1,65 +1,349 @@
 package balancer
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// maxHealthBodySize bounds how much of a health response body is read
+const maxHealthBodySize = 64 * 1024
+
+// DefaultHealthPath is the path probed on each backend when none is configured
+const DefaultHealthPath = "/health"
+
+// DefaultHealthConcurrency is how many backends are probed at once when not configured
+const DefaultHealthConcurrency = 10
+
+// HealthCheckOptions holds optional health check settings
+type HealthCheckOptions struct {
+	// Path is the path probed on each backend (default DefaultHealthPath)
+	Path string
+
+	// ReadyPath, when set, is probed on backends that pass the health check to
+	// decide whether they are ready for requests. Backends that are live but
+	// not ready are kept out of rotation without counting as failing.
+	ReadyPath string
+
+	// TCP probes backends by opening a TCP connection instead of sending an HTTP request
+	TCP bool
+
+	// Method is the HTTP method of health probes (default GET)
+	Method string
+
+	// Concurrency is how many backends are probed at once (default DefaultHealthConcurrency)
+	Concurrency int
+
+	// ExpectStatus is the set of status codes that count as healthy (default any 2xx)
+	ExpectStatus StatusSet
+
+	// JSONExpect, when set, requires a field of the JSON health response to match
+	JSONExpect *JSONExpectation
+
+	// BodyContains, when set, requires the health response body to contain this text
+	BodyContains string
+
+	// TLSConfig configures HTTPS health probes, normally the same as for proxied requests (nil uses the defaults)
+	TLSConfig *tls.Config
+
+	// InsecureSkipVerify disables TLS certificate verification for health probes only
+	InsecureSkipVerify bool
+
+	// Proxy selects an HTTP proxy for health probes, like http.Transport.Proxy (nil connects directly)
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// MinHealthy keeps failing backends in rotation rather than dropping the pool below this threshold
+	MinHealthy MinHealthy
+
+	// Passive marks backends down based on failures of live requests reported through ReportResult
+	Passive PassiveCheck
+
+	// Outlier ejects backends for a while when their recent error rate is too high
+	Outlier OutlierDetection
+
+	// MaxBackoff, when set, checks backends that keep failing exponentially less
+	// often, starting at the check interval and doubling up to this interval
+	MaxBackoff time.Duration
+}
+
+// HealthOverride replaces some of the checker's settings for one backend,
+// e.g. for a service whose health endpoint is not at the common path. Zero
+// fields use the checker's settings.
+type HealthOverride struct {
+	// Path is the path probed on the backend
+	Path string
+
+	// Timeout bounds each probe of the backend
+	Timeout time.Duration
+
+	// ExpectStatus is the set of status codes that count as healthy
+	ExpectStatus StatusSet
+}
+
 // DefaultHealthChecker implements health checking functionality
 type DefaultHealthChecker struct {
-	balancer LoadBalancer
-	interval time.Duration
-	timeout  time.Duration
-	ctx      context.Context
-	cancel   context.CancelFunc
-	running  int32
+	balancer       LoadBalancer
+	pools          []LoadBalancer
+	interval       time.Duration
+	timeout        time.Duration
+	timingMu       sync.RWMutex
+	timingChanged  chan struct{}
+	options        HealthCheckOptions
+	client         *http.Client
+	statusMu       sync.Mutex
+	passiveMu      sync.Mutex
+	failureRuns    map[string]*failureRun
+	backoffMu      sync.Mutex
+	backoffs       map[string]*checkBackoff
+	outlierMu      sync.Mutex
+	outcomes       map[string]*outcomeCount
+	outlierSamples map[string][]countSample
+	ejections      map[string]*ejection
+	ctx            context.Context
+	cancel         context.CancelFunc
+	running        int32
 }
 
 // NewHealthChecker creates a new health checker
-func NewHealthChecker(balancer LoadBalancer, interval, timeout time.Duration) *DefaultHealthChecker {
+func NewHealthChecker(balancer LoadBalancer, interval, timeout time.Duration, options HealthCheckOptions) *DefaultHealthChecker {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &DefaultHealthChecker{
-		balancer: balancer,
-		interval: interval,
-		timeout:  timeout,
-		ctx:      ctx,
-		cancel:   cancel,
+
+	if options.Path == "" {
+		options.Path = DefaultHealthPath
+	}
+	if options.Method == "" {
+		options.Method = http.MethodGet
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultHealthConcurrency
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = options.Proxy
+	transport.TLSClientConfig = options.TLSConfig.Clone()
+	if options.InsecureSkipVerify {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		log.Println("WARNING: TLS certificate verification is disabled for health checks")
+	}
+
+	hc := &DefaultHealthChecker{
+		balancer:       balancer,
+		interval:       interval,
+		timeout:        timeout,
+		timingChanged:  make(chan struct{}, 1),
+		options:        options,
+		client:         &http.Client{Transport: transport},
+		failureRuns:    make(map[string]*failureRun),
+		backoffs:       make(map[string]*checkBackoff),
+		outcomes:       make(map[string]*outcomeCount),
+		outlierSamples: make(map[string][]countSample),
+		ejections:      make(map[string]*ejection),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	balancer.OnRemove(hc.forget)
+	return hc
+}
+
+// Timing returns the current check interval and timeout
+func (hc *DefaultHealthChecker) Timing() (interval, timeout time.Duration) {
+	hc.timingMu.RLock()
+	defer hc.timingMu.RUnlock()
+	return hc.interval, hc.timeout
+}
+
+// UpdateTiming changes the check interval and timeout of a running checker.
+// The ticker is restarted with the new interval; checks already in flight keep their old timeout.
+func (hc *DefaultHealthChecker) UpdateTiming(interval, timeout time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("health check interval must be positive")
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("health check timeout must be positive")
 	}
+
+	hc.timingMu.Lock()
+	hc.interval = interval
+	hc.timeout = timeout
+	hc.timingMu.Unlock()
+
+	// Wake the check loop without blocking if a change is already pending
+	select {
+	case hc.timingChanged <- struct{}{}:
+	default:
+	}
+
+	log.Printf("Health check timing updated: interval %v, timeout %v", interval, timeout)
+	return nil
 }
 
 // CheckHealth performs a health check on a specific backend
 func (hc *DefaultHealthChecker) CheckHealth(backend *Backend) bool {
-	ctx, cancel := context.WithTimeout(hc.ctx, hc.timeout)
-	defer cancel()
+	start := time.Now()
+	err := hc.probe(backend)
+	checkedAt := time.Now()
+	atomic.StoreInt64(&backend.LastCheckedAt, checkedAt.UnixNano())
+	atomic.StoreInt64((*int64)(&backend.LastLatency), int64(checkedAt.Sub(start)))
 
-	healthURL := backend.URL.String() + "/health"
-	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
-		log.Printf("Health check error creating request for %s: %v", backend.URL.String(), err)
+		atomic.AddInt32(&backend.HealthFailCount, 1)
+		log.Printf("Health check failed for %s: %v", backend.URL.String(), err)
 		return false
 	}
 
-	client := &http.Client{Timeout: hc.timeout}
-	resp, err := client.Do(req)
+	atomic.AddInt32(&backend.HealthSuccessCount, 1)
+	log.Printf("Health check passed for %s", backend.URL.String())
+	if hc.options.ReadyPath != "" {
+		hc.checkReady(backend)
+	}
+	return true
+}
+
+// checkReady probes a live backend's readiness endpoint and updates whether
+// it is ready. Only the status code is checked against the expected ones.
+func (hc *DefaultHealthChecker) checkReady(backend *Backend) {
+	err := hc.request(backend, hc.options.ReadyPath, false)
+	ready := err == nil
+
+	lb := hc.balancerOf(backend)
+	previous := backend.Ready
+	lb.UpdateBackendReady(backend, ready)
+	switch {
+	case previous && !ready:
+		log.Printf("Backend %s is not ready: %v", backend.URL.String(), err)
+	case !previous && ready:
+		log.Printf("Backend %s is ready", backend.URL.String())
+	}
+}
+
+// statusError reports a health response with an unexpected status code
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d %s", e.code, http.StatusText(e.code))
+}
+
+// probe sends a health request to a backend and validates the response,
+// using the backend's own settings where it has them
+func (hc *DefaultHealthChecker) probe(backend *Backend) error {
+	path := hc.options.Path
+	if override := backend.HealthSettings(); override.Path != "" {
+		path = override.Path
+	}
+	return hc.request(backend, path, true)
+}
+
+// request sends a probe for path to a backend and checks its status code,
+// and its body if checkBody is set
+func (hc *DefaultHealthChecker) request(backend *Backend, path string, checkBody bool) error {
+	override := backend.HealthSettings()
+	_, timeout := hc.Timing()
+	if override.Timeout > 0 {
+		timeout = override.Timeout
+	}
+	expectStatus := hc.options.ExpectStatus
+	if len(override.ExpectStatus) > 0 {
+		expectStatus = override.ExpectStatus
+	}
+
+	ctx, cancel := context.WithTimeout(hc.ctx, timeout)
+	defer cancel()
+
+	if hc.options.TCP {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", DialAddr(backend.URL))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	// The path is appended to any base path of the backend URL
+	healthURL := strings.TrimSuffix(backend.URL.String(), "/") + path
+	req, err := http.NewRequestWithContext(ctx, hc.options.Method, healthURL, nil)
 	if err != nil {
-		log.Printf("Health check failed for %s: %v", backend.URL.String(), err)
-		atomic.AddInt32(&backend.ErrorCount, 1)
-		return false
+		return err
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		atomic.AddInt32(&backend.SuccessCount, 1)
-		log.Printf("Health check passed for %s", backend.URL.String())
-		return true
+	if !expectStatus.Contains(resp.StatusCode) {
+		return &statusError{code: resp.StatusCode}
 	}
 
-	atomic.AddInt32(&backend.ErrorCount, 1)
-	log.Printf("Health check failed for %s with status: %d", backend.URL.String(), resp.StatusCode)
-	return false
+	if !checkBody || (hc.options.JSONExpect == nil && hc.options.BodyContains == "") {
+		return nil
+	}
+
+	// Degraded backends may still answer 2xx; the body has the final say
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodySize))
+	if err != nil {
+		return err
+	}
+	if hc.options.BodyContains != "" && !bytes.Contains(body, []byte(hc.options.BodyContains)) {
+		return fmt.Errorf("response body does not contain %q", hc.options.BodyContains)
+	}
+	if hc.options.JSONExpect != nil {
+		return hc.options.JSONExpect.Match(body)
+	}
+	return nil
+}
+
+// AddPool adds another balancer whose backends are checked along with the
+// primary balancer's. It must be called before StartHealthCheck.
+func (hc *DefaultHealthChecker) AddPool(lb LoadBalancer) {
+	hc.pools = append(hc.pools, lb)
+	lb.OnRemove(hc.forget)
+}
+
+// forget drops the failure counts, backoff and outlier state kept for a
+// backend that was removed, so a backend added later under the same key
+// starts clean
+func (hc *DefaultHealthChecker) forget(b *Backend) {
+	key := b.Key()
+
+	hc.passiveMu.Lock()
+	delete(hc.failureRuns, key)
+	hc.passiveMu.Unlock()
+
+	hc.backoffMu.Lock()
+	delete(hc.backoffs, key)
+	hc.backoffMu.Unlock()
+
+	hc.outlierMu.Lock()
+	delete(hc.outcomes, key)
+	delete(hc.outlierSamples, key)
+	delete(hc.ejections, key)
+	hc.outlierMu.Unlock()
+}
+
+// balancerOf returns the balancer a backend belongs to
+func (hc *DefaultHealthChecker) balancerOf(b *Backend) LoadBalancer {
+	for _, lb := range hc.pools {
+		if lb.GetBackend(b.Key()) == b {
+			return lb
+		}
+	}
+	return hc.balancer
 }
 
 // StartHealthCheck starts periodic health checks
@@ -68,12 +352,17 @@ func (hc *DefaultHealthChecker) StartHealthCheck() {
 		return // Already running
 	}
 
-	log.Printf("Starting health checker with interval: %v", hc.interval)
+	interval, _ := hc.Timing()
+	log.Printf("Starting health checker with interval: %v", interval)
+
+	if hc.options.Outlier.ErrorRate > 0 {
+		go hc.detectOutliers()
+	}
 
 	go func() {
 		defer atomic.StoreInt32(&hc.running, 0)
 
-		ticker := time.NewTicker(hc.interval)
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for {
@@ -81,6 +370,9 @@ func (hc *DefaultHealthChecker) StartHealthCheck() {
 			case <-hc.ctx.Done():
 				log.Println("Health checker stopped")
 				return
+			case <-hc.timingChanged:
+				interval, _ := hc.Timing()
+				ticker.Reset(interval)
 			case <-ticker.C:
 				hc.performHealthChecks()
 			}
@@ -98,23 +390,86 @@ func (hc *DefaultHealthChecker) StopHealthCheck() {
 	hc.cancel()
 }
 
-// performHealthChecks checks all backends
+// performHealthChecks checks all backends of every pool, except those
+// backing off after repeated failures. At most Concurrency backends are
+// probed at once, sharing the checker's HTTP client; the round returns once
+// every backend has been checked, so slow rounds never overlap.
 func (hc *DefaultHealthChecker) performHealthChecks() {
-	backends := hc.balancer.GetBackends()
+	backends := hc.allBackends()
+
+	now := time.Now()
+	due := make(chan *Backend)
+	var wg sync.WaitGroup
+	for range min(hc.options.Concurrency, len(backends)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range due {
+				alive := hc.CheckHealth(b)
+				hc.recordCheck(b, alive, now)
+				hc.applyStatus(b, alive)
+			}
+		}()
+	}
 
 	for _, backend := range backends {
-		go func(b *Backend) {
-			alive := hc.CheckHealth(b)
-			previousState := b.Alive
-			hc.balancer.UpdateBackendStatus(b, alive)
-
-			if previousState != alive {
-				status := "DOWN"
-				if alive {
-					status = "UP"
-				}
-				log.Printf("Backend %s status changed to %s", b.URL.String(), status)
+		if hc.due(backend, now) {
+			due <- backend
+		}
+	}
+	close(due)
+	wg.Wait()
+}
+
+// allBackends returns the backends of every pool
+func (hc *DefaultHealthChecker) allBackends() []*Backend {
+	backends := hc.balancer.GetBackends()
+	for _, lb := range hc.pools {
+		backends = append(backends, lb.GetBackends()...)
+	}
+	return backends
+}
+
+// applyStatus updates a backend's status, refusing to mark it down if that
+// would leave fewer backends in its pool in rotation than the configured
+// minimum. Backends ejected as outliers keep their status until the ejection
+// ends. It reports whether the status was applied.
+func (hc *DefaultHealthChecker) applyStatus(b *Backend, alive bool) bool {
+	hc.statusMu.Lock()
+	defer hc.statusMu.Unlock()
+
+	if hc.holdEjected(b, alive) {
+		return false
+	}
+
+	lb := hc.balancerOf(b)
+	previousState := b.Alive
+	if previousState && !alive {
+		backends := lb.GetBackends()
+		aliveCount := 0
+		for _, backend := range backends {
+			if backend.Alive {
+				aliveCount++
 			}
-		}(backend)
+		}
+
+		required := hc.options.MinHealthy.Required(len(backends))
+		if aliveCount-1 < required {
+			log.Printf("WARNING: Backend %s is failing health checks but is kept in rotation: "+
+				"only %d of %d backends alive, minimum healthy is %s",
+				b.URL.String(), aliveCount, len(backends), hc.options.MinHealthy)
+			return false
+		}
+	}
+
+	lb.UpdateBackendStatus(b, alive)
+
+	if previousState != alive {
+		status := "DOWN"
+		if alive {
+			status = "UP"
+		}
+		log.Printf("Backend %s status changed to %s", b.URL.String(), status)
 	}
+	return true
 }
@@ -0,0 +1,141 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckConcurrencyIsBounded(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight, checks := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		checks++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// Every backend is a distinct base path on the same server
+	lb := NewRoundRobinBalancer()
+	for i := range 12 {
+		backendURL, _ := url.Parse(fmt.Sprintf("%s/b%d", server.URL, i))
+		lb.AddBackend(&Backend{URL: backendURL, Alive: true, Ready: true, Weight: 1})
+	}
+	hc := NewHealthChecker(lb, time.Second, time.Second, HealthCheckOptions{Concurrency: 3})
+	hc.performHealthChecks()
+
+	if checks != 12 {
+		t.Errorf("got %d checks, want one per backend", checks)
+	}
+	if maxInFlight != 3 {
+		t.Errorf("got up to %d checks at once, want 3", maxInFlight)
+	}
+}
+
+func TestHealthSettingsUpdatedDuringChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	lb := NewRoundRobinBalancer()
+	backendURL, _ := url.Parse(server.URL)
+	backend := &Backend{URL: backendURL, Alive: true, Ready: true, Weight: 1}
+	lb.AddBackend(backend)
+	hc := NewHealthChecker(lb, time.Second, time.Second, HealthCheckOptions{})
+
+	// Run with -race: a reload changes the overrides while checks read them
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 20 {
+			settings := backend.Settings()
+			settings.Health = HealthOverride{Path: fmt.Sprintf("/health/%d", i), Timeout: time.Second}
+			lb.UpdateBackendSettings(backend, settings)
+		}
+	}()
+	for range 20 {
+		if !hc.CheckHealth(backend) {
+			t.Fatal("check failed")
+		}
+	}
+	<-done
+
+	if got := backend.HealthSettings().Path; got != "/health/19" {
+		t.Errorf("got health path %s, want the last update's /health/19", got)
+	}
+}
+
+func TestRemovedBackendStateIsForgotten(t *testing.T) {
+	lb := NewRoundRobinBalancer()
+	backend := newTestBackends(1)[0]
+	lb.AddBackend(backend)
+	hc := NewHealthChecker(lb, time.Second, time.Second, HealthCheckOptions{
+		Passive:    PassiveCheck{Failures: 5},
+		Outlier:    OutlierDetection{ErrorRate: 50, Window: time.Minute},
+		MaxBackoff: time.Minute,
+	})
+
+	hc.recordCheck(backend, false, time.Now())
+	hc.ReportResult(backend, false)
+	hc.sampleOutlier(backend, time.Now())
+	key := backend.Key()
+	if hc.failureRuns[key] == nil || hc.backoffs[key] == nil || hc.outcomes[key] == nil || hc.outlierSamples[key] == nil {
+		t.Fatal("failures were not recorded")
+	}
+
+	// Removing the backend drops everything kept for its key
+	lb.RemoveBackend(backend)
+	if hc.failureRuns[key] != nil || hc.backoffs[key] != nil || hc.outcomes[key] != nil ||
+		hc.outlierSamples[key] != nil || hc.ejections[key] != nil {
+		t.Error("health state kept for a removed backend")
+	}
+
+	// A backend added again under the same key is due right away
+	lb.AddBackend(backend)
+	if !hc.due(backend, time.Now()) {
+		t.Error("re-added backend waits out the removed backend's backoff")
+	}
+}
+
+func TestDiagnoseAllCoversPools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	lb, pool := NewRoundRobinBalancer(), NewRoundRobinBalancer()
+	healthyURL, _ := url.Parse(server.URL)
+	healthy := &Backend{URL: healthyURL, Alive: true, Ready: true, Weight: 1}
+	lb.AddBackend(healthy)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	downURL, _ := url.Parse(closed.URL)
+	down := &Backend{URL: downURL, Alive: true, Ready: true, Weight: 1}
+	pool.AddBackend(down)
+
+	hc := NewHealthChecker(lb, time.Second, time.Second, HealthCheckOptions{})
+	hc.AddPool(pool)
+
+	diagnoses := hc.DiagnoseAll()
+	if len(diagnoses) != 2 {
+		t.Fatalf("got %d diagnoses, want one per backend of both balancers", len(diagnoses))
+	}
+	for _, diagnosis := range diagnoses {
+		if wantHealthy := diagnosis.Backend == healthy; diagnosis.Healthy() != wantHealthy {
+			t.Errorf("backend %s: got %s", diagnosis.Backend.URL, diagnosis.Diagnosis)
+		}
+	}
+	if diagnoses[1].Backend != down || diagnoses[1].DialError == nil {
+		t.Errorf("got %s for the pool backend, want it unreachable", diagnoses[1].Diagnosis)
+	}
+}
@@ -1,17 +1,49 @@
 package balancer
 
 import (
+	"errors"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Backend represents a backend server
 type Backend struct {
-	URL          *url.URL
-	Alive        bool
-	Connections  int32
-	SuccessCount int32
-	ErrorCount   int32
+	// ID identifies the backend independently of its URL, which can change
+	// through UpdateBackend. If empty, the URL at the time of the first
+	// update is used.
+	ID             string
+	Name           string // friendly name for operators, optional
+	URL            *url.URL
+	Alive          bool
+	Ready          bool // a live backend that is not ready gets no requests but isn't counted as failing
+	Draining       bool // receives no new requests while in-flight ones finish
+	Connections    int32
+	MaxConnections int32 // no new requests are sent once Connections reaches it (0 means no limit)
+	SuccessCount   int32
+	ErrorCount     int32
+	Weight         int
+	Priority       int   // failover tier: only the lowest priority with available backends gets requests
+	ResponseTime   int64 // moving average in nanoseconds, 0 until the first response
+	RecoveredAt    int64 // Unix nanoseconds when the backend last came back up, 0 if it never went down
+	Dynamic        bool  // added at runtime rather than configured, so reloads and DNS refreshes leave it in place
+
+	// Health overrides the health checker's settings for this backend. Once
+	// the backend is in a balancer it is changed through UpdateBackendSettings
+	// and read through HealthSettings, which hold healthMu.
+	Health   HealthOverride
+	healthMu sync.RWMutex
+
+	// Health check results, kept apart from the request counts above and
+	// updated only by the health checker
+	HealthSuccessCount int32
+	HealthFailCount    int32
+	LastCheckedAt      int64         // Unix nanoseconds when the last check completed, 0 until the first
+	LastLatency        time.Duration // duration of the last health check
 }
 
 // LoadBalancer defines the interface for load balancing strategies
@@ -28,8 +60,116 @@ type LoadBalancer interface {
 	// GetBackends returns all backend servers
 	GetBackends() []*Backend
 
+	// GetBackend returns the backend with the given ID or URL, or nil if there is none
+	GetBackend(idOrURL string) *Backend
+
 	// UpdateBackendStatus updates the status of a backend
 	UpdateBackendStatus(backend *Backend, alive bool)
+
+	// UpdateBackendReady updates whether a backend is ready for requests
+	UpdateBackendReady(backend *Backend, ready bool)
+
+	// UpdateBackendDraining starts or stops draining a backend
+	UpdateBackendDraining(backend *Backend, draining bool)
+
+	// UpdateBackend changes a backend's URL in place, keeping its identity, health state and stats
+	UpdateBackend(backend *Backend, backendURL *url.URL)
+
+	// UpdateBackendSettings changes a backend's weight, priority, name and connection cap
+	// in place, keeping its health state, stats and open connections
+	UpdateBackendSettings(backend *Backend, settings BackendSettings)
+
+	// OnRemove registers a function called with each backend removed from the balancer
+	OnRemove(fn func(*Backend))
+}
+
+// ConnectionTracker is implemented by balancers that count a connection when
+// they select a backend, claiming it against the backend's MaxConnections cap
+// with ReserveConnection. The proxy ends it through DecrementConnections.
+type ConnectionTracker interface {
+	// DecrementConnections ends a connection counted when backend was selected
+	DecrementConnections(backend *Backend)
+}
+
+// ParseBackendURL parses a backend URL, which must include a scheme and host
+func ParseBackendURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, errors.New("backend URL must include a scheme and host")
+	}
+	return parsedURL, nil
+}
+
+// DialAddr returns the host:port to connect to for a URL, filling in the
+// scheme's default port
+func DialAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// Key returns the backend's stable identity: its ID, or its URL if no ID is set
+func (b *Backend) Key() string {
+	if b.ID != "" {
+		return b.ID
+	}
+	return b.URL.String()
+}
+
+// BackendSettings are the configurable attributes of a backend
+type BackendSettings struct {
+	Weight         int
+	Priority       int
+	Name           string
+	MaxConnections int32
+	Health         HealthOverride
+}
+
+// Equal reports whether two sets of settings are the same
+func (s BackendSettings) Equal(other BackendSettings) bool {
+	return s.Weight == other.Weight && s.Priority == other.Priority && s.Name == other.Name && s.MaxConnections == other.MaxConnections &&
+		s.Health.Path == other.Health.Path && s.Health.Timeout == other.Health.Timeout &&
+		slices.Equal(s.Health.ExpectStatus, other.Health.ExpectStatus)
+}
+
+// Settings returns the backend's configurable attributes
+func (b *Backend) Settings() BackendSettings {
+	return BackendSettings{Weight: b.Weight, Priority: b.Priority, Name: b.Name, MaxConnections: b.MaxConnections, Health: b.HealthSettings()}
+}
+
+// HealthSettings returns the backend's health check overrides
+func (b *Backend) HealthSettings() HealthOverride {
+	b.healthMu.RLock()
+	defer b.healthMu.RUnlock()
+	return b.Health
+}
+
+// applySettings replaces the backend's configurable attributes
+func (b *Backend) applySettings(settings BackendSettings) {
+	b.Weight = settings.Weight
+	b.Priority = settings.Priority
+	b.Name = settings.Name
+	b.MaxConnections = settings.MaxConnections
+
+	// The health checker reads the overrides without the balancer's lock
+	b.healthMu.Lock()
+	b.Health = settings.Health
+	b.healthMu.Unlock()
+}
+
+// setURL replaces the backend's URL, pinning its identity to the old URL if it has no ID
+func (b *Backend) setURL(backendURL *url.URL) {
+	if b.ID == "" {
+		b.ID = b.URL.String()
+	}
+	b.URL = backendURL
 }
 
 // HealthChecker interface for health checking backends
@@ -42,4 +182,13 @@ type HealthChecker interface {
 
 	// StopHealthCheck stops health checks
 	StopHealthCheck()
+
+	// Timing returns the current check interval and timeout
+	Timing() (interval, timeout time.Duration)
+
+	// UpdateTiming changes the check interval and timeout at runtime
+	UpdateTiming(interval, timeout time.Duration) error
+
+	// ReportResult records whether a proxied request to a backend succeeded, for passive health checks
+	ReportResult(backend *Backend, success bool)
 }
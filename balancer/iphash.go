@@ -3,24 +3,59 @@ package balancer
 import (
 	"crypto/md5"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+)
+
+// Fallbacks for requests without a client IP to hash
+const (
+	IPHashFallbackRoundRobin = "round-robin"
+	IPHashFallbackFirst      = "first"
+)
+
+// Strategies for retrying a request whose hashed backend failed it
+const (
+	IPHashRetryNext       = "next"
+	IPHashRetryRoundRobin = "round-robin"
 )
 
 type IPHashBalancer struct {
-	backends []*Backend
-	mu       sync.RWMutex
+	backendRegistry
+	fallback string
+	retry    string
+	next     uint64
 }
 
-func NewIPHashBalancer() *IPHashBalancer {
+// NewIPHashBalancer creates an IP hash balancer. fallback chooses the backend
+// for requests whose client address is not a valid IP; an empty string means
+// IPHashFallbackRoundRobin. retry chooses the backend for retries of a failed
+// request; an empty string means IPHashRetryNext.
+func NewIPHashBalancer(fallback, retry string) *IPHashBalancer {
 	return &IPHashBalancer{
-		backends: make([]*Backend, 0),
+		fallback: fallback,
+		retry:    retry,
 	}
 }
 
+// SelectBackend hashes the client IP onto the full backend list. If the
+// backend at that position is not selectable, the following positions are
+// probed in order, so a backend going down only moves the clients that were
+// mapped to it while every other client keeps its backend.
+//
+// Retries exclude the backends that already failed the request. With
+// IPHashRetryNext they walk on to the next positions like a backend that is
+// down, so a client's retries consistently go to the same second choice.
+// With IPHashRetryRoundRobin they rotate over the remaining backends instead,
+// spreading the retries of a failing backend's clients across the pool.
+//
+// The selected backend's connection is counted as part of the selection; a
+// backend that reached its cap in the meantime is passed over like one that
+// is down.
 func (ihb *IPHashBalancer) SelectBackend(request *http.Request) *Backend {
 	ihb.mu.RLock()
 	defer ihb.mu.RUnlock()
@@ -29,9 +64,67 @@ func (ihb *IPHashBalancer) SelectBackend(request *http.Request) *Backend {
 		return nil
 	}
 
+	candidates := newCandidates(request, ihb.backends)
+	for {
+		selected := ihb.selectCandidate(request, candidates)
+		if selected == nil || selected.ReserveConnection() {
+			return selected
+		}
+	}
+}
+
+// selectCandidate picks the candidate for a request as described for
+// SelectBackend. Callers must hold at least a read lock.
+func (ihb *IPHashBalancer) selectCandidate(request *http.Request, candidates candidateSet) *Backend {
+	count := len(ihb.backends)
+	if ihb.retry == IPHashRetryRoundRobin && len(candidates.excluded) > 0 {
+		return ihb.rotate(candidates)
+	}
+
+	clientIP := ihb.getClientIP(request)
+	if _, err := netip.ParseAddr(clientIP); err != nil {
+		return ihb.selectFallback(candidates, clientIP)
+	}
+
+	start := int(ihb.hashIP(clientIP) % uint32(count))
+	for step := 0; step < count; step++ {
+		if backend := ihb.backends[(start+step)%count]; candidates.has(backend) {
+			return backend
+		}
+	}
+	return nil
+}
+
+// selectFallback picks a backend for a request without a usable client IP.
+// Hashing an arbitrary string would give no real affinity, so such requests
+// either rotate over the alive backends or all go to the first one. Callers
+// must hold at least a read lock.
+func (ihb *IPHashBalancer) selectFallback(candidates candidateSet, clientIP string) *Backend {
+	var selected *Backend
+	switch ihb.fallback {
+	case IPHashFallbackFirst:
+		for _, backend := range ihb.backends {
+			if candidates.has(backend) {
+				selected = backend
+				break
+			}
+		}
+	default:
+		selected = ihb.rotate(candidates)
+	}
+
+	if selected != nil {
+		log.Printf("No valid client IP in %q, ip-hash falling back to %s", clientIP, selected.URL.String())
+	}
+	return selected
+}
+
+// rotate picks the candidates in turn, without regard to the client. Callers
+// must hold at least a read lock.
+func (ihb *IPHashBalancer) rotate(candidates candidateSet) *Backend {
 	aliveBackends := make([]*Backend, 0)
 	for _, backend := range ihb.backends {
-		if backend.Alive {
+		if candidates.has(backend) {
 			aliveBackends = append(aliveBackends, backend)
 		}
 	}
@@ -40,12 +133,14 @@ func (ihb *IPHashBalancer) SelectBackend(request *http.Request) *Backend {
 		return nil
 	}
 
-	clientIP := ihb.getClientIP(request)
-	hash := ihb.hashIP(clientIP)
-	index := hash % uint32(len(aliveBackends))
+	index := (atomic.AddUint64(&ihb.next, 1) - 1) % uint64(len(aliveBackends))
 	return aliveBackends[index]
 }
 
+func (ihb *IPHashBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
+}
+
 func (ihb *IPHashBalancer) getClientIP(request *http.Request) string {
 	forwarded := request.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
@@ -74,42 +169,3 @@ func (ihb *IPHashBalancer) hashIP(ip string) uint32 {
 	}
 	return uint32(hashInt)
 }
-
-func (ihb *IPHashBalancer) AddBackend(backend *Backend) {
-	ihb.mu.Lock()
-	defer ihb.mu.Unlock()
-	ihb.backends = append(ihb.backends, backend)
-}
-
-func (ihb *IPHashBalancer) RemoveBackend(backend *Backend) {
-	ihb.mu.Lock()
-	defer ihb.mu.Unlock()
-
-	for i, b := range ihb.backends {
-		if b.URL.String() == backend.URL.String() {
-			ihb.backends = append(ihb.backends[:i], ihb.backends[i+1:]...)
-			break
-		}
-	}
-}
-
-func (ihb *IPHashBalancer) GetBackends() []*Backend {
-	ihb.mu.RLock()
-	defer ihb.mu.RUnlock()
-
-	backends := make([]*Backend, len(ihb.backends))
-	copy(backends, ihb.backends)
-	return backends
-}
-
-func (ihb *IPHashBalancer) UpdateBackendStatus(backend *Backend, alive bool) {
-	ihb.mu.Lock()
-	defer ihb.mu.Unlock()
-
-	for _, b := range ihb.backends {
-		if b.URL.String() == backend.URL.String() {
-			b.Alive = alive
-			break
-		}
-	}
-}
@@ -0,0 +1,102 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// requestFrom returns a request from the given client IP
+func requestFrom(ip string) *http.Request {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = ip + ":40000"
+	return request
+}
+
+func TestIPHashRetry(t *testing.T) {
+	backends := newTestBackends(4)
+	request := requestFrom("192.168.1.10")
+
+	// The retry strategy doesn't change where first attempts go
+	next := NewIPHashBalancer(IPHashFallbackRoundRobin, IPHashRetryNext)
+	addBackends(next, backends)
+	hashed := next.SelectBackend(request)
+	position := 0
+	for i, backend := range backends {
+		if backend == hashed {
+			position = i
+		}
+	}
+	retry := WithExcludedBackends(request, []*Backend{hashed})
+
+	t.Run("next", func(t *testing.T) {
+		want := backends[(position+1)%len(backends)]
+		for i := 0; i < 5; i++ {
+			if got := next.SelectBackend(retry); got != want {
+				t.Fatalf("retry %d went to %s, want the next position %s", i, got.URL, want.URL)
+			}
+		}
+	})
+
+	t.Run("round-robin", func(t *testing.T) {
+		rotating := NewIPHashBalancer(IPHashFallbackRoundRobin, IPHashRetryRoundRobin)
+		addBackends(rotating, backends)
+		if got := rotating.SelectBackend(request); got != hashed {
+			t.Fatalf("first attempt went to %s, want %s", got.URL, hashed.URL)
+		}
+
+		counts := make(map[*Backend]int)
+		for i := 0; i < 30; i++ {
+			counts[rotating.SelectBackend(retry)]++
+		}
+		if counts[hashed] != 0 {
+			t.Errorf("%d retries went back to the failed backend", counts[hashed])
+		}
+		for _, backend := range backends {
+			if backend != hashed && counts[backend] != 10 {
+				t.Errorf("backend %s got %d of 30 retries, want 10", backend.URL, counts[backend])
+			}
+		}
+	})
+}
+
+func TestIPHashStickiness(t *testing.T) {
+	ihb := NewIPHashBalancer(IPHashFallbackRoundRobin, IPHashRetryNext)
+	backends := newTestBackends(4)
+	addBackends(ihb, backends)
+
+	clients := make([]string, 50)
+	assigned := make(map[string]*Backend)
+	for i := range clients {
+		clients[i] = fmt.Sprintf("172.16.%d.%d", i/10, i)
+		assigned[clients[i]] = ihb.SelectBackend(requestFrom(clients[i]))
+	}
+
+	// The same client always gets the same backend
+	for _, client := range clients {
+		for i := 0; i < 5; i++ {
+			if got := ihb.SelectBackend(requestFrom(client)); got != assigned[client] {
+				t.Fatalf("client %s went to %s, then %s", client, assigned[client].URL, got.URL)
+			}
+		}
+	}
+
+	// Only the clients of a backend that goes down move, and none of them to it
+	down := assigned[clients[0]]
+	ihb.UpdateBackendStatus(down, false)
+	for _, client := range clients {
+		got := ihb.SelectBackend(requestFrom(client))
+		switch {
+		case got == nil || got == down:
+			t.Errorf("client %s went to %v with %s down", client, got, down.URL)
+		case assigned[client] != down && got != assigned[client]:
+			t.Errorf("client %s moved from %s to %s when %s went down", client, assigned[client].URL, got.URL, down.URL)
+		}
+	}
+
+	// They return to it once it is back
+	ihb.UpdateBackendStatus(down, true)
+	if got := ihb.SelectBackend(requestFrom(clients[0])); got != down {
+		t.Errorf("client %s went to %s after %s came back", clients[0], got.URL, down.URL)
+	}
+}
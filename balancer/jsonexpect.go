@@ -0,0 +1,85 @@
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONExpectation requires a field in a JSON document to have a specific value
+type JSONExpectation struct {
+	Path  []string
+	Value string
+}
+
+// ParseJSONExpectation parses an expression like ".status=UP" or ".checks.db=ok".
+// Path segments are separated by dots; numeric segments index into arrays.
+func ParseJSONExpectation(expr string) (*JSONExpectation, error) {
+	path, value, found := strings.Cut(expr, "=")
+	if !found {
+		return nil, fmt.Errorf("invalid JSON expectation %q: expected <path>=<value>", expr)
+	}
+
+	path = strings.TrimPrefix(strings.TrimSpace(path), ".")
+	if path == "" {
+		return nil, fmt.Errorf("invalid JSON expectation %q: empty path", expr)
+	}
+
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid JSON expectation %q: empty path segment", expr)
+		}
+	}
+
+	return &JSONExpectation{Path: segments, Value: strings.TrimSpace(value)}, nil
+}
+
+// String returns the expectation in the form accepted by ParseJSONExpectation
+func (je *JSONExpectation) String() string {
+	return "." + strings.Join(je.Path, ".") + "=" + je.Value
+}
+
+// Match checks the expectation against a JSON document
+func (je *JSONExpectation) Match(body []byte) error {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	current := document
+	for _, segment := range je.Path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return fmt.Errorf("field %q not found", segment)
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return fmt.Errorf("array index %q out of range", segment)
+			}
+			current = node[index]
+		default:
+			return fmt.Errorf("cannot descend into %q", segment)
+		}
+	}
+
+	// Strings compare by value, everything else by its JSON form (true, 3, null)
+	actual, ok := current.(string)
+	if !ok {
+		encoded, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		actual = string(encoded)
+	}
+
+	if actual != je.Value {
+		return fmt.Errorf("%s is %q, expected %q", "."+strings.Join(je.Path, "."), actual, je.Value)
+	}
+	return nil
+}
@@ -1,89 +1,88 @@
 package balancer
 
 import (
+	"math/rand/v2"
 	"net/http"
-	"sync"
 	"sync/atomic"
 )
 
+// Tie-breaking strategies for backends sharing the fewest connections
+const (
+	TieBreakFirst      = "first"
+	TieBreakRandom     = "random"
+	TieBreakRoundRobin = "round-robin"
+)
+
 type LeastConnectionsBalancer struct {
-	backends []*Backend
-	mu       sync.RWMutex
+	backendRegistry
+	tieBreak string
+	next     uint64
 }
 
-func NewLeastConnectionsBalancer() *LeastConnectionsBalancer {
+// NewLeastConnectionsBalancer creates a least-connections balancer. tieBreak
+// chooses among backends with equally few connections; an empty string means
+// TieBreakFirst.
+func NewLeastConnectionsBalancer(tieBreak string) *LeastConnectionsBalancer {
 	return &LeastConnectionsBalancer{
-		backends: make([]*Backend, 0),
+		tieBreak: tieBreak,
 	}
 }
+
+// SelectBackend returns the alive backend with the fewest connections. Ties go
+// to the first such backend in scan order; the scan starts at index 0 for
+// TieBreakFirst, at a random index for TieBreakRandom, and one index further on
+// each request for TieBreakRoundRobin. Under light load most backends sit at
+// the same count, so TieBreakFirst favors earlier-listed backends.
+//
+// The selected backend's count is incremented only if it still holds the
+// value the scan saw, so two concurrent requests can't both claim the same
+// least-loaded slot; a request that loses the race scans again.
 func (lcb *LeastConnectionsBalancer) SelectBackend(request *http.Request) *Backend {
 	lcb.mu.RLock()
 	defer lcb.mu.RUnlock()
 
-	if len(lcb.backends) == 0 {
+	count := len(lcb.backends)
+	if count == 0 {
 		return nil
 	}
 
-	var selected *Backend
-	minConnections := int32(-1)
+	start := 0
+	switch lcb.tieBreak {
+	case TieBreakRandom:
+		start = rand.IntN(count)
+	case TieBreakRoundRobin:
+		start = int((atomic.AddUint64(&lcb.next, 1) - 1) % uint64(count))
+	}
 
-	for _, backend := range lcb.backends {
-		if !backend.Alive {
-			continue
+	candidates := newCandidates(request, lcb.backends)
+	for {
+		var selected *Backend
+		minConnections := int32(-1)
+
+		for step := 0; step < count; step++ {
+			backend := lcb.backends[(start+step)%count]
+			if !candidates.has(backend) {
+				continue
+			}
+
+			connections := atomic.LoadInt32(&backend.Connections)
+			if minConnections == -1 || connections < minConnections {
+				minConnections = connections
+				selected = backend
+			}
 		}
 
-		connections := atomic.LoadInt32(&backend.Connections)
-		if minConnections == -1 || connections < minConnections {
-			minConnections = connections
-			selected = backend
+		if selected == nil {
+			return nil
 		}
-	}
-
-	if selected != nil {
-		atomic.AddInt32(&selected.Connections, 1)
-	}
-
-	return selected
-}
-
-func (lcb *LeastConnectionsBalancer) AddBackend(backend *Backend) {
-	lcb.mu.Lock()
-	defer lcb.mu.Unlock()
-	lcb.backends = append(lcb.backends, backend)
-}
 
-func (lcb *LeastConnectionsBalancer) RemoveBackend(backend *Backend) {
-	lcb.mu.Lock()
-	defer lcb.mu.Unlock()
-
-	for i, b := range lcb.backends {
-		if b.URL.String() == backend.URL.String() {
-			lcb.backends = append(lcb.backends[:i], lcb.backends[i+1:]...)
-			break
+		// Another request may have changed the count since the scan; retry from there
+		if atomic.CompareAndSwapInt32(&selected.Connections, minConnections, minConnections+1) {
+			return selected
 		}
 	}
 }
 
-func (lcb *LeastConnectionsBalancer) GetBackends() []*Backend {
-	lcb.mu.RLock()
-	defer lcb.mu.RUnlock()
-
-	backends := make([]*Backend, len(lcb.backends))
-	copy(backends, lcb.backends)
-	return backends
-}
-
-func (lcb *LeastConnectionsBalancer) UpdateBackendStatus(backend *Backend, alive bool) {
-	lcb.mu.Lock()
-	defer lcb.mu.Unlock()
-
-	for _, b := range lcb.backends {
-		if b.URL.String() == backend.URL.String() {
-			b.Alive = alive
-			break
-		}
-	}
-}
 func (lcb *LeastConnectionsBalancer) DecrementConnections(backend *Backend) {
 	atomic.AddInt32(&backend.Connections, -1)
 }
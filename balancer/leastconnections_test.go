@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestLeastConnectionsConcurrentSelection(t *testing.T) {
+	lcb := NewLeastConnectionsBalancer(TieBreakFirst)
+	backends := newTestBackends(8)
+	addBackends(lcb, backends)
+
+	// Run with -race. Every selection claims the least-loaded backend and none
+	// are released, so the counts can never drift more than one apart.
+	request, _ := http.NewRequest("GET", "/", nil)
+	var wg sync.WaitGroup
+	for range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				if lcb.SelectBackend(request) == nil {
+					t.Error("got no backend")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, backend := range backends {
+		if backend.Connections != 64*1000/8 {
+			t.Errorf("backend %s has %d connections, want %d", backend.URL, backend.Connections, 64*1000/8)
+		}
+	}
+}
+
+func TestLeastConnectionsTieBreak(t *testing.T) {
+	// Sequential requests that release their connection leave every backend
+	// tied at zero on each selection
+	tests := []struct {
+		tieBreak string
+		want     []int // requests per backend, or nil for an even spread within tolerance
+	}{
+		{TieBreakFirst, []int{4000, 0, 0, 0}},
+		{TieBreakRoundRobin, []int{1000, 1000, 1000, 1000}},
+		{TieBreakRandom, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tieBreak, func(t *testing.T) {
+			lcb := NewLeastConnectionsBalancer(tt.tieBreak)
+			backends := newTestBackends(4)
+			addBackends(lcb, backends)
+
+			request, _ := http.NewRequest("GET", "/", nil)
+			counts := make(map[*Backend]int)
+			for range 4000 {
+				backend := lcb.SelectBackend(request)
+				counts[backend]++
+				lcb.DecrementConnections(backend)
+			}
+
+			for i, backend := range backends {
+				if tt.want == nil {
+					if got := counts[backend]; got < 800 || got > 1200 {
+						t.Errorf("backend %s got %d of 4000 requests, want about 1000", backend.URL, got)
+					}
+				} else if got := counts[backend]; got != tt.want[i] {
+					t.Errorf("backend %s got %d of 4000 requests, want %d", backend.URL, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
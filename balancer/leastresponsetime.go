@@ -0,0 +1,90 @@
+package balancer
+
+import (
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// responseTimeWeight is the weight of the newest sample in a backend's
+// response time average; older samples decay by 1-responseTimeWeight each time
+const responseTimeWeight = 0.2
+
+// ObserveResponseTime folds a response latency into the backend's
+// exponentially weighted moving average. The first sample seeds the average.
+func (b *Backend) ObserveResponseTime(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&b.ResponseTime)
+		next := int64(d)
+		if old != 0 {
+			next = int64(math.Round(responseTimeWeight*float64(d) + (1-responseTimeWeight)*float64(old)))
+		}
+		next = max(next, 1) // zero means no samples yet
+		if atomic.CompareAndSwapInt64(&b.ResponseTime, old, next) {
+			return
+		}
+	}
+}
+
+type LeastResponseTimeBalancer struct {
+	backendRegistry
+	untested uint64
+}
+
+func NewLeastResponseTimeBalancer() *LeastResponseTimeBalancer {
+	return &LeastResponseTimeBalancer{}
+}
+
+// SelectBackend returns the alive backend with the lowest average response
+// time. Backends without any samples yet take precedence and are rotated
+// round-robin, so every backend gets measured before latency decides.
+// The selected backend's connection is counted as part of the selection.
+func (lrt *LeastResponseTimeBalancer) SelectBackend(request *http.Request) *Backend {
+	lrt.mu.RLock()
+	defer lrt.mu.RUnlock()
+
+	candidates := newCandidates(request, lrt.backends)
+	for {
+		selected := lrt.fastest(candidates)
+
+		// Another request may have filled the backend up to its cap since the scan
+		if selected == nil || selected.ReserveConnection() {
+			return selected
+		}
+	}
+}
+
+// fastest returns the next untested candidate or else the one with the
+// lowest average response time. Callers must hold at least a read lock.
+func (lrt *LeastResponseTimeBalancer) fastest(candidates candidateSet) *Backend {
+	var untested []*Backend
+	var selected *Backend
+	fastest := int64(-1)
+
+	for _, backend := range lrt.backends {
+		if !candidates.has(backend) {
+			continue
+		}
+
+		responseTime := atomic.LoadInt64(&backend.ResponseTime)
+		if responseTime == 0 {
+			untested = append(untested, backend)
+			continue
+		}
+		if fastest == -1 || responseTime < fastest {
+			fastest = responseTime
+			selected = backend
+		}
+	}
+
+	if len(untested) > 0 {
+		index := (atomic.AddUint64(&lrt.untested, 1) - 1) % uint64(len(untested))
+		return untested[index]
+	}
+	return selected
+}
+
+func (lrt *LeastResponseTimeBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
+}
@@ -0,0 +1,54 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinHealthy is the minimum number of backends kept in rotation, either as
+// an absolute count or as a fraction of the pool
+type MinHealthy struct {
+	Count    int
+	Fraction float64
+}
+
+// ParseMinHealthy parses a count like "2" or a percentage like "50%"
+func ParseMinHealthy(value string) (MinHealthy, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return MinHealthy{}, nil
+	}
+
+	if percent, found := strings.CutSuffix(value, "%"); found {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 || p > 100 {
+			return MinHealthy{}, fmt.Errorf("invalid min healthy percentage: %s", value)
+		}
+		return MinHealthy{Fraction: p / 100}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return MinHealthy{}, fmt.Errorf("invalid min healthy count: %s", value)
+	}
+	return MinHealthy{Count: count}, nil
+}
+
+// Required returns how many backends must stay in rotation for a pool of the given size
+func (mh MinHealthy) Required(total int) int {
+	required := mh.Count
+	if mh.Fraction > 0 {
+		required = int(math.Ceil(mh.Fraction * float64(total)))
+	}
+	return min(required, total)
+}
+
+// String returns the threshold in the form accepted by ParseMinHealthy
+func (mh MinHealthy) String() string {
+	if mh.Fraction > 0 {
+		return strconv.FormatFloat(mh.Fraction*100, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(mh.Count)
+}
@@ -0,0 +1,163 @@
+package balancer
+
+import (
+	"log"
+	"time"
+)
+
+// outlierSamples is how many times per window request counts are sampled
+const outlierSamples = 10
+
+// OutlierDetection temporarily ejects backends whose recent error rate is
+// too high, even when failures are interspersed with successes
+type OutlierDetection struct {
+	// ErrorRate is the percentage of failed requests within Window that ejects a backend (0 disables it)
+	ErrorRate float64
+
+	// MinRequests is how many requests a backend must have served within Window before it can be ejected
+	MinRequests int
+
+	// Window is the sliding window over which the error rate is computed
+	Window time.Duration
+
+	// Cooldown is how long an ejected backend is kept out of rotation
+	Cooldown time.Duration
+}
+
+// outcomeCount counts the request outcomes reported for a backend. Unlike
+// SuccessCount and ErrorCount, 5xx responses count as failures.
+type outcomeCount struct {
+	successes int64
+	failures  int64
+}
+
+// countSample is a backend's outcome counts at one point in time
+type countSample struct {
+	at time.Time
+	outcomeCount
+}
+
+// ejection is a backend kept out of rotation by outlier detection
+type ejection struct {
+	until       time.Time
+	checkFailed bool // an active or passive check failed while ejected
+}
+
+// recordOutcome counts a reported request outcome for outlier detection
+func (hc *DefaultHealthChecker) recordOutcome(b *Backend, success bool) {
+	if hc.options.Outlier.ErrorRate <= 0 {
+		return
+	}
+
+	hc.outlierMu.Lock()
+	defer hc.outlierMu.Unlock()
+
+	counts, ok := hc.outcomes[b.Key()]
+	if !ok {
+		counts = &outcomeCount{}
+		hc.outcomes[b.Key()] = counts
+	}
+	if success {
+		counts.successes++
+	} else {
+		counts.failures++
+	}
+}
+
+// detectOutliers samples request counts until the checker is stopped
+func (hc *DefaultHealthChecker) detectOutliers() {
+	ticker := time.NewTicker(hc.options.Outlier.Window / outlierSamples)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hc.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, backend := range hc.allBackends() {
+				hc.sampleOutlier(backend, now)
+			}
+		}
+	}
+}
+
+// sampleOutlier records a backend's outcome counts, ejects it if its error
+// rate over the window is too high, and re-admits it once its cooldown ends
+func (hc *DefaultHealthChecker) sampleOutlier(b *Backend, now time.Time) {
+	outlier := hc.options.Outlier
+	key := b.Key()
+
+	hc.outlierMu.Lock()
+	if ejected, ok := hc.ejections[key]; ok {
+		if now.Before(ejected.until) {
+			hc.outlierMu.Unlock()
+			return
+		}
+		delete(hc.ejections, key)
+		hc.outlierMu.Unlock()
+
+		if ejected.checkFailed {
+			log.Printf("Backend %s ejection ended, but it failed checks meanwhile; it returns after passing a health check", b.URL.String())
+			return
+		}
+		log.Printf("Backend %s ejection ended, re-admitting it", b.URL.String())
+		hc.applyStatus(b, true)
+		return
+	}
+
+	// Keep the newest sample at or before the window start as the baseline
+	var counts outcomeCount
+	if current, ok := hc.outcomes[key]; ok {
+		counts = *current
+	}
+	samples := append(hc.outlierSamples[key], countSample{at: now, outcomeCount: counts})
+	for len(samples) > 1 && !samples[1].at.After(now.Add(-outlier.Window)) {
+		samples = samples[1:]
+	}
+	hc.outlierSamples[key] = samples
+
+	oldest, newest := samples[0], samples[len(samples)-1]
+	failures := newest.failures - oldest.failures
+	total := newest.successes - oldest.successes + failures
+	if !b.Alive || total <= 0 || total < int64(outlier.MinRequests) {
+		hc.outlierMu.Unlock()
+		return
+	}
+
+	rate := 100 * float64(failures) / float64(total)
+	if rate < outlier.ErrorRate {
+		hc.outlierMu.Unlock()
+		return
+	}
+
+	// Start over after the ejection so old errors don't eject it again
+	delete(hc.outlierSamples, key)
+	hc.ejections[key] = &ejection{until: now.Add(outlier.Cooldown)}
+	hc.outlierMu.Unlock()
+
+	log.Printf("Backend %s error rate %.1f%% over the last %d requests exceeds %.1f%%, ejecting it for %v",
+		b.URL.String(), rate, total, outlier.ErrorRate, outlier.Cooldown)
+	if !hc.applyStatus(b, false) {
+		// Kept in rotation by the minimum healthy threshold
+		hc.outlierMu.Lock()
+		delete(hc.ejections, key)
+		hc.outlierMu.Unlock()
+	}
+}
+
+// holdEjected reports whether a status update for b must wait for its
+// ejection to end, remembering failed checks so the backend isn't re-admitted
+// blindly afterwards
+func (hc *DefaultHealthChecker) holdEjected(b *Backend, alive bool) bool {
+	hc.outlierMu.Lock()
+	defer hc.outlierMu.Unlock()
+
+	ejected, ok := hc.ejections[b.Key()]
+	if !ok || b.Alive {
+		return false
+	}
+	if !alive {
+		ejected.checkFailed = true
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package balancer
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// p2cSampleAttempts bounds the random draws spent looking for an alive backend
+// before falling back to a scan of the pool
+const p2cSampleAttempts = 8
+
+type P2CBalancer struct {
+	backendRegistry
+}
+
+func NewP2CBalancer() *P2CBalancer {
+	return &P2CBalancer{}
+}
+
+// SelectBackend implements power-of-two-choices: it draws two random alive
+// backends and picks the one with fewer active connections. This spreads load
+// nearly as well as least-connections while doing constant work per request.
+func (p *P2CBalancer) SelectBackend(request *http.Request) *Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	candidates := newCandidates(request, p.backends)
+	for {
+		first := p.randomSelectable(candidates)
+		if first == nil {
+			return nil
+		}
+
+		selected := first
+		if second := p.randomSelectable(candidates); atomic.LoadInt32(&second.Connections) < atomic.LoadInt32(&first.Connections) {
+			selected = second
+		}
+
+		// Another request may have filled the backend up to its cap since the draw
+		if selected.ReserveConnection() {
+			return selected
+		}
+	}
+}
+
+// randomSelectable returns a random selectable backend, or nil if there is
+// none. Callers must hold at least a read lock.
+func (p *P2CBalancer) randomSelectable(candidates candidateSet) *Backend {
+	count := len(p.backends)
+	if count == 0 {
+		return nil
+	}
+
+	for attempt := 0; attempt < p2cSampleAttempts; attempt++ {
+		if backend := p.backends[rand.IntN(count)]; candidates.has(backend) {
+			return backend
+		}
+	}
+
+	// Mostly unavailable pool: scan from a random offset so the choice stays spread out
+	start := rand.IntN(count)
+	for step := 0; step < count; step++ {
+		if backend := p.backends[(start+step)%count]; candidates.has(backend) {
+			return backend
+		}
+	}
+	return nil
+}
+
+func (p *P2CBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
+}
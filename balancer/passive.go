@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"log"
+	"time"
+)
+
+// PassiveCheck marks a backend down when live traffic to it keeps failing,
+// without waiting for the next active health check
+type PassiveCheck struct {
+	// Failures is how many consecutive failed requests mark a backend down (0 disables passive checks)
+	Failures int
+
+	// Window is the time within which the consecutive failures must occur (0 means no limit)
+	Window time.Duration
+}
+
+// failureRun is a backend's current run of consecutive failed requests
+type failureRun struct {
+	count int
+	since time.Time
+}
+
+// ReportResult records the outcome of a proxied request to a backend. Once
+// passive checks see enough consecutive failures within the window, the
+// backend is marked down; the next passing active check brings it back.
+// Outcomes also feed outlier detection.
+func (hc *DefaultHealthChecker) ReportResult(backend *Backend, success bool) {
+	hc.recordOutcome(backend, success)
+
+	passive := hc.options.Passive
+	if passive.Failures <= 0 {
+		return
+	}
+
+	hc.passiveMu.Lock()
+	key := backend.Key()
+	if success {
+		delete(hc.failureRuns, key)
+		hc.passiveMu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	run, ok := hc.failureRuns[key]
+	if !ok || (passive.Window > 0 && now.Sub(run.since) > passive.Window) {
+		run = &failureRun{since: now}
+		hc.failureRuns[key] = run
+	}
+	run.count++
+
+	tripped := run.count >= passive.Failures
+	if tripped {
+		delete(hc.failureRuns, key)
+	}
+	hc.passiveMu.Unlock()
+
+	if tripped && backend.Alive {
+		log.Printf("Backend %s failed %d consecutive requests, marking it down until it passes a health check",
+			backend.URL.String(), passive.Failures)
+		hc.applyStatus(backend, false)
+	}
+}
@@ -0,0 +1,45 @@
+package balancer
+
+import "net/http"
+
+// candidateSet decides which of a balancer's backends may serve a request:
+// selectable backends in the most preferred priority tier that has any
+type candidateSet struct {
+	excluded []*Backend
+	priority int
+}
+
+// newCandidates returns the candidates for a request among a balancer's
+// backends. Callers must hold at least a read lock.
+func newCandidates(request *http.Request, backends []*Backend) candidateSet {
+	excluded := excludedBackends(request)
+	return candidateSet{excluded: excluded, priority: activePriority(backends, excluded)}
+}
+
+// has reports whether a backend is a candidate
+func (c candidateSet) has(backend *Backend) bool {
+	return backend.Priority == c.priority && isSelectable(backend, c.excluded)
+}
+
+// activePriority returns the lowest priority among the selectable backends,
+// or 0 if there are none. Backends of any other priority are held back as
+// failover until the whole tier is unavailable.
+func activePriority(backends []*Backend, excluded []*Backend) int {
+	priority, found := 0, false
+	for _, backend := range backends {
+		if (found && backend.Priority >= priority) || !isSelectable(backend, excluded) {
+			continue
+		}
+		priority, found = backend.Priority, true
+		if priority == 0 {
+			break // no tier is preferred over the primary one
+		}
+	}
+	return priority
+}
+
+// ActivePriority returns the priority tier that currently receives requests
+// among backends: the lowest priority of any backend able to take a request
+func ActivePriority(backends []*Backend) int {
+	return activePriority(backends, nil)
+}
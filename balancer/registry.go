@@ -0,0 +1,166 @@
+package balancer
+
+import (
+	"net/url"
+	"sync"
+)
+
+// backendRegistry holds a balancer's backends and implements the
+// LoadBalancer methods that manage them, so balancers embedding it only
+// implement SelectBackend. Backends are indexed by key, so status and
+// settings updates don't scan the list. Balancers hold mu while selecting.
+// The zero value is an empty registry.
+type backendRegistry struct {
+	backends []*Backend
+	byKey    map[string]*Backend
+	onRemove []func(*Backend)
+	mu       sync.RWMutex
+}
+
+func (r *backendRegistry) AddBackend(backend *Backend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byKey == nil {
+		r.byKey = make(map[string]*Backend)
+	}
+	r.backends = append(r.backends, backend)
+	if _, ok := r.byKey[backend.Key()]; !ok {
+		r.byKey[backend.Key()] = backend
+	}
+}
+
+func (r *backendRegistry) RemoveBackend(backend *Backend) {
+	r.mu.Lock()
+	removed := r.remove(backend.Key())
+	r.mu.Unlock()
+
+	r.removed(removed)
+}
+
+// OnRemove registers fn to be called with every backend removed from the
+// balancer, once no backend with its key is left
+func (r *backendRegistry) OnRemove(fn func(*Backend)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRemove = append(r.onRemove, fn)
+}
+
+// removed runs the OnRemove functions for a backend returned by remove, if
+// it was the last with its key. It is called without holding mu, so the
+// functions may take their own locks.
+func (r *backendRegistry) removed(backend *Backend) {
+	if backend == nil {
+		return
+	}
+
+	r.mu.RLock()
+	_, remaining := r.byKey[backend.Key()]
+	hooks := r.onRemove
+	r.mu.RUnlock()
+
+	if remaining {
+		return
+	}
+	for _, fn := range hooks {
+		fn(backend)
+	}
+}
+
+// remove deletes the backend with the given key, returning it, or nil if
+// there is none; the caller must hold mu
+func (r *backendRegistry) remove(key string) *Backend {
+	backend, ok := r.byKey[key]
+	if !ok {
+		return nil
+	}
+
+	for i, b := range r.backends {
+		if b == backend {
+			r.backends = append(r.backends[:i], r.backends[i+1:]...)
+			break
+		}
+	}
+
+	// Fall back to a later backend with the same key, as a scan would find it
+	delete(r.byKey, key)
+	for _, b := range r.backends {
+		if b.Key() == key {
+			r.byKey[key] = b
+			break
+		}
+	}
+	return backend
+}
+
+func (r *backendRegistry) GetBackends() []*Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	backends := make([]*Backend, len(r.backends))
+	copy(backends, r.backends)
+	return backends
+}
+
+func (r *backendRegistry) GetBackend(idOrURL string) *Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// IDs are matched first, since a backend whose URL changed keeps its old URL as ID
+	if backend, ok := r.byKey[idOrURL]; ok {
+		return backend
+	}
+	for _, b := range r.backends {
+		if b.URL.String() == idOrURL {
+			return b
+		}
+	}
+	return nil
+}
+
+func (r *backendRegistry) UpdateBackendStatus(backend *Backend, alive bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.byKey[backend.Key()]; ok {
+		b.setAlive(alive)
+	}
+}
+
+func (r *backendRegistry) UpdateBackendReady(backend *Backend, ready bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.byKey[backend.Key()]; ok {
+		b.setReady(ready)
+	}
+}
+
+func (r *backendRegistry) UpdateBackendDraining(backend *Backend, draining bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.byKey[backend.Key()]; ok {
+		b.Draining = draining
+	}
+}
+
+// UpdateBackend keeps the backend under the same key: setURL pins the key
+// to the old URL when the backend has no ID
+func (r *backendRegistry) UpdateBackend(backend *Backend, backendURL *url.URL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.byKey[backend.Key()]; ok {
+		b.setURL(backendURL)
+	}
+}
+
+func (r *backendRegistry) UpdateBackendSettings(backend *Backend, settings BackendSettings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.byKey[backend.Key()]; ok {
+		b.applySettings(settings)
+	}
+}
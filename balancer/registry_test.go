@@ -0,0 +1,47 @@
+package balancer
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUpdateBackendSchemeChange(t *testing.T) {
+	lb := NewRoundRobinBalancer()
+	backends := newTestBackends(2)
+	addBackends(lb, backends)
+	backend := backends[0]
+	oldURL := backend.URL.String()
+
+	backend.SuccessCount, backend.ErrorCount = 7, 2
+	backend.HealthSuccessCount, backend.HealthFailCount = 4, 1
+	lb.UpdateBackendStatus(backend, false)
+
+	httpsURL, _ := url.Parse("https://10.0.0.1:8443")
+	lb.UpdateBackend(backend, httpsURL)
+
+	// The backend is still found by its old URL, now its ID, and by the new one
+	for _, idOrURL := range []string{oldURL, httpsURL.String()} {
+		if got := lb.GetBackend(idOrURL); got != backend {
+			t.Errorf("GetBackend(%s) = %v, want the updated backend", idOrURL, got)
+		}
+	}
+	if backend.URL != httpsURL || len(lb.GetBackends()) != 2 {
+		t.Fatalf("got URL %s among %d backends, want %s among 2", backend.URL, len(lb.GetBackends()), httpsURL)
+	}
+
+	// Health state and stats carry over
+	if backend.Alive || backend.SuccessCount != 7 || backend.ErrorCount != 2 || backend.HealthSuccessCount != 4 || backend.HealthFailCount != 1 {
+		t.Errorf("got alive %v, %d/%d requests and %d/%d checks after the update, want false, 7/2 and 4/1",
+			backend.Alive, backend.SuccessCount, backend.ErrorCount, backend.HealthSuccessCount, backend.HealthFailCount)
+	}
+
+	// Later updates by the backend still reach it
+	lb.UpdateBackendStatus(backend, true)
+	if !backend.Alive {
+		t.Error("status update after the URL change was lost")
+	}
+	lb.RemoveBackend(backend)
+	if remaining := lb.GetBackends(); len(remaining) != 1 || remaining[0] != backends[1] {
+		t.Errorf("got %d backends after removing the updated one, want only %s", len(remaining), backends[1].URL)
+	}
+}
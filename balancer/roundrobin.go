@@ -2,80 +2,64 @@ package balancer
 
 import (
 	"net/http"
-	"sync"
 	"sync/atomic"
 )
 
 type RoundRobinBalancer struct {
-	backends []*Backend
-	current  uint64
-	mu       sync.RWMutex
+	backendRegistry
+	current uint64
 }
 
 func NewRoundRobinBalancer() *RoundRobinBalancer {
-	return &RoundRobinBalancer{
-		backends: make([]*Backend, 0),
-	}
+	return &RoundRobinBalancer{}
 }
 
+// SelectBackend returns the first alive backend at or after the next position
+// in the rotation, starting with index 0. Rotation walks positions in the full
+// backend list rather than indexing into the alive subset, so when backends
+// flap the order doesn't shift and every alive backend still receives one
+// request per cycle. The stored position never exceeds len(backends), so the
+// counter cannot overflow.
+//
+// The selected backend's connection is counted as part of the selection,
+// so concurrent requests can't push a backend past its MaxConnections cap.
 func (rb *RoundRobinBalancer) SelectBackend(request *http.Request) *Backend {
 	rb.mu.RLock()
 	defer rb.mu.RUnlock()
 
-	if len(rb.backends) == 0 {
+	count := uint64(len(rb.backends))
+	if count == 0 {
 		return nil
 	}
 
-	aliveBackends := make([]*Backend, 0)
-	for _, backend := range rb.backends {
-		if backend.Alive {
-			aliveBackends = append(aliveBackends, backend)
+	candidates := newCandidates(request, rb.backends)
+	for {
+		next := atomic.LoadUint64(&rb.current)
+		selected := -1
+		for step := uint64(0); step < count; step++ {
+			index := (next + step) % count
+			if candidates.has(rb.backends[index]) {
+				selected = int(index)
+				break
+			}
 		}
-	}
-
-	if len(aliveBackends) == 0 {
-		return nil
-	}
 
-	index := atomic.AddUint64(&rb.current, 1) % uint64(len(aliveBackends))
-	return aliveBackends[index]
-}
-
-func (rb *RoundRobinBalancer) AddBackend(backend *Backend) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.backends = append(rb.backends, backend)
-}
+		if selected == -1 {
+			return nil
+		}
 
-func (rb *RoundRobinBalancer) RemoveBackend(backend *Backend) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
+		// Another request may have advanced the position concurrently; retry from there
+		if !atomic.CompareAndSwapUint64(&rb.current, next, uint64(selected)+1) {
+			continue
+		}
 
-	for i, b := range rb.backends {
-		if b.URL.String() == backend.URL.String() {
-			rb.backends = append(rb.backends[:i], rb.backends[i+1:]...)
-			break
+		// Another request may have filled the backend up to its cap since the scan
+		if rb.backends[selected].ReserveConnection() {
+			return rb.backends[selected]
 		}
 	}
 }
 
-func (rb *RoundRobinBalancer) GetBackends() []*Backend {
-	rb.mu.RLock()
-	defer rb.mu.RUnlock()
-
-	backends := make([]*Backend, len(rb.backends))
-	copy(backends, rb.backends)
-	return backends
-}
-
-func (rb *RoundRobinBalancer) UpdateBackendStatus(backend *Backend, alive bool) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-
-	for _, b := range rb.backends {
-		if b.URL.String() == backend.URL.String() {
-			b.Alive = alive
-			break
-		}
-	}
+func (rb *RoundRobinBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
 }
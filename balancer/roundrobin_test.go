@@ -0,0 +1,122 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestBackends returns n alive, ready backends with weight 1
+func newTestBackends(n int) []*Backend {
+	backends := make([]*Backend, n)
+	for i := range backends {
+		backendURL, _ := url.Parse(fmt.Sprintf("http://10.0.0.%d:8080", i+1))
+		backends[i] = &Backend{URL: backendURL, Alive: true, Ready: true, Weight: 1}
+	}
+	return backends
+}
+
+// addBackends adds backends to a balancer
+func addBackends(lb LoadBalancer, backends []*Backend) {
+	for _, backend := range backends {
+		lb.AddBackend(backend)
+	}
+}
+
+func TestRoundRobinMaxConnectionsUnderConcurrency(t *testing.T) {
+	rb := NewRoundRobinBalancer()
+	backends := newTestBackends(2)
+	for _, backend := range backends {
+		backend.MaxConnections = 5
+	}
+	addBackends(rb, backends)
+
+	// Selections hold their connection, so only the first ten can succeed
+	request, _ := http.NewRequest("GET", "/", nil)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	selected := 0
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rb.SelectBackend(request) != nil {
+				mu.Lock()
+				selected++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if selected != 10 {
+		t.Errorf("got %d selections, want 10", selected)
+	}
+	for _, backend := range backends {
+		if backend.Connections != 5 {
+			t.Errorf("backend %s has %d connections, want its cap of 5", backend.URL, backend.Connections)
+		}
+	}
+
+	rb.DecrementConnections(backends[1])
+	if backend := rb.SelectBackend(request); backend != backends[1] {
+		t.Errorf("got %v after a connection was released, want %s", backend, backends[1].URL)
+	}
+}
+
+func TestRoundRobinEvenDistribution(t *testing.T) {
+	rb := NewRoundRobinBalancer()
+	backends := newTestBackends(3)
+	addBackends(rb, backends)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if first := rb.SelectBackend(request); first != backends[0] {
+		t.Fatalf("first request went to %s, want %s", first.URL, backends[0].URL)
+	}
+
+	counts := map[*Backend]int{backends[0]: 1}
+	for range 599 {
+		backend := rb.SelectBackend(request)
+		counts[backend]++
+		rb.DecrementConnections(backend)
+	}
+	for _, backend := range backends {
+		if got := counts[backend]; got < 198 || got > 202 {
+			t.Errorf("backend %s got %d of 600 requests, want 200 ± 2", backend.URL, got)
+		}
+	}
+}
+
+func TestRoundRobinDistributionWhileFlapping(t *testing.T) {
+	rb := NewRoundRobinBalancer()
+	backends := newTestBackends(3)
+	addBackends(rb, backends)
+	flapping := backends[2]
+
+	// The third backend is down for every other block of 50 requests: the
+	// others should each get half of those and a third of the rest
+	request, _ := http.NewRequest("GET", "/", nil)
+	counts := make(map[*Backend]int)
+	for i := range 600 {
+		if i%50 == 0 {
+			rb.UpdateBackendStatus(flapping, (i/50)%2 == 1)
+		}
+		backend := rb.SelectBackend(request)
+		counts[backend]++
+		rb.DecrementConnections(backend)
+
+		if position := atomic.LoadUint64(&rb.current); position > uint64(len(backends)) {
+			t.Fatalf("rotation position is %d after request %d, want at most %d", position, i, len(backends))
+		}
+	}
+
+	want := map[*Backend]int{backends[0]: 250, backends[1]: 250, flapping: 100}
+	for backend, n := range want {
+		if got := counts[backend]; got < n-3 || got > n+3 {
+			t.Errorf("backend %s got %d of 600 requests, want %d ± 3", backend.URL, got, n)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package balancer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// slowStartScale multiplies weights during slow start, so that a recovering
+// backend's share can grow in small steps even when its weight is 1
+const slowStartScale = 100
+
+// setAlive updates the backend's status, recording when it comes back up
+func (b *Backend) setAlive(alive bool) {
+	if alive && !b.Alive {
+		atomic.StoreInt64(&b.RecoveredAt, time.Now().UnixNano())
+	}
+	b.Alive = alive
+}
+
+// setReady updates whether the backend is ready; one that becomes ready
+// again is ramped up like one coming back up
+func (b *Backend) setReady(ready bool) {
+	if ready && !b.Ready && b.Alive {
+		atomic.StoreInt64(&b.RecoveredAt, time.Now().UnixNano())
+	}
+	b.Ready = ready
+}
+
+// slowStartWeight scales weight by slowStartScale and, while the backend is
+// within slowStart of coming back up, ramps it linearly from near zero
+func slowStartWeight(b *Backend, weight int, slowStart time.Duration, now time.Time) int {
+	scaled := weight * slowStartScale
+
+	recoveredAt := atomic.LoadInt64(&b.RecoveredAt)
+	if recoveredAt == 0 || scaled <= 0 {
+		return scaled
+	}
+
+	elapsed := now.Sub(time.Unix(0, recoveredAt))
+	if elapsed >= slowStart {
+		return scaled
+	}
+	return max(int(int64(scaled)*int64(elapsed)/int64(slowStart)), 1)
+}
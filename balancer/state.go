@@ -0,0 +1,98 @@
+package balancer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStaleState is returned by LoadState when the snapshot is older than the allowed age
+var ErrStaleState = errors.New("backend state snapshot is stale")
+
+// BackendState is the persisted health state of a backend
+type BackendState struct {
+	URL          string `json:"url"`
+	Alive        bool   `json:"alive"`
+	SuccessCount int32  `json:"success_count"`
+	ErrorCount   int32  `json:"error_count"`
+}
+
+// stateSnapshot is the on-disk format of a state file
+type stateSnapshot struct {
+	SavedAt  time.Time      `json:"saved_at"`
+	Backends []BackendState `json:"backends"`
+}
+
+// SaveState writes the health state of the given backends to path.
+// The file is replaced atomically so a crash never leaves a partial snapshot.
+func SaveState(path string, backends []*Backend) error {
+	snapshot := stateSnapshot{SavedAt: time.Now()}
+	for _, backend := range backends {
+		snapshot.Backends = append(snapshot.Backends, BackendState{
+			URL:          backend.URL.String(),
+			Alive:        backend.Alive,
+			SuccessCount: atomic.LoadInt32(&backend.SuccessCount),
+			ErrorCount:   atomic.LoadInt32(&backend.ErrorCount),
+		})
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadState reads a state file written by SaveState, keyed by backend URL.
+// Snapshots older than maxAge are rejected with ErrStaleState.
+func LoadState(path string, maxAge time.Duration) (map[string]BackendState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot stateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+
+	if maxAge > 0 && time.Since(snapshot.SavedAt) > maxAge {
+		return nil, ErrStaleState
+	}
+
+	states := make(map[string]BackendState, len(snapshot.Backends))
+	for _, state := range snapshot.Backends {
+		states[state.URL] = state
+	}
+	return states, nil
+}
+
+// RestoreState applies a loaded state to a backend, returning false if none was saved for it
+func RestoreState(backend *Backend, states map[string]BackendState) bool {
+	state, ok := states[backend.URL.String()]
+	if !ok {
+		return false
+	}
+
+	backend.Alive = state.Alive
+	atomic.StoreInt32(&backend.SuccessCount, state.SuccessCount)
+	atomic.StoreInt32(&backend.ErrorCount, state.ErrorCount)
+	return true
+}
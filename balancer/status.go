@@ -0,0 +1,85 @@
+package balancer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange is an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// StatusSet is a set of accepted HTTP status codes. An empty set accepts any 2xx status.
+type StatusSet []StatusRange
+
+// ParseStatusSet parses a comma-separated list of status codes and ranges,
+// such as "200,204" or "200-299,301". An empty string yields an empty set.
+func ParseStatusSet(spec string) (StatusSet, error) {
+	var set StatusSet
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+
+		minCode, err := parseStatusCode(low)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q: %v", part, err)
+		}
+		maxCode, err := parseStatusCode(high)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q: %v", part, err)
+		}
+		if minCode > maxCode {
+			return nil, fmt.Errorf("invalid status %q: range is reversed", part)
+		}
+
+		set = append(set, StatusRange{Min: minCode, Max: maxCode})
+	}
+	return set, nil
+}
+
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("status codes must be between 100 and 599")
+	}
+	return code, nil
+}
+
+// Contains reports whether the set accepts a status code
+func (ss StatusSet) Contains(code int) bool {
+	if len(ss) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, r := range ss {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the set in the form accepted by ParseStatusSet
+func (ss StatusSet) String() string {
+	if len(ss) == 0 {
+		return "200-299"
+	}
+	parts := make([]string, len(ss))
+	for i, r := range ss {
+		if r.Min == r.Max {
+			parts[i] = strconv.Itoa(r.Min)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.Min, r.Max)
+		}
+	}
+	return strings.Join(parts, ",")
+}
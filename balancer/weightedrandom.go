@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+type WeightedRandomBalancer struct {
+	backendRegistry
+	slowStart time.Duration
+}
+
+// NewWeightedRandomBalancer creates a weighted random balancer. With a
+// positive slowStart, a backend that comes back up gets a weight ramping
+// linearly from near zero to its full weight over that duration.
+func NewWeightedRandomBalancer(slowStart time.Duration) *WeightedRandomBalancer {
+	return &WeightedRandomBalancer{slowStart: slowStart}
+}
+
+// SelectBackend picks a random alive backend with probability proportional
+// to its weight, by searching the cumulative weights of the alive backends.
+// Unlike weighted round-robin it keeps no state between requests, so short
+// runs can be uneven. Backends with weight 0 only receive requests when no
+// alive backend has a positive weight, in which case the pick is uniform.
+// The selected backend's connection is counted as part of the selection.
+func (wr *WeightedRandomBalancer) SelectBackend(request *http.Request) *Backend {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	candidates := newCandidates(request, wr.backends)
+	for {
+		selected := wr.draw(candidates)
+
+		// Another request may have filled the backend up to its cap since the draw
+		if selected == nil || selected.ReserveConnection() {
+			return selected
+		}
+	}
+}
+
+// draw picks a random candidate by weight, or nil if there is none. Callers
+// must hold at least a read lock.
+func (wr *WeightedRandomBalancer) draw(candidates candidateSet) *Backend {
+	now := time.Now()
+	selectable := make([]*Backend, 0, len(wr.backends))
+	cumulative := make([]int, 0, len(wr.backends))
+	total := 0
+	for _, backend := range wr.backends {
+		if !candidates.has(backend) {
+			continue
+		}
+		total += wr.weightOf(backend, now)
+		selectable = append(selectable, backend)
+		cumulative = append(cumulative, total)
+	}
+
+	if len(selectable) == 0 {
+		return nil
+	}
+	if total == 0 {
+		return selectable[rand.IntN(len(selectable))]
+	}
+
+	// The first backend whose cumulative weight exceeds the draw; zero
+	// weights add no range of their own and are never found
+	index, _ := slices.BinarySearch(cumulative, rand.IntN(total)+1)
+	return selectable[index]
+}
+
+func (wr *WeightedRandomBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
+}
+
+// weightOf returns a backend's weight for the draw, ramped up during slow start
+func (wr *WeightedRandomBalancer) weightOf(b *Backend, now time.Time) int {
+	weight := max(b.Weight, 0)
+	if wr.slowStart <= 0 {
+		return weight
+	}
+	return slowStartWeight(b, weight, wr.slowStart, now)
+}
@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// selectionCounts makes n selections and counts how many went to each backend
+func selectionCounts(lb LoadBalancer, n int) map[*Backend]int {
+	request, _ := http.NewRequest("GET", "/", nil)
+	counts := make(map[*Backend]int)
+	for range n {
+		counts[lb.SelectBackend(request)]++
+	}
+	return counts
+}
+
+func TestWeightedRandomDistribution(t *testing.T) {
+	wr := NewWeightedRandomBalancer(0)
+	backends := newTestBackends(4)
+	for i, backend := range backends {
+		backend.Weight = []int{1, 2, 3, 0}[i]
+	}
+	addBackends(wr, backends)
+
+	// Within 10% of each expected share; random draws are off by about 1%
+	counts := selectionCounts(wr, 60000)
+	for i, want := range []int{10000, 20000, 30000, 0} {
+		if got := counts[backends[i]]; got < want*9/10 || got > want*11/10 {
+			t.Errorf("backend %s with weight %d got %d of 60000 requests, want about %d",
+				backends[i].URL, backends[i].Weight, got, want)
+		}
+	}
+}
+
+func TestWeightedRandomAllWeightsZero(t *testing.T) {
+	wr := NewWeightedRandomBalancer(0)
+	backends := newTestBackends(3)
+	for _, backend := range backends {
+		backend.Weight = 0
+	}
+	addBackends(wr, backends)
+
+	// Backends are still used, uniformly
+	counts := selectionCounts(wr, 30000)
+	for _, backend := range backends {
+		if got := counts[backend]; got < 9000 || got > 11000 {
+			t.Errorf("backend %s got %d of 30000 requests, want about 10000", backend.URL, got)
+		}
+	}
+	if counts[nil] != 0 {
+		t.Errorf("got no backend for %d requests", counts[nil])
+	}
+}
+
+func TestWeightedRandomSlowStart(t *testing.T) {
+	wr := NewWeightedRandomBalancer(time.Minute)
+	backends := newTestBackends(2)
+	addBackends(wr, backends)
+
+	// A quarter into slow start, the recovered backend weighs 0.25 against 1
+	backends[1].RecoveredAt = time.Now().Add(-15 * time.Second).UnixNano()
+	counts := selectionCounts(wr, 50000)
+	if got := counts[backends[1]]; got < 9000 || got > 11000 {
+		t.Errorf("recovering backend got %d of 50000 requests, want about 10000", got)
+	}
+
+	// Once slow start is over it gets its full share
+	backends[1].RecoveredAt = time.Now().Add(-2 * time.Minute).UnixNano()
+	counts = selectionCounts(wr, 50000)
+	if got := counts[backends[1]]; got < 22500 || got > 27500 {
+		t.Errorf("recovered backend got %d of 50000 requests, want about 25000", got)
+	}
+}
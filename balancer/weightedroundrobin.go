@@ -0,0 +1,105 @@
+package balancer
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WeightedRoundRobinBalancer distributes requests in proportion to backend
+// weights using smooth weighted round-robin, which interleaves picks instead
+// of sending a burst of consecutive requests to the heaviest backend
+type WeightedRoundRobinBalancer struct {
+	backendRegistry
+	currentWeights map[*Backend]int
+	slowStart      time.Duration
+}
+
+// NewWeightedRoundRobinBalancer creates a weighted round-robin balancer. With
+// a positive slowStart, a backend that comes back up gets a weight ramping
+// linearly from near zero to its full weight over that duration.
+func NewWeightedRoundRobinBalancer(slowStart time.Duration) *WeightedRoundRobinBalancer {
+	return &WeightedRoundRobinBalancer{
+		currentWeights: make(map[*Backend]int),
+		slowStart:      slowStart,
+	}
+}
+
+// SelectBackend picks the alive backend with the highest current weight.
+// Backends with weight 0 are only used when no alive backend has a positive weight.
+// The selected backend's connection is counted as part of the selection.
+func (wrr *WeightedRoundRobinBalancer) SelectBackend(request *http.Request) *Backend {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	if len(wrr.backends) == 0 {
+		return nil
+	}
+
+	candidates := newCandidates(request, wrr.backends)
+	for {
+		selected := wrr.selectWeighted(candidates, wrr.weightOf(func(b *Backend) int { return b.Weight }))
+		if selected == nil {
+			selected = wrr.selectWeighted(candidates, wrr.weightOf(func(b *Backend) int { return 1 }))
+		}
+
+		// Another request may have filled the backend up to its cap since the scan
+		if selected == nil || selected.ReserveConnection() {
+			return selected
+		}
+	}
+}
+
+func (wrr *WeightedRoundRobinBalancer) DecrementConnections(backend *Backend) {
+	atomic.AddInt32(&backend.Connections, -1)
+}
+
+// weightOf applies slow start, if enabled, to the weights returned by weight
+func (wrr *WeightedRoundRobinBalancer) weightOf(weight func(*Backend) int) func(*Backend) int {
+	if wrr.slowStart <= 0 {
+		return weight
+	}
+
+	now := time.Now()
+	return func(b *Backend) int {
+		return slowStartWeight(b, weight(b), wrr.slowStart, now)
+	}
+}
+
+// selectWeighted runs one round of smooth weighted round-robin over selectable
+// backends with a positive weight as returned by weightOf
+func (wrr *WeightedRoundRobinBalancer) selectWeighted(candidates candidateSet, weightOf func(*Backend) int) *Backend {
+	var selected *Backend
+	totalWeight := 0
+
+	for _, backend := range wrr.backends {
+		weight := weightOf(backend)
+		if weight <= 0 || !candidates.has(backend) {
+			continue
+		}
+
+		wrr.currentWeights[backend] += weight
+		totalWeight += weight
+
+		if selected == nil || wrr.currentWeights[backend] > wrr.currentWeights[selected] {
+			selected = backend
+		}
+	}
+
+	if selected != nil {
+		wrr.currentWeights[selected] -= totalWeight
+	}
+	return selected
+}
+
+// RemoveBackend also forgets the backend's current weight
+func (wrr *WeightedRoundRobinBalancer) RemoveBackend(backend *Backend) {
+	wrr.mu.Lock()
+	removed := wrr.remove(backend.Key())
+	if removed != nil {
+		delete(wrr.currentWeights, removed)
+	}
+	wrr.mu.Unlock()
+
+	wrr.removed(removed)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"go-load-balancer/balancer"
+	"sort"
+	"strings"
+	"time"
+)
+
+// printConfigSummary prints the main settings of a validated configuration
+// for -check-config, so a reviewer can see how the flags and config file
+// were understood
+func printConfigSummary(config *Config) {
+	fmt.Println("Configuration OK")
+	if config.ConfigFile != "" {
+		fmt.Printf("  Config file:   %s\n", config.ConfigFile)
+	}
+	fmt.Printf("  Listen:        :%s (%s)\n", config.Port, config.Mode)
+	fmt.Printf("  Algorithm:     %s\n", config.Algorithm)
+
+	if config.BackendsDNS != "" {
+		fmt.Printf("  Backends:      resolved from %s every %v\n", config.BackendsDNS, config.BackendsDNSInterval)
+	} else {
+		fmt.Printf("  Backends:      %d\n", len(config.Backends))
+		printBackendSpecs(config.Backends)
+	}
+
+	poolSpecs, _ := parsePools(config.Pools)
+	names := make([]string, 0, len(poolSpecs))
+	for name := range poolSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  Pool:          %s\n", name)
+		printBackendSpecs(poolSpecs[name])
+	}
+	if config.Routes != "" {
+		fmt.Printf("  Routes:        %s\n", config.Routes)
+	}
+	if config.HostRoutes != "" {
+		fmt.Printf("  Host routes:   %s\n", config.HostRoutes)
+	}
+
+	if config.Mode == "tcp" {
+		fmt.Printf("  Health checks: TCP connect every %v, timeout %v\n", config.HealthCheckInterval, config.HealthCheckTimeout)
+	} else {
+		fmt.Printf("  Health checks: %s %s every %v, timeout %v\n",
+			config.HealthMethod, config.HealthPath, config.HealthCheckInterval, config.HealthCheckTimeout)
+	}
+	fmt.Printf("  Timeouts:      proxy %s, read %s, write %s, idle %s, shutdown %s\n",
+		timeoutLimit(config.ProxyTimeout), timeoutLimit(config.ReadTimeout), timeoutLimit(config.WriteTimeout),
+		timeoutLimit(config.IdleTimeout), timeoutLimit(config.ShutdownTimeout))
+}
+
+// checkBackends runs the startup check for -check-config -startup-check,
+// probing every backend of the configuration without starting health checks
+// or serving. It prints each diagnosis and reports whether all backends
+// passed.
+func checkBackends(config *Config) bool {
+	loadBalancer, _ := createLoadBalancer(config)
+	addBackendSpecs(loadBalancer, config.Backends)
+	if config.BackendsDNS != "" {
+		template, _ := parseBackendsDNS(config.BackendsDNS, config.Mode)
+		backends, err := resolveBackends(template)
+		if err != nil {
+			fmt.Printf("Startup check failed: resolving %s: %v\n", template.URL.Hostname(), err)
+			return false
+		}
+		for _, backend := range backends {
+			loadBalancer.AddBackend(backend)
+		}
+	}
+
+	poolSpecs, _ := parsePools(config.Pools)
+	pools := make(map[string]balancer.LoadBalancer)
+	for name, specs := range poolSpecs {
+		pools[name], _ = createLoadBalancer(config)
+		addBackendSpecs(pools[name], specs)
+	}
+
+	backendTLS, err := backendTLSConfig(config)
+	if err != nil {
+		fmt.Printf("Startup check failed: %v\n", err)
+		return false
+	}
+	diagnoses := newHealthChecker(config, loadBalancer, pools, backendTLS).DiagnoseAll()
+
+	fmt.Println("Startup check")
+	healthy := 0
+	for _, diagnosis := range diagnoses {
+		if diagnosis.Healthy() {
+			healthy++
+		}
+		fmt.Printf("  %s: %s\n", diagnosis.Backend.URL.String(), diagnosis.Diagnosis)
+	}
+	fmt.Printf("  %d/%d backends healthy\n", healthy, len(diagnoses))
+	return healthy == len(diagnoses)
+}
+
+// addBackendSpecs adds the backends of validated specs to a balancer
+func addBackendSpecs(lb balancer.LoadBalancer, specs []string) {
+	for _, spec := range specs {
+		if backend, err := parseBackendSpec(spec); err == nil {
+			lb.AddBackend(backend)
+		}
+	}
+}
+
+// printBackendSpecs prints one line per backend with its attributes
+func printBackendSpecs(specs []string) {
+	for _, spec := range specs {
+		backend, err := parseBackendSpec(spec)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("    %s\n", describeBackend(backend))
+	}
+}
+
+// describeBackend formats a backend's URL and the attributes set on it
+func describeBackend(backend *balancer.Backend) string {
+	attrs := []string{fmt.Sprintf("weight %d", backend.Weight)}
+	if backend.Name != "" {
+		attrs = append(attrs, "name "+backend.Name)
+	}
+	if backend.Priority > 0 {
+		attrs = append(attrs, fmt.Sprintf("priority %d", backend.Priority))
+	}
+	if backend.MaxConnections > 0 {
+		attrs = append(attrs, fmt.Sprintf("max connections %d", backend.MaxConnections))
+	}
+	if backend.Health.Path != "" {
+		attrs = append(attrs, "health path "+backend.Health.Path)
+	}
+	if backend.Health.Timeout > 0 {
+		attrs = append(attrs, fmt.Sprintf("health timeout %v", backend.Health.Timeout))
+	}
+	if len(backend.Health.ExpectStatus) > 0 {
+		attrs = append(attrs, "health status "+backend.Health.ExpectStatus.String())
+	}
+	return backend.URL.String() + " (" + strings.Join(attrs, ", ") + ")"
+}
+
+// timeoutLimit formats a timeout where 0 means no limit
+func timeoutLimit(d time.Duration) string {
+	if d == 0 {
+		return "none"
+	}
+	return d.String()
+}
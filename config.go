@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listSeparators maps flags whose config file value may be a list to the
+// separator their flag syntax uses; other list-valued flags use commas
+var listSeparators = map[string]string{
+	"cache-control":           ";",
+	"routes":                  ";",
+	"pool-path-normalization": ";",
+	"request-headers":         ";",
+	"response-headers":        ";",
+}
+
+// configBackend is a backend entry in a config file
+type configBackend struct {
+	URL            string        `json:"url"`
+	Weight         *int          `json:"weight"`
+	Name           string        `json:"name"`
+	MaxConnections *int          `json:"max_connections"`
+	Priority       *int          `json:"priority"`
+	Health         *configHealth `json:"health"`
+}
+
+// configHealth holds the health check overrides of a config file backend
+type configHealth struct {
+	Path         string `json:"path"`
+	Timeout      string `json:"timeout"`
+	ExpectStatus string `json:"expect_status"`
+}
+
+// configRoute is a path route entry in a config file
+type configRoute struct {
+	Match string `json:"match"`
+	Pool  string `json:"pool"`
+}
+
+// configHeaderRule is a header rule entry in a config file
+type configHeaderRule struct {
+	Op    string  `json:"op"`
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+}
+
+// configSetting is a config file setting converted to its flag's syntax
+type configSetting struct {
+	name  string
+	value string
+	pos   string // line and column in the file, for error messages
+}
+
+// loadConfigFile applies settings from a JSON config file. Keys are flag
+// names without the leading dash and values use the same syntax as the flags,
+// except that lists may be given as JSON arrays, backends, (host) routes and
+// header rules as objects and pools as an object of backend lists keyed by
+// pool name.
+// Flags set on the command line take precedence over the file.
+func loadConfigFile(path string) error {
+	settings, err := readConfigFile(path, setOnCommandLine())
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range settings {
+		if err := flag.Lookup(setting.name).Value.Set(setting.value); err != nil {
+			return fmt.Errorf("%s:%s: invalid value %q for %s: %v", path, setting.pos, setting.value, setting.name, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile reads the settings in a JSON config file, converted to flag
+// syntax, leaving out those named in skip
+func readConfigFile(path string, skip map[string]bool) ([]configSetting, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("%s: YAML config files are not supported, use JSON", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("%s:%s: config file must contain a JSON object", path, position(data, err, 0))
+	}
+
+	var settings []configSetting
+	for decoder.More() {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s: %v", path, position(data, err, offset), err)
+		}
+		name := token.(string)
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%s:%s: %s: %v", path, position(data, err, offset), name, err)
+		}
+
+		f := flag.Lookup(name)
+		if f == nil || name == "config" || name == "help" {
+			return nil, fmt.Errorf("%s:%s: unknown setting %q", path, position(data, nil, offset), name)
+		}
+		if skip[name] {
+			continue
+		}
+
+		value, err := configValue(name, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s: %s: %v", path, position(data, nil, offset), name, err)
+		}
+		settings = append(settings, configSetting{name: name, value: value, pos: position(data, nil, offset)})
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("%s:%s: %v", path, position(data, err, decoder.InputOffset()), err)
+	}
+	return settings, nil
+}
+
+// setOnCommandLine returns the names of the flags set on the command line
+func setOnCommandLine() map[string]bool {
+	names := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		names[f.Name] = true
+	})
+	return names
+}
+
+// configValue converts a config file value to the flag's string syntax
+func configValue(name string, raw json.RawMessage) (string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return scalarValue(name, raw)
+	}
+
+	separator, ok := listSeparators[name]
+	if !ok {
+		separator = ","
+	}
+
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		value, err := scalarValue(name, item)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, separator), nil
+}
+
+// scalarValue converts a single JSON value to the flag's string syntax
+func scalarValue(name string, raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		return "", errors.New("value must not be null")
+	case raw[0] == '"':
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case raw[0] == '{' && name == "backends":
+		return backendValue(raw)
+	case raw[0] == '{' && (name == "routes" || name == "host-routes"):
+		return routeValue(raw)
+	case raw[0] == '{' && (name == "request-headers" || name == "response-headers"):
+		return headerRuleValue(raw)
+	case raw[0] == '{' && name == "pools":
+		return poolsValue(raw)
+	case raw[0] == '{' || raw[0] == '[':
+		return "", errors.New("unexpected nested value")
+	default:
+		// Numbers and booleans use their JSON text
+		return string(raw), nil
+	}
+}
+
+// backendValue converts a backend object to the
+// <url>|<weight>|name=<name>|max-connections=<n>|priority=<n>|health-...=<value> flag syntax
+func backendValue(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var backend configBackend
+	if err := decoder.Decode(&backend); err != nil {
+		return "", fmt.Errorf("invalid backend: %v", err)
+	}
+	if backend.URL == "" {
+		return "", errors.New("backend is missing url")
+	}
+
+	value := backend.URL
+	if backend.Weight != nil {
+		value += "|" + strconv.Itoa(*backend.Weight)
+	}
+	if backend.Name != "" {
+		if strings.ContainsAny(backend.Name, "|,;") {
+			return "", errors.New("backend name must not contain |, commas or semicolons")
+		}
+		value += "|name=" + backend.Name
+	}
+	if backend.MaxConnections != nil {
+		value += "|max-connections=" + strconv.Itoa(*backend.MaxConnections)
+	}
+	if backend.Priority != nil {
+		value += "|priority=" + strconv.Itoa(*backend.Priority)
+	}
+	if health := backend.Health; health != nil {
+		if strings.ContainsAny(health.Path+health.Timeout, "|,;") || strings.ContainsAny(health.ExpectStatus, "|;") {
+			return "", errors.New("backend health settings must not contain | or semicolons, nor commas outside expect_status")
+		}
+		if health.Path != "" {
+			value += "|health-path=" + health.Path
+		}
+		if health.Timeout != "" {
+			value += "|health-timeout=" + health.Timeout
+		}
+		if health.ExpectStatus != "" {
+			value += "|health-status=" + strings.Join(strings.FieldsFunc(health.ExpectStatus, func(r rune) bool { return r == ',' || r == ' ' }), " ")
+		}
+	}
+	return value, nil
+}
+
+// routeValue converts a route object to the <pattern>=<pool> flag syntax
+func routeValue(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var route configRoute
+	if err := decoder.Decode(&route); err != nil {
+		return "", fmt.Errorf("invalid route: %v", err)
+	}
+	if route.Match == "" || route.Pool == "" {
+		return "", errors.New("route needs both match and pool")
+	}
+	return route.Match + "=" + route.Pool, nil
+}
+
+// headerRuleValue converts a header rule object to the <op>:<name>[=<value>] flag syntax
+func headerRuleValue(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var rule configHeaderRule
+	if err := decoder.Decode(&rule); err != nil {
+		return "", fmt.Errorf("invalid header rule: %v", err)
+	}
+	if rule.Op == "" || rule.Name == "" {
+		return "", errors.New("header rule needs both op and name")
+	}
+
+	if rule.Value == nil {
+		return rule.Op + ":" + rule.Name, nil
+	}
+	if strings.Contains(*rule.Value, ";") {
+		return "", errors.New("header rule value must not contain a semicolon")
+	}
+	return rule.Op + ":" + rule.Name + "=" + *rule.Value, nil
+}
+
+// poolsValue converts an object of backend lists keyed by pool name to the
+// <name>=<backends>;... flag syntax
+func poolsValue(raw json.RawMessage) (string, error) {
+	var pools map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &pools); err != nil {
+		return "", fmt.Errorf("invalid pools: %v", err)
+	}
+
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(pools))
+	for _, name := range names {
+		backends, err := configValue("backends", pools[name])
+		if err != nil {
+			return "", fmt.Errorf("pool %s: %v", name, err)
+		}
+		values = append(values, name+"="+backends)
+	}
+	return strings.Join(values, ";"), nil
+}
+
+// position returns the line and column of a decoding error, or of the given
+// offset when the error carries none
+func position(data []byte, err error, offset int64) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	// Skip the separator and whitespace before a key
+	for offset < int64(len(data)) && strings.ContainsRune(", \t\r\n", rune(data[offset])) {
+		offset++
+	}
+
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := offset - int64(bytes.LastIndexByte(data[:offset], '\n'))
+	return fmt.Sprintf("%d:%d", line, column)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"go-load-balancer/proxy"
+	"testing"
+)
+
+func TestConfigValueLists(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"backends", `["http://localhost:3001", "http://localhost:3002"]`, "http://localhost:3001,http://localhost:3002"},
+		{"cache-control", `["/api/*=no-store", "/static/*=max-age=3600"]`, "/api/*=no-store;/static/*=max-age=3600"},
+		{"pool-path-normalization", `["api=strip,collapse", "static=add"]`, "api=strip,collapse;static=add"},
+	}
+	for _, tt := range tests {
+		got, err := configValue(tt.name, json.RawMessage(tt.raw))
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s: got %q, %v, want %q", tt.name, tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestConfigPoolPathNormalizationArray(t *testing.T) {
+	value, err := configValue("pool-path-normalization", json.RawMessage(`["api=strip,collapse","static=add"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalization, err := proxy.ParsePathNormalization(value)
+	if err != nil {
+		t.Fatalf("%q: %v", value, err)
+	}
+	want := map[string]proxy.PathNormalization{
+		"api":    {TrailingSlash: proxy.TrailingSlashStrip, CollapseSlashes: true},
+		"static": {TrailingSlash: proxy.TrailingSlashAdd},
+	}
+	if len(normalization) != len(want) || normalization["api"] != want["api"] || normalization["static"] != want["static"] {
+		t.Errorf("got %+v, want %+v", normalization, want)
+	}
+}
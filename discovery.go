@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-load-balancer/balancer"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// dnsLookupTimeout bounds each resolution of the -backends-dns name
+const dnsLookupTimeout = 10 * time.Second
+
+// parseBackendsDNS parses a -backends-dns spec, a backend spec whose host
+// name is resolved to one backend per address, e.g.
+// "http://api.default.svc.cluster.local:8080|max-connections=50"
+func parseBackendsDNS(spec string, mode string) (*balancer.Backend, error) {
+	template, err := parseBackendSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateBackendScheme(template.URL, mode); err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(template.URL.Hostname()); err == nil {
+		return nil, fmt.Errorf("%s is an IP address, not a DNS name", template.URL.Hostname())
+	}
+	// Resolved backends are addressed by IP, which HTTPS backends can't be
+	// verified against and would get as their Host header
+	if template.URL.Scheme == "https" {
+		return nil, fmt.Errorf("https backends can't be discovered, as they would be verified against and sent their IP address instead of %s", template.URL.Hostname())
+	}
+	return template, nil
+}
+
+// resolveBackends looks up the addresses of the template's host name and
+// returns a backend for each, sorted by address. Apart from the host, the
+// backends copy the template's URL and settings.
+func resolveBackends(template *balancer.Backend) ([]*balancer.Backend, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", template.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	addrs = slices.Compact(addrs)
+
+	backends := make([]*balancer.Backend, 0, len(addrs))
+	for _, addr := range addrs {
+		backendURL := *template.URL
+		backendURL.Host = addr.String()
+		if port := template.URL.Port(); port != "" {
+			backendURL.Host = net.JoinHostPort(addr.String(), port)
+		} else if addr.Is6() {
+			backendURL.Host = "[" + backendURL.Host + "]"
+		}
+
+		backends = append(backends, &balancer.Backend{
+			URL:            &backendURL,
+			ID:             backendURL.String(),
+			Weight:         template.Weight,
+			Name:           template.Name,
+			Priority:       template.Priority,
+			MaxConnections: template.MaxConnections,
+			Health:         template.Health,
+			Ready:          true,
+		})
+	}
+	return backends, nil
+}
+
+// refreshDNSBackends resolves the -backends-dns name and makes the balancer's
+// backends match the addresses. Addresses that persist keep their backend,
+// with its health state and connections. On a lookup error the current
+// backends are kept.
+func refreshDNSBackends(template *balancer.Backend, loadBalancer balancer.LoadBalancer, healthChecker balancer.HealthChecker) error {
+	backends, err := resolveBackends(template)
+	if err != nil {
+		return err
+	}
+
+	added, removed, _ := applyBackends(loadBalancer, backends, healthChecker)
+	if added > 0 || removed > 0 {
+		log.Printf("Resolved %s to %d addresses: %d backends added, %d removed",
+			template.URL.Hostname(), len(backends), added, removed)
+	}
+	return nil
+}
+
+// discoverBackends re-resolves the -backends-dns name every interval
+func discoverBackends(template *balancer.Backend, interval time.Duration, loadBalancer balancer.LoadBalancer, healthChecker balancer.HealthChecker) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := refreshDNSBackends(template, loadBalancer, healthChecker); err != nil {
+			log.Printf("Error resolving %s, keeping the current backends: %v", template.URL.Hostname(), err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestParseBackendsDNS(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"http://api.internal:8080|max-connections=50", false},
+		{"http://10.0.0.1:8080", true},
+		{"https://api.internal", true},
+	}
+	for _, tt := range tests {
+		_, err := parseBackendsDNS(tt.spec, "http")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBackendsDNS(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
@@ -33,6 +33,7 @@ type InfoResponse struct {
 	Server    string            `json:"server"`
 	Port      string            `json:"port"`
 	Method    string            `json:"method"`
+	Proto     string            `json:"proto"`
 	Path      string            `json:"path"`
 	Headers   map[string]string `json:"headers"`
 	Query     map[string]string `json:"query"`
@@ -45,6 +46,7 @@ func main() {
 	var (
 		port = flag.String("port", "3001", "Port to listen on")
 		name = flag.String("name", "", "Server name (default: backend-<port>)")
+		h2c  = flag.Bool("h2c", false, "Also accept unencrypted HTTP/2 (h2c)")
 	)
 	flag.Parse()
 
@@ -71,7 +73,16 @@ func main() {
 	log.Printf("Delay test: http://localhost:%s/delay/5s", server.port)
 	log.Printf("Error test: http://localhost:%s/error/500", server.port)
 
-	if err := http.ListenAndServe(":"+server.port, nil); err != nil {
+	httpServer := &http.Server{Addr: ":" + server.port}
+	if *h2c {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		httpServer.Protocols = protocols
+		log.Printf("Accepting unencrypted HTTP/2 (h2c)")
+	}
+
+	if err := httpServer.ListenAndServe(); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
@@ -175,6 +186,7 @@ func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 		Server:    s.name,
 		Port:      s.port,
 		Method:    r.Method,
+		Proto:     r.Proto,
 		Path:      r.URL.Path,
 		Headers:   headers,
 		Query:     query,
@@ -2,204 +2,1604 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"go-load-balancer/balancer"
 	"go-load-balancer/proxy"
+	"go-load-balancer/statsd"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
+// algorithms lists the supported load balancing algorithms
+var algorithms = []string{"round-robin", "weighted-round-robin", "least-connections", "ip-hash", "p2c", "least-response-time", "weighted-random"}
+
 type Config struct {
-	Port                string
-	Backends            []string
-	Algorithm           string
-	HealthCheckInterval time.Duration
-	HealthCheckTimeout  time.Duration
+	ConfigFile              string
+	Port                    string
+	Mode                    string
+	Backends                []string
+	AllowEmptyBackends      bool
+	BackendsDNS             string
+	BackendsDNSInterval     time.Duration
+	Pools                   string
+	Routes                  string
+	HostRoutes              string
+	Compression             bool
+	CompressionMinSize      int64
+	AlwaysFlush             bool
+	RejectUnknownHosts      bool
+	UnmatchedRoute          string
+	Algorithm               string
+	LeastConnTieBreak       string
+	SlowStart               time.Duration
+	IPHashFallback          string
+	IPHashRetry             string
+	AllowAlgorithmOverride  bool
+	TrustedProxies          string
+	HealthCheckInterval     time.Duration
+	HealthCheckTimeout      time.Duration
+	HealthJSONExpect        string
+	HealthBodyContains      string
+	HealthMaxBackoff        time.Duration
+	HealthConcurrency       int
+	HealthPath              string
+	HealthReadyPath         string
+	HealthMethod            string
+	HealthExpectStatus      string
+	HealthInsecure          bool
+	MinHealthy              string
+	PassiveFailures         int
+	PassiveWindow           time.Duration
+	OutlierErrorRate        float64
+	OutlierMinRequests      int
+	OutlierWindow           time.Duration
+	OutlierCooldown         time.Duration
+	DebugHeaders            bool
+	RequestIDHeader         string
+	ServedByHeader          string
+	AdminToken              string
+	DecisionLogSize         int
+	AccessLog               string
+	MaxRetries              int
+	RetryNonIdempotent      bool
+	RetryOn                 string
+	MaxBodySize             int64
+	RetryMaxBody            int64
+	RetrySpoolMax           int64
+	RetrySpoolDir           string
+	RetryTimeout            string
+	RetryMaxTime            time.Duration
+	ProxyTimeout            time.Duration
+	WebSocketIdleTimeout    time.Duration
+	WebSocketPingInterval   time.Duration
+	BackendMaxConnAge       time.Duration
+	TLSHandshakeTimeout     time.Duration
+	IdleConnTimeout         time.Duration
+	MaxIdleConns            int
+	MaxIdleConnsPerHost     int
+	PreserveHost            bool
+	TrailingSlash           string
+	CollapseSlashes         bool
+	PoolPathNormalization   string
+	ReadOnly                bool
+	SafeMethods             []string
+	Maintenance             bool
+	MaintenancePage         string
+	MaintenanceStatus       int
+	RuntimeMetrics          bool
+	StatusPage              bool
+	NoBackendPage           string
+	NoBackendStatus         int
+	BadGatewayPage          string
+	BadGatewayStatus        int
+	StatsDAddr              string
+	StatsDPrefix            string
+	StatsDTags              []string
+	StatsDInterval          time.Duration
+	StateFile               string
+	StateInterval           time.Duration
+	ShutdownTimeout         time.Duration
+	StateTTL                time.Duration
+	LogSyslog               bool
+	SyslogAddr              string
+	SyslogFacility          string
+	StartupCheck            bool
+	CheckConfig             bool
+	CacheControl            string
+	CacheSize               int
+	CacheTTL                time.Duration
+	RequestHeaders          string
+	ResponseHeaders         string
+	CORSAllowedOrigins      string
+	CORSAllowedMethods      string
+	CORSAllowedHeaders      string
+	ClientWriteTimeout      time.Duration
+	ReadTimeout             time.Duration
+	WriteTimeout            time.Duration
+	IdleTimeout             time.Duration
+	MaxConcurrentRequests   int
+	ConcurrencyQueue        int
+	ConcurrencyQueueTimeout time.Duration
+	ConcurrencyRetryAfter   time.Duration
+	StickyCookie            string
+	RequiredHeaders         []string
+	AllowedContentTypes     []string
+	BackendHTTPProxy        string
+	BackendHTTP2            bool
+	BackendProxyFromEnv     bool
+	HealthUseProxy          bool
+	BackendClientCert       string
+	BackendClientKey        string
+	BackendCA               string
+	BackendInsecure         bool
+}
+
+func main() {
+	// Parse command line flags
+	config := parseFlags()
+
+	// Validate configuration
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	if config.CheckConfig {
+		printConfigSummary(config)
+		if config.StartupCheck && !checkBackends(config) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Redirect logging to syslog if requested
+	if config.LogSyslog {
+		if err := setupSyslog(config.SyslogAddr, config.SyslogFacility); err != nil {
+			log.Printf("Syslog unavailable, logging to stderr: %v", err)
+		}
+	}
+
+	// Create load balancer based on algorithm
+	loadBalancer, err := createLoadBalancer(config)
+	if err != nil {
+		log.Fatalf("Error creating load balancer: %v", err)
+	}
+
+	// Load persisted backend state from a previous run
+	var savedState map[string]balancer.BackendState
+	if config.StateFile != "" {
+		savedState, err = balancer.LoadState(config.StateFile, config.StateTTL)
+		switch {
+		case err == nil:
+			log.Printf("Loaded backend state from %s", config.StateFile)
+		case errors.Is(err, os.ErrNotExist):
+			log.Printf("No backend state file at %s, starting fresh", config.StateFile)
+		default:
+			log.Printf("Ignoring backend state file %s: %v", config.StateFile, err)
+		}
+	}
+
+	// Add backends to load balancer
+	addBackends(loadBalancer, config.Backends, savedState)
+	if len(config.Backends) == 0 && config.BackendsDNS == "" {
+		log.Println("Starting without backends; requests get 503 until backends are added via /admin/backends")
+	}
+
+	// Create a balancer for each pool that path routes send requests to
+	poolSpecs, _ := parsePools(config.Pools)
+	pools := make(map[string]balancer.LoadBalancer)
+	for name, specs := range poolSpecs {
+		pool, err := createLoadBalancer(config)
+		if err != nil {
+			log.Fatalf("Error creating load balancer for pool %s: %v", name, err)
+		}
+		log.Printf("Creating backend pool %s", name)
+		addBackends(pool, specs, savedState)
+		pools[name] = pool
+	}
+	routes, _ := proxy.ParseRoutes(config.Routes)
+	hostRoutes, _ := proxy.ParseHostRoutes(config.HostRoutes)
+
+	// Files are checked by validateConfig, so errors are fatal
+	backendTLS, err := backendTLSConfig(config)
+	if err != nil {
+		log.Fatalf("Error loading backend TLS settings: %v", err)
+	}
+	if config.BackendInsecure {
+		log.Println("WARNING: TLS certificate verification is disabled for backend connections")
+	}
+
+	// Create health checker
+	healthChecker := newHealthChecker(config, loadBalancer, pools, backendTLS)
+
+	// Maintain one backend per address the -backends-dns name resolves to
+	if config.BackendsDNS != "" {
+		template, _ := parseBackendsDNS(config.BackendsDNS, config.Mode)
+		log.Printf("Discovering backends from %s every %v", template.URL.Hostname(), config.BackendsDNSInterval)
+		if err := refreshDNSBackends(template, loadBalancer, healthChecker); err != nil {
+			log.Printf("Error resolving %s, starting without backends until it resolves: %v", template.URL.Hostname(), err)
+		}
+		go discoverBackends(template, config.BackendsDNSInterval, loadBalancer, healthChecker)
+	}
+
+	// Report backend connectivity before serving
+	if config.StartupCheck {
+		runStartupCheck(healthChecker)
+	}
+
+	// Start health checking
+	healthChecker.StartHealthCheck()
+	defer healthChecker.StopHealthCheck()
+
+	// Periodically snapshot backend state
+	if config.StateFile != "" {
+		go snapshotState(loadBalancer, config.StateFile, config.StateInterval)
+	}
+
+	// Create StatsD client
+	var statsdClient *statsd.Client
+	if config.StatsDAddr != "" {
+		statsdClient, err = statsd.New(config.StatsDAddr, config.StatsDPrefix, config.StatsDTags)
+		if err != nil {
+			log.Fatalf("Error creating StatsD client: %v", err)
+		}
+		defer statsdClient.Close()
+
+		go proxy.ReportBackendMetrics(statsdClient, loadBalancer, config.StatsDInterval)
+		log.Printf("Exporting StatsD metrics to %s", config.StatsDAddr)
+	}
+
+	// Re-read backends from the config file on SIGHUP
+	reload := func() {
+		log.Println("Received signal: hangup. Reloading backends...")
+		if err := reloadBackends(config, loadBalancer, pools, healthChecker); err != nil {
+			log.Printf("Error reloading backends, keeping the current ones: %v", err)
+		}
+	}
+
+	// In TCP mode, relay raw connections instead of proxying HTTP
+	if config.Mode == "tcp" {
+		serveTCP(config, loadBalancer, healthChecker, reload)
+		saveFinalState(config, loadBalancer)
+		return
+	}
+
+	// Create reverse proxy
+	cacheRules, _ := proxy.ParseCacheRules(config.CacheControl)
+	requestHeaders, _ := proxy.ParseHeaderRules(config.RequestHeaders)
+	responseHeaders, _ := proxy.ParseHeaderRules(config.ResponseHeaders)
+	cors, _ := proxy.ParseCORS(config.CORSAllowedOrigins, config.CORSAllowedMethods, config.CORSAllowedHeaders)
+	trustedProxies, _ := proxy.ParseTrustedProxies(config.TrustedProxies)
+	retryOn, _ := balancer.ParseStatusSet(config.RetryOn)
+	poolPathNormalization, _ := proxy.ParsePathNormalization(config.PoolPathNormalization)
+	var algorithmOverrides map[string]balancer.LoadBalancer
+	if config.AllowAlgorithmOverride {
+		algorithmOverrides = createAlgorithmOverrides(config)
+		log.Printf("Per-request algorithm override enabled for trusted proxies %s", config.TrustedProxies)
+	}
+
+	// Backends added through the admin API must suit the mode like configured ones
+	validateBackendURL := func(backendURL *url.URL) error {
+		return validateBackendScheme(backendURL, config.Mode)
+	}
+
+	reverseProxy := proxy.NewReverseProxy(loadBalancer, healthChecker, proxy.Options{
+		Algorithm:               config.Algorithm,
+		AlgorithmOverrides:      algorithmOverrides,
+		Routes:                  routes,
+		HostRoutes:              hostRoutes,
+		Compression:             config.Compression,
+		CompressionMinSize:      config.CompressionMinSize,
+		AlwaysFlush:             config.AlwaysFlush,
+		RejectUnknownHosts:      config.RejectUnknownHosts,
+		UnmatchedRoute:          config.UnmatchedRoute,
+		Pools:                   pools,
+		TrustedProxies:          trustedProxies,
+		DebugHeaders:            config.DebugHeaders,
+		RequestIDHeader:         config.RequestIDHeader,
+		ServedByHeader:          config.ServedByHeader,
+		AdminToken:              config.AdminToken,
+		ValidateBackendURL:      validateBackendURL,
+		DecisionLogSize:         config.DecisionLogSize,
+		AccessLog:               accessLogWriter(config.AccessLog),
+		MaxRetries:              config.MaxRetries,
+		RetryNonIdempotent:      config.RetryNonIdempotent,
+		RetryOn:                 retryOn,
+		MaxBodySize:             config.MaxBodySize,
+		RetryMaxBody:            config.RetryMaxBody,
+		RetrySpoolMax:           config.RetrySpoolMax,
+		RetrySpoolDir:           config.RetrySpoolDir,
+		RetryTimeout:            config.RetryTimeout,
+		RetryMaxTime:            config.RetryMaxTime,
+		ProxyTimeout:            config.ProxyTimeout,
+		WebSocketIdleTimeout:    config.WebSocketIdleTimeout,
+		WebSocketPingInterval:   config.WebSocketPingInterval,
+		MaxConnAge:              config.BackendMaxConnAge,
+		TLSHandshakeTimeout:     config.TLSHandshakeTimeout,
+		IdleConnTimeout:         config.IdleConnTimeout,
+		MaxIdleConns:            config.MaxIdleConns,
+		MaxIdleConnsPerHost:     config.MaxIdleConnsPerHost,
+		ClientWriteTimeout:      config.ClientWriteTimeout,
+		MaxConcurrentRequests:   config.MaxConcurrentRequests,
+		ConcurrencyQueue:        config.ConcurrencyQueue,
+		ConcurrencyQueueTimeout: config.ConcurrencyQueueTimeout,
+		ConcurrencyRetryAfter:   config.ConcurrencyRetryAfter,
+		StickyCookie:            config.StickyCookie,
+		ResponseRules: proxy.ResponseRules{
+			RequiredHeaders: config.RequiredHeaders,
+			ContentTypes:    config.AllowedContentTypes,
+		},
+		BackendProxy:          backendProxy(config),
+		BackendTLS:            backendTLS,
+		BackendHTTP2:          config.BackendHTTP2,
+		PreserveHost:          config.PreserveHost,
+		TrailingSlash:         config.TrailingSlash,
+		CollapseSlashes:       config.CollapseSlashes,
+		PoolPathNormalization: poolPathNormalization,
+		ReadOnly:              config.ReadOnly,
+		SafeMethods:           config.SafeMethods,
+		Maintenance:           config.Maintenance,
+		MaintenancePage:       errorPage(config.MaintenancePage, config.MaintenanceStatus),
+		CacheRules:            cacheRules,
+		CacheSize:             config.CacheSize,
+		CacheTTL:              config.CacheTTL,
+		RequestHeaders:        requestHeaders,
+		ResponseHeaders:       responseHeaders,
+		CORS:                  cors,
+		RuntimeMetrics:        config.RuntimeMetrics,
+		StatusPage:            config.StatusPage,
+		NoBackendPage:         errorPage(config.NoBackendPage, config.NoBackendStatus),
+		BadGatewayPage:        errorPage(config.BadGatewayPage, config.BadGatewayStatus),
+		StatsD:                statsdClient,
+	})
+
+	// Create HTTP server
+	server := &http.Server{
+		Addr:         ":" + config.Port,
+		Handler:      proxy.Recover(reverseProxy),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+
+	// Start server in goroutine
+	go func() {
+		log.Printf("Load balancer starting on port %s", config.Port)
+		log.Printf("Algorithm: %s", config.Algorithm)
+		log.Printf("Backends: %v", config.Backends)
+		log.Printf("Health check interval: %v", config.HealthCheckInterval)
+
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	// Handle graceful shutdown
+	handleGracefulShutdown(server, healthChecker, reverseProxy, config.ShutdownTimeout, reload)
+	saveFinalState(config, loadBalancer)
+}
+
+// saveFinalState writes the backends' state on exit, if a state file is configured
+func saveFinalState(config *Config, loadBalancer balancer.LoadBalancer) {
+	if config.StateFile == "" {
+		return
+	}
+	if err := balancer.SaveState(config.StateFile, loadBalancer.GetBackends()); err != nil {
+		log.Printf("Error saving backend state: %v", err)
+	}
+}
+
+// serveTCP relays raw TCP connections to the backends until a shutdown
+// signal, then waits up to the shutdown timeout for open connections to close.
+// reload is called on SIGHUP.
+func serveTCP(config *Config, loadBalancer balancer.LoadBalancer, healthChecker balancer.HealthChecker, reload func()) {
+	tcpProxy := proxy.NewTCPProxy(loadBalancer, healthChecker, proxy.TCPOptions{})
+
+	listener, err := net.Listen("tcp", ":"+config.Port)
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+
+	go func() {
+		log.Printf("TCP load balancer starting on port %s", config.Port)
+		log.Printf("Algorithm: %s", config.Algorithm)
+		log.Printf("Backends: %v", config.Backends)
+		log.Printf("Health check interval: %v", config.HealthCheckInterval)
+
+		if err := tcpProxy.Serve(listener); err != nil && err != proxy.ErrTCPProxyClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	sig := waitForSignal(reload)
+	log.Printf("Received signal: %v. Starting graceful shutdown...", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	log.Println("Stopping health checker...")
+	healthChecker.StopHealthCheck()
+
+	log.Printf("Closing listener, waiting for %d open connections...", tcpProxy.Active())
+	if err := tcpProxy.Shutdown(ctx); err != nil {
+		log.Printf("Error during shutdown: %v, closed %d open connections", err, tcpProxy.Active())
+		return
+	}
+
+	log.Println("Graceful shutdown completed")
+}
+
+// backendProxy returns how backend connections pick an HTTP proxy: the
+// configured proxy, the standard environment variables, or none
+func backendProxy(config *Config) func(*http.Request) (*url.URL, error) {
+	if config.BackendHTTPProxy != "" {
+		proxyURL, _ := url.Parse(config.BackendHTTPProxy)
+		return http.ProxyURL(proxyURL)
+	}
+	if config.BackendProxyFromEnv {
+		return http.ProxyFromEnvironment
+	}
+	return nil
+}
+
+// backendTLSConfig builds the TLS settings for connections to HTTPS
+// backends from the client certificate, CA bundle and verification flags.
+// It returns nil, meaning Go's defaults, when none of them are set.
+func backendTLSConfig(config *Config) (*tls.Config, error) {
+	if config.BackendClientCert == "" && config.BackendCA == "" && !config.BackendInsecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.BackendInsecure}
+	if config.BackendClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.BackendClientCert, config.BackendClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.BackendCA != "" {
+		pem, err := os.ReadFile(config.BackendCA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid backend CA bundle %s: no PEM certificates found", config.BackendCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// serverWriteTimeout leaves room after the proxy timeout so that the error
+// response for a timed-out backend request still reaches the client
+func serverWriteTimeout(proxyTimeout time.Duration) time.Duration {
+	if proxyTimeout == 0 {
+		return 0
+	}
+	return proxyTimeout + 5*time.Second
+}
+
+// newHealthChecker creates the health checker for the primary balancer and
+// the pools from the health check settings
+func newHealthChecker(config *Config, loadBalancer balancer.LoadBalancer, pools map[string]balancer.LoadBalancer, backendTLS *tls.Config) *balancer.DefaultHealthChecker {
+	minHealthy, _ := balancer.ParseMinHealthy(config.MinHealthy)
+	expectStatus, _ := balancer.ParseStatusSet(config.HealthExpectStatus)
+	healthOptions := balancer.HealthCheckOptions{
+		Path:               config.HealthPath,
+		ReadyPath:          config.HealthReadyPath,
+		TCP:                config.Mode == "tcp",
+		Method:             config.HealthMethod,
+		ExpectStatus:       expectStatus,
+		TLSConfig:          backendTLS,
+		InsecureSkipVerify: config.HealthInsecure,
+		MinHealthy:         minHealthy,
+		MaxBackoff:         config.HealthMaxBackoff,
+		Concurrency:        config.HealthConcurrency,
+		Passive: balancer.PassiveCheck{
+			Failures: config.PassiveFailures,
+			Window:   config.PassiveWindow,
+		},
+		Outlier: balancer.OutlierDetection{
+			ErrorRate:   config.OutlierErrorRate,
+			MinRequests: config.OutlierMinRequests,
+			Window:      config.OutlierWindow,
+			Cooldown:    config.OutlierCooldown,
+		},
+	}
+	if config.HealthUseProxy {
+		healthOptions.Proxy = backendProxy(config)
+	}
+	if config.HealthJSONExpect != "" {
+		healthOptions.JSONExpect, _ = balancer.ParseJSONExpectation(config.HealthJSONExpect)
+	}
+	healthOptions.BodyContains = config.HealthBodyContains
+
+	healthChecker := balancer.NewHealthChecker(
+		loadBalancer,
+		config.HealthCheckInterval,
+		config.HealthCheckTimeout,
+		healthOptions,
+	)
+
+	for _, pool := range pools {
+		healthChecker.AddPool(pool)
+	}
+	return healthChecker
+}
+
+// runStartupCheck logs, for each backend of every pool, whether its host is
+// reachable and whether its health endpoint responds as expected
+func runStartupCheck(healthChecker *balancer.DefaultHealthChecker) {
+	diagnoses := healthChecker.DiagnoseAll()
+
+	healthy := 0
+	for _, diagnosis := range diagnoses {
+		if diagnosis.Healthy() {
+			healthy++
+		}
+		log.Printf("Startup check %s: %s", diagnosis.Backend.URL.String(), diagnosis.Diagnosis)
+	}
+	log.Printf("Startup check complete: %d/%d backends healthy", healthy, len(diagnoses))
+}
+
+// snapshotState periodically writes backend state to the state file
+func snapshotState(loadBalancer balancer.LoadBalancer, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := balancer.SaveState(path, loadBalancer.GetBackends()); err != nil {
+			log.Printf("Error saving backend state: %v", err)
+		}
+	}
+}
+
+// parseFlags parses command line flags and returns configuration
+func parseFlags() *Config {
+	var (
+		port               = flag.String("port", "8080", "Port to listen on")
+		mode               = flag.String("mode", "http", "Proxy mode: http, or tcp to forward raw TCP connections to tcp:// backends")
+		backends           = flag.String("backends", "", "Comma-separated list of backend URLs with optional |weight (e.g., http://localhost:3001|5,http://localhost:3002)")
+		allowEmpty         = flag.Bool("allow-empty-backends", false, "Start without backends and add them later via the admin API")
+		backendsDNS        = flag.String("backends-dns", "", "Backend URL whose host name is resolved to one backend per A/AAAA record, instead of -backends (e.g., http://api.default.svc.cluster.local:8080)")
+		dnsInterval        = flag.Duration("backends-dns-interval", 30*time.Second, "How often the -backends-dns name is re-resolved")
+		pools              = flag.String("pools", "", "Semicolon-separated named backend pools for -routes (e.g., api=http://localhost:3001,http://localhost:3002;static=http://localhost:3003)")
+		hostRoutes         = flag.String("host-routes", "", "Comma-separated host=pool routes by Host header, exact or *.domain wildcards (e.g., api.example.com=api,*.example.com=app)")
+		rejectUnknownHosts = flag.Bool("reject-unknown-hosts", false, "Respond 404 to requests whose Host matches no -host-routes rule instead of using the default pool")
+		unmatchedRoute     = flag.String("unmatched-route", proxy.UnmatchedDefault, "What happens to requests matching no -routes or -host-routes rule (default, 404, 502, or a pool name)")
+		routes             = flag.String("routes", "", "Semicolon-separated path=pool routes, prefixes or ~regexps (e.g., /api/=api;~\\.css$=static)")
+		algorithm          = flag.String("algorithm", "round-robin", "Load balancing algorithm (round-robin, weighted-round-robin, least-connections, ip-hash, p2c, least-response-time, weighted-random)")
+		slowStart          = flag.Duration("slow-start", 0, "Ramp a recovered backend's weight up from near zero over this duration (weighted-round-robin and weighted-random only, 0 = off)")
+		tieBreak           = flag.String("least-conn-tie-break", "first", "How least-connections picks among equally loaded backends (first, random, round-robin)")
+		ipHashFallback     = flag.String("ip-hash-fallback", "round-robin", "How ip-hash picks a backend when the request has no valid client IP (round-robin, first)")
+		ipHashRetry        = flag.String("ip-hash-retry", "next", "How ip-hash picks the backend for a retry (next, round-robin)")
+		allowOverride      = flag.Bool("allow-algorithm-override", false, "Let trusted proxies pick the algorithm per request with the X-LB-Algorithm header")
+		trustedProxies     = flag.String("trusted-proxies", "", "Comma-separated IPs and CIDR ranges of trusted proxies (e.g., 10.0.0.0/8,192.168.1.5)")
+		healthInterval     = flag.Duration("health-interval", 30*time.Second, "Health check interval")
+		healthTimeout      = flag.Duration("health-timeout", 5*time.Second, "Health check timeout")
+		healthPath         = flag.String("health-path", balancer.DefaultHealthPath, "Path probed on each backend by health checks")
+		healthReadyPath    = flag.String("health-ready-path", "", "Path probed on live backends to decide whether they are ready for requests (empty = off)")
+		healthMethod       = flag.String("health-method", "GET", "HTTP method used by health checks")
+		healthStatus       = flag.String("health-expect-status", "200-299", "Comma-separated status codes or ranges that count as healthy (e.g., 200,204)")
+		healthJSON         = flag.String("health-json-expect", "", "Require a JSON field in the health response (e.g., .status=UP)")
+		healthContains     = flag.String("health-body-contains", "", "Require the health response body to contain this text")
+		healthConcurrency  = flag.Int("health-concurrency", balancer.DefaultHealthConcurrency, "Maximum number of backends health checked at once")
+		healthBackoff      = flag.Duration("health-max-backoff", 0, "Check repeatedly failing backends exponentially less often, up to this interval (0 = off)")
+		healthInsecure     = flag.Bool("health-insecure-skip-verify", false, "Skip TLS certificate verification for health checks only")
+		minHealthy         = flag.String("min-healthy", "", "Never mark backends down below this count or percentage of the pool (e.g., 2 or 50%)")
+		passiveFails       = flag.Int("passive-failures", 0, "Mark a backend down after this many consecutive failed requests (0 = off)")
+		passiveWindow      = flag.Duration("passive-window", 10*time.Second, "Time within which -passive-failures must occur (0 = no limit)")
+		outlierRate        = flag.Float64("outlier-error-rate", 0, "Eject a backend whose error rate over -outlier-window reaches this percentage (0 = off)")
+		outlierMin         = flag.Int("outlier-min-requests", 20, "Requests within -outlier-window needed before a backend can be ejected")
+		outlierWindow      = flag.Duration("outlier-window", 30*time.Second, "Sliding window over which backend error rates are computed")
+		outlierCooldown    = flag.Duration("outlier-cooldown", 30*time.Second, "How long an ejected backend is kept out of rotation")
+		debugHeaders       = flag.Bool("debug-headers", false, "Add X-LB-Algorithm and X-LB-Backend-Count headers to every response")
+		requestIDHeader    = flag.String("request-id-header", proxy.DefaultRequestIDHeader, "Header carrying a unique ID for each proxied request, reused from the client if present (empty = off)")
+		servedByHeader     = flag.String("served-by-header", "", "Response header naming the backend that served the request (e.g., X-Served-By; empty = off)")
+		adminToken         = flag.String("admin-token", "", "Bearer token required for the /admin/ API (disabled if empty)")
+		decisionLog        = flag.Int("debug-decisions", 0, "Keep this many recent routing decisions for GET /debug/decisions (0 = off, requires -admin-token)")
+		accessLog          = flag.String("access-log", "", "File to append a JSON line per proxied request to, or - for stdout (empty = off)")
+		maxRetries         = flag.Int("max-retries", 0, "Retry a request failing with an error or a -retry-on status on up to this many other backends")
+		retryOn            = flag.String("retry-on", proxy.DefaultRetryOn.String(), "Comma-separated backend response statuses and ranges that are retried, along with connection errors")
+		maxBodySize        = flag.Int64("max-body-size", 0, "Largest request body in bytes accepted; larger requests get a 413 (0 = no limit)")
+		retryMaxBody       = flag.Int64("retry-max-body", proxy.DefaultRetryMaxBody, "Largest request body in bytes buffered so the request can be retried")
+		retrySpoolMax      = flag.Int64("retry-spool-max", 0, "Spool request bodies larger than -retry-max-body, up to this many bytes, to disk so they can be retried (0 = off)")
+		retrySpoolDir      = flag.String("retry-spool-dir", "", "Directory for spooled request bodies (default: system temp dir)")
+		retryAll           = flag.Bool("retry-non-idempotent", false, "Also retry requests with non-idempotent methods such as POST")
+		retryTimeout       = flag.String("retry-timeout", proxy.RetryTimeoutPerAttempt, "How -proxy-timeout applies to retried requests (per-attempt, shared)")
+		retryMaxTime       = flag.Duration("retry-max-time", 0, "Cap on the time all attempts of a retried request take together (0 = no cap)")
+		proxyTimeout       = flag.Duration("proxy-timeout", 30*time.Second, "Timeout for each proxied request, including the response body (0 = no limit)")
+		wsIdleTimeout      = flag.Duration("websocket-idle-timeout", 0, "Close upgraded connections such as WebSockets with no traffic either way for this long (0 = never)")
+		wsPingInterval     = flag.Duration("websocket-ping-interval", 0, "Send a WebSocket ping to clients this often, keeping quiet sockets open (0 = off)")
+		maxConnAge         = flag.Duration("backend-max-conn-age", 0, "Maximum lifetime of a pooled backend connection (0 = unlimited)")
+		tlsHandshake       = flag.Duration("backend-tls-handshake-timeout", 10*time.Second, "Timeout for the TLS handshake with HTTPS backends (0 = no limit)")
+		idleConnTime       = flag.Duration("backend-idle-conn-timeout", 90*time.Second, "Close pooled backend connections idle for longer than this (0 = never)")
+		backendProxy       = flag.String("backend-http-proxy", "", "HTTP proxy URL for backend connections (overrides HTTP_PROXY/HTTPS_PROXY)")
+		backendHTTP2       = flag.Bool("backend-http2", false, "Speak HTTP/2 to all backends, using h2c for http:// backends")
+		proxyFromEnv       = flag.Bool("backend-proxy-from-env", true, "Use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables for backend connections")
+		healthProxy        = flag.Bool("health-use-proxy", false, "Send health checks through the backend proxy too")
+		clientCert         = flag.String("backend-client-cert", "", "PEM client certificate presented to HTTPS backends (requires -backend-client-key)")
+		clientKey          = flag.String("backend-client-key", "", "PEM private key of -backend-client-cert")
+		backendCA          = flag.String("backend-ca", "", "PEM CA bundle used to verify HTTPS backends instead of the system roots")
+		backendInsecure    = flag.Bool("backend-insecure-skip-verify", false, "Skip TLS certificate verification for backends (testing only)")
+		clientWrite        = flag.Duration("client-write-timeout", 0, "Abort a response when a single write to the client blocks this long (0 = no limit)")
+		readTimeout        = flag.Duration("read-timeout", 30*time.Second, "Maximum time to read a client request, including the body (0 = no limit)")
+		writeTimeout       = flag.Duration("write-timeout", 0, "Maximum time to write a response to the client (default -proxy-timeout, times the attempts of retried requests, plus 5s, 0 = no limit)")
+		idleTimeout        = flag.Duration("idle-timeout", 120*time.Second, "How long an idle client keep-alive connection is kept open (0 = use -read-timeout)")
+		requireHeaders     = flag.String("require-response-headers", "", "Comma-separated headers every backend response must have; others are treated as backend errors")
+		contentTypes       = flag.String("allowed-content-types", "", "Comma-separated media types backend responses may have, e.g. application/json,text/* (empty = any)")
+		stickyCookie       = flag.String("sticky-cookie", "", "Cookie name for sticky sessions pinning clients to a backend (empty = off)")
+		maxConcurrent      = flag.Int("max-concurrent-requests", 0, "Maximum proxied requests in flight at once; more queue or get a 503 (0 = no limit)")
+		concurrentQueue    = flag.Int("max-concurrent-queue", 0, "Requests over -max-concurrent-requests that may wait for a slot (0 = reject immediately)")
+		queueTimeout       = flag.Duration("max-concurrent-queue-timeout", 10*time.Second, "Maximum time a queued request waits for a slot (0 = until the client gives up)")
+		retryAfter         = flag.Duration("max-concurrent-retry-after", 0, "Retry-After sent with 503s for requests over the concurrency limit (0 = omit)")
+		maxIdleConns       = flag.Int("backend-max-idle-conns", 100, "Maximum idle pooled connections across all backends (0 = unlimited)")
+		maxIdlePerHost     = flag.Int("backend-max-idle-conns-per-host", 32, "Maximum idle pooled connections per backend")
+		preserveHost       = flag.Bool("preserve-host", false, "Send the client's Host header to backends instead of the backend's host")
+		trailingSlash      = flag.String("trailing-slash", "", "Normalize trailing slashes on proxied paths (add, strip)")
+		collapseSlash      = flag.Bool("collapse-slashes", false, "Collapse repeated slashes in proxied paths")
+		poolPathNorm       = flag.String("pool-path-normalization", "", "Semicolon-separated path normalization per pool, replacing -trailing-slash and -collapse-slashes (e.g., api=strip,collapse;static=none)")
+		readOnly           = flag.Bool("read-only", false, "Start in read-only mode, rejecting unsafe methods with 503")
+		safeMethods        = flag.String("read-only-safe-methods", "GET,HEAD,OPTIONS", "Comma-separated methods allowed in read-only mode")
+		maintenance        = flag.Bool("maintenance", false, "Start in maintenance mode, answering all proxied requests with 503")
+		maintenancePage    = flag.String("maintenance-page", "", "File served instead of the plain-text response in maintenance mode")
+		maintenanceStatus  = flag.Int("maintenance-status", http.StatusServiceUnavailable, "Status code sent in maintenance mode")
+		noBackendPage      = flag.String("no-backend-page", "", "File served instead of the plain-text error when no healthy backend is available")
+		noBackendStatus    = flag.Int("no-backend-status", http.StatusServiceUnavailable, "Status code sent when no healthy backend is available")
+		badGatewayPage     = flag.String("bad-gateway-page", "", "File served instead of the plain-text error when a backend request fails")
+		badGatewayStatus   = flag.Int("bad-gateway-status", 0, "Status code sent when a backend request fails (default 502, or 504 if it timed out)")
+		statusPage         = flag.Bool("status-page", false, "Serve an auto-refreshing HTML dashboard of the backends on /status")
+		runtimeMetrics     = flag.Bool("runtime-metrics", false, "Include Go runtime metrics (goroutines, heap, GC, file descriptors) in /stats")
+		statsdAddr         = flag.String("statsd-addr", "", "StatsD server address (host:port) to push metrics to over UDP")
+		statsdPrefix       = flag.String("statsd-prefix", "lb.", "Prefix for StatsD metric names")
+		statsdTags         = flag.String("statsd-tags", "", "Comma-separated key:value tags added to every StatsD metric")
+		statsdInterval     = flag.Duration("statsd-interval", 10*time.Second, "Interval for pushing backend gauges to StatsD")
+		stateFile          = flag.String("state-file", "", "File to persist backend health state across restarts")
+		stateInterval      = flag.Duration("state-interval", 30*time.Second, "Interval between backend state snapshots")
+		shutdownTimeout    = flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight requests on shutdown")
+		stateTTL           = flag.Duration("state-ttl", 10*time.Minute, "Ignore a state file older than this at startup")
+		logSyslog          = flag.Bool("log-syslog", false, "Send log output to syslog instead of stderr")
+		syslogAddr         = flag.String("syslog-addr", "", "Syslog server address as [network://]host:port (default: local syslog)")
+		syslogFacility     = flag.String("syslog-facility", "daemon", "Syslog facility (e.g., daemon, local0-local7)")
+		compression        = flag.Bool("enable-compression", false, "Gzip responses for clients that send Accept-Encoding: gzip")
+		alwaysFlush        = flag.Bool("always-flush", false, "Flush every response to the client as it arrives, not only streams such as text/event-stream")
+		compressionMin     = flag.Int64("compression-min-size", proxy.DefaultCompressionMinSize, "Smallest response body in bytes gzipped by -enable-compression")
+		cacheControl       = flag.String("cache-control", "", "Semicolon-separated path=Cache-Control rules for responses (e.g., /api/*=no-store)")
+		cacheSize          = flag.Int("cache-size", 0, "Cache up to this many GET responses in memory for repeated requests (0 = off)")
+		cacheTTL           = flag.Duration("cache-ttl", proxy.DefaultCacheTTL, "How long to cache responses without max-age (0 = only cache responses with max-age)")
+		requestHeaders     = flag.String("request-headers", "", "Semicolon-separated header rules for requests to backends (e.g., remove:X-Internal-Token;set:X-Proxied-By=lb)")
+		responseHeaders    = flag.String("response-headers", "", "Semicolon-separated header rules for responses to clients (add:<name>=<value>, set:<name>=<value>, remove:<name>)")
+		corsOrigins        = flag.String("cors-allowed-origins", "", "Comma-separated origins allowed to make cross-origin requests, or * for any (empty = CORS left to backends)")
+		corsMethods        = flag.String("cors-allowed-methods", proxy.DefaultCORSMethods, "Comma-separated methods allowed in cross-origin requests")
+		corsHeaders        = flag.String("cors-allowed-headers", proxy.DefaultCORSHeaders, "Comma-separated request headers allowed in cross-origin requests, or * for any")
+		startupCheck       = flag.Bool("startup-check", false, "Diagnose backend reachability and health endpoints at startup")
+		configFile         = flag.String("config", "", "JSON config file with settings keyed by flag name; flags override it")
+		checkConfig        = flag.Bool("check-config", false, "Validate the flags and config file, print a summary and exit without starting")
+		showHelp           = flag.Bool("help", false, "Show help message")
+	)
+
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile); err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+	}
+
+	var backendList []string
+	if *backends != "" {
+		backendList = strings.Split(*backends, ",")
+		for i, backend := range backendList {
+			backendList[i] = strings.TrimSpace(backend)
+		}
+	}
+
+	var safeMethodList []string
+	for _, method := range strings.Split(*safeMethods, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			safeMethodList = append(safeMethodList, method)
+		}
+	}
+
+	var requiredHeaderList []string
+	for _, name := range strings.Split(*requireHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			requiredHeaderList = append(requiredHeaderList, name)
+		}
+	}
+
+	var contentTypeList []string
+	for _, mediaType := range strings.Split(*contentTypes, ",") {
+		if mediaType = strings.TrimSpace(mediaType); mediaType != "" {
+			contentTypeList = append(contentTypeList, mediaType)
+		}
+	}
+
+	var statsdTagList []string
+	for _, tag := range strings.Split(*statsdTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			statsdTagList = append(statsdTagList, tag)
+		}
+	}
+
+	// Unless given, the write timeout leaves room after the proxy timeout, or
+	// after all attempts of a retried request
+	serverWrite := *writeTimeout
+	if !setOnCommandLine()["write-timeout"] {
+		serverWrite = serverWriteTimeout(proxy.RetryTimeBudget(*proxyTimeout, *maxRetries, *retryTimeout, *retryMaxTime))
+	}
+
+	return &Config{
+		ConfigFile:              *configFile,
+		Port:                    *port,
+		Mode:                    *mode,
+		Backends:                backendList,
+		AllowEmptyBackends:      *allowEmpty,
+		BackendsDNS:             *backendsDNS,
+		BackendsDNSInterval:     *dnsInterval,
+		Pools:                   *pools,
+		Routes:                  *routes,
+		HostRoutes:              *hostRoutes,
+		Compression:             *compression,
+		CompressionMinSize:      *compressionMin,
+		AlwaysFlush:             *alwaysFlush,
+		RejectUnknownHosts:      *rejectUnknownHosts,
+		UnmatchedRoute:          *unmatchedRoute,
+		Algorithm:               *algorithm,
+		LeastConnTieBreak:       *tieBreak,
+		SlowStart:               *slowStart,
+		IPHashFallback:          *ipHashFallback,
+		IPHashRetry:             *ipHashRetry,
+		AllowAlgorithmOverride:  *allowOverride,
+		TrustedProxies:          *trustedProxies,
+		HealthCheckInterval:     *healthInterval,
+		HealthCheckTimeout:      *healthTimeout,
+		HealthJSONExpect:        *healthJSON,
+		HealthBodyContains:      *healthContains,
+		HealthMaxBackoff:        *healthBackoff,
+		HealthConcurrency:       *healthConcurrency,
+		HealthPath:              *healthPath,
+		HealthReadyPath:         *healthReadyPath,
+		HealthMethod:            strings.ToUpper(strings.TrimSpace(*healthMethod)),
+		HealthExpectStatus:      *healthStatus,
+		HealthInsecure:          *healthInsecure,
+		MinHealthy:              *minHealthy,
+		PassiveFailures:         *passiveFails,
+		PassiveWindow:           *passiveWindow,
+		OutlierErrorRate:        *outlierRate,
+		OutlierMinRequests:      *outlierMin,
+		OutlierWindow:           *outlierWindow,
+		OutlierCooldown:         *outlierCooldown,
+		DebugHeaders:            *debugHeaders,
+		RequestIDHeader:         *requestIDHeader,
+		ServedByHeader:          *servedByHeader,
+		AdminToken:              *adminToken,
+		DecisionLogSize:         *decisionLog,
+		AccessLog:               *accessLog,
+		MaxRetries:              *maxRetries,
+		RetryNonIdempotent:      *retryAll,
+		RetryOn:                 *retryOn,
+		MaxBodySize:             *maxBodySize,
+		RetryMaxBody:            *retryMaxBody,
+		RetrySpoolMax:           *retrySpoolMax,
+		RetrySpoolDir:           *retrySpoolDir,
+		RetryTimeout:            *retryTimeout,
+		RetryMaxTime:            *retryMaxTime,
+		ProxyTimeout:            *proxyTimeout,
+		WebSocketIdleTimeout:    *wsIdleTimeout,
+		WebSocketPingInterval:   *wsPingInterval,
+		BackendMaxConnAge:       *maxConnAge,
+		TLSHandshakeTimeout:     *tlsHandshake,
+		IdleConnTimeout:         *idleConnTime,
+		MaxIdleConns:            *maxIdleConns,
+		MaxIdleConnsPerHost:     *maxIdlePerHost,
+		PreserveHost:            *preserveHost,
+		TrailingSlash:           *trailingSlash,
+		CollapseSlashes:         *collapseSlash,
+		PoolPathNormalization:   *poolPathNorm,
+		ReadOnly:                *readOnly,
+		SafeMethods:             safeMethodList,
+		Maintenance:             *maintenance,
+		MaintenancePage:         *maintenancePage,
+		MaintenanceStatus:       *maintenanceStatus,
+		RuntimeMetrics:          *runtimeMetrics,
+		StatusPage:              *statusPage,
+		NoBackendPage:           *noBackendPage,
+		NoBackendStatus:         *noBackendStatus,
+		BadGatewayPage:          *badGatewayPage,
+		BadGatewayStatus:        *badGatewayStatus,
+		StatsDAddr:              *statsdAddr,
+		StatsDPrefix:            *statsdPrefix,
+		StatsDTags:              statsdTagList,
+		StatsDInterval:          *statsdInterval,
+		StateFile:               *stateFile,
+		StateInterval:           *stateInterval,
+		ShutdownTimeout:         *shutdownTimeout,
+		StateTTL:                *stateTTL,
+		LogSyslog:               *logSyslog,
+		SyslogAddr:              *syslogAddr,
+		SyslogFacility:          *syslogFacility,
+		StartupCheck:            *startupCheck,
+		CheckConfig:             *checkConfig,
+		CacheControl:            *cacheControl,
+		CacheSize:               *cacheSize,
+		CacheTTL:                *cacheTTL,
+		RequestHeaders:          *requestHeaders,
+		ResponseHeaders:         *responseHeaders,
+		CORSAllowedOrigins:      *corsOrigins,
+		CORSAllowedMethods:      *corsMethods,
+		CORSAllowedHeaders:      *corsHeaders,
+		ClientWriteTimeout:      *clientWrite,
+		ReadTimeout:             *readTimeout,
+		WriteTimeout:            serverWrite,
+		IdleTimeout:             *idleTimeout,
+		MaxConcurrentRequests:   *maxConcurrent,
+		ConcurrencyQueue:        *concurrentQueue,
+		ConcurrencyQueueTimeout: *queueTimeout,
+		ConcurrencyRetryAfter:   *retryAfter,
+		StickyCookie:            *stickyCookie,
+		RequiredHeaders:         requiredHeaderList,
+		AllowedContentTypes:     contentTypeList,
+		BackendHTTPProxy:        *backendProxy,
+		BackendHTTP2:            *backendHTTP2,
+		BackendProxyFromEnv:     *proxyFromEnv,
+		HealthUseProxy:          *healthProxy,
+		BackendClientCert:       *clientCert,
+		BackendClientKey:        *clientKey,
+		BackendCA:               *backendCA,
+		BackendInsecure:         *backendInsecure,
+	}
 }
 
-func main() {
-	// Parse command line flags
-	config := parseFlags()
+// validateConfig validates the configuration
+func validateConfig(config *Config) error {
+	if len(config.Backends) == 0 && config.BackendsDNS == "" && !config.AllowEmptyBackends {
+		return fmt.Errorf("at least one backend must be specified")
+	}
+
+	if config.BackendsDNS != "" {
+		if len(config.Backends) > 0 {
+			return fmt.Errorf("-backends and -backends-dns can't be used together")
+		}
+		if _, err := parseBackendsDNS(config.BackendsDNS, config.Mode); err != nil {
+			return fmt.Errorf("invalid -backends-dns %s: %v", config.BackendsDNS, err)
+		}
+		if config.BackendsDNSInterval <= 0 {
+			return fmt.Errorf("-backends-dns-interval must be positive")
+		}
+	}
+
+	if config.AllowEmptyBackends && config.Mode == "tcp" {
+		return fmt.Errorf("-allow-empty-backends is not supported with -mode tcp, which has no admin API")
+	}
+
+	if config.AllowEmptyBackends && config.AdminToken == "" {
+		return fmt.Errorf("-allow-empty-backends requires -admin-token to add backends later")
+	}
+
+	if config.Mode != "http" && config.Mode != "tcp" {
+		return fmt.Errorf("invalid mode: %s. Valid options: http, tcp", config.Mode)
+	}
+
+	for _, spec := range config.Backends {
+		backend, err := parseBackendSpec(spec)
+		if err != nil {
+			return fmt.Errorf("invalid backend %s: %v", spec, err)
+		}
+		if err := validateBackendScheme(backend.URL, config.Mode); err != nil {
+			return fmt.Errorf("invalid backend %s: %v", spec, err)
+		}
+	}
+
+	if config.Mode == "tcp" && (config.Pools != "" || config.Routes != "" || config.HostRoutes != "") {
+		return fmt.Errorf("-mode tcp does not support -pools, -routes or -host-routes")
+	}
+
+	poolSpecs, err := parsePools(config.Pools)
+	if err != nil {
+		return err
+	}
+
+	routes, err := proxy.ParseRoutes(config.Routes)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if _, ok := poolSpecs[route.Pool]; !ok {
+			return fmt.Errorf("route %s refers to unknown pool %s", route.Pattern, route.Pool)
+		}
+	}
+
+	hostRoutes, err := proxy.ParseHostRoutes(config.HostRoutes)
+	if err != nil {
+		return err
+	}
+	for _, route := range hostRoutes {
+		if _, ok := poolSpecs[route.Pool]; !ok {
+			return fmt.Errorf("host route %s refers to unknown pool %s", route.Pattern, route.Pool)
+		}
+	}
+
+	poolPathNormalization, err := proxy.ParsePathNormalization(config.PoolPathNormalization)
+	if err != nil {
+		return err
+	}
+	for pool := range poolPathNormalization {
+		if _, ok := poolSpecs[pool]; !ok {
+			return fmt.Errorf("path normalization refers to unknown pool %s", pool)
+		}
+	}
+
+	if config.RejectUnknownHosts && len(hostRoutes) == 0 {
+		return fmt.Errorf("-reject-unknown-hosts requires -host-routes")
+	}
+
+	if config.UnmatchedRoute != proxy.UnmatchedDefault {
+		if _, ok := poolSpecs[config.UnmatchedRoute]; !ok && config.UnmatchedRoute != proxy.UnmatchedNotFound && config.UnmatchedRoute != proxy.UnmatchedBadGateway {
+			return fmt.Errorf("invalid unmatched route: %s. Valid options: default, 404, 502, or the name of a pool", config.UnmatchedRoute)
+		}
+		if len(routes) == 0 && len(hostRoutes) == 0 {
+			return fmt.Errorf("-unmatched-route requires -routes or -host-routes")
+		}
+	}
+
+	if !slices.Contains(algorithms, config.Algorithm) {
+		return fmt.Errorf("invalid algorithm: %s. Valid options: %s", config.Algorithm, strings.Join(algorithms, ", "))
+	}
+
+	if _, err := proxy.ParseTrustedProxies(config.TrustedProxies); err != nil {
+		return err
+	}
+
+	if config.AllowAlgorithmOverride && strings.TrimSpace(config.TrustedProxies) == "" {
+		return fmt.Errorf("algorithm override requires -trusted-proxies")
+	}
+
+	if config.RequestIDHeader != "" && !proxy.ValidHeaderName(config.RequestIDHeader) {
+		return fmt.Errorf("invalid request ID header name: %q", config.RequestIDHeader)
+	}
+
+	if config.ServedByHeader != "" && !proxy.ValidHeaderName(config.ServedByHeader) {
+		return fmt.Errorf("invalid served-by header name: %q", config.ServedByHeader)
+	}
+
+	if config.SlowStart < 0 {
+		return fmt.Errorf("slow start must not be negative")
+	}
+
+	if config.SlowStart > 0 && config.Algorithm != "weighted-round-robin" && config.Algorithm != "weighted-random" {
+		return fmt.Errorf("-slow-start requires -algorithm weighted-round-robin or weighted-random")
+	}
+
+	switch config.LeastConnTieBreak {
+	case balancer.TieBreakFirst, balancer.TieBreakRandom, balancer.TieBreakRoundRobin:
+	default:
+		return fmt.Errorf("invalid least-connections tie-break: %s. Valid options: first, random, round-robin", config.LeastConnTieBreak)
+	}
+
+	switch config.IPHashFallback {
+	case balancer.IPHashFallbackRoundRobin, balancer.IPHashFallbackFirst:
+	default:
+		return fmt.Errorf("invalid ip-hash fallback: %s. Valid options: round-robin, first", config.IPHashFallback)
+	}
+
+	switch config.IPHashRetry {
+	case balancer.IPHashRetryNext, balancer.IPHashRetryRoundRobin:
+	default:
+		return fmt.Errorf("invalid ip-hash retry strategy: %s. Valid options: next, round-robin", config.IPHashRetry)
+	}
+
+	if config.HealthCheckInterval <= 0 {
+		return fmt.Errorf("health check interval must be positive")
+	}
+
+	if config.HealthCheckTimeout <= 0 {
+		return fmt.Errorf("health check timeout must be positive")
+	}
+
+	if !strings.HasPrefix(config.HealthPath, "/") {
+		return fmt.Errorf("health path must start with /")
+	}
+
+	if config.HealthReadyPath != "" {
+		if !strings.HasPrefix(config.HealthReadyPath, "/") {
+			return fmt.Errorf("health ready path must start with /")
+		}
+		if config.Mode == "tcp" {
+			return fmt.Errorf("-health-ready-path is not supported with -mode tcp, whose health checks only connect")
+		}
+	}
+
+	if config.HealthMethod == "" || strings.ContainsAny(config.HealthMethod, " \t") {
+		return fmt.Errorf("invalid health check method: %q", config.HealthMethod)
+	}
+
+	if _, err := balancer.ParseStatusSet(config.HealthExpectStatus); err != nil {
+		return fmt.Errorf("invalid health expect status: %v", err)
+	}
+
+	if config.HealthJSONExpect != "" {
+		if _, err := balancer.ParseJSONExpectation(config.HealthJSONExpect); err != nil {
+			return err
+		}
+		if config.HealthMethod == http.MethodHead {
+			return fmt.Errorf("health JSON expectation requires a response body, which HEAD health checks don't get")
+		}
+	}
+
+	if config.HealthConcurrency <= 0 {
+		return fmt.Errorf("health concurrency must be positive")
+	}
+
+	if config.HealthMaxBackoff < 0 {
+		return fmt.Errorf("health max backoff must not be negative")
+	}
+
+	if config.HealthBodyContains != "" && config.HealthMethod == http.MethodHead {
+		return fmt.Errorf("-health-body-contains requires a response body, which HEAD health checks don't get")
+	}
+
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+
+	retryOn, err := balancer.ParseStatusSet(config.RetryOn)
+	if err != nil {
+		return fmt.Errorf("invalid retry-on statuses: %v", err)
+	}
+	for _, statuses := range retryOn {
+		if statuses.Min < 400 {
+			return fmt.Errorf("invalid retry-on statuses: only 4xx and 5xx statuses can be retried, got %s", config.RetryOn)
+		}
+	}
+
+	if config.MaxBodySize < 0 {
+		return fmt.Errorf("max body size must not be negative")
+	}
+
+	if config.RetryMaxBody <= 0 {
+		return fmt.Errorf("retry max body must be positive")
+	}
+
+	if config.RetrySpoolMax < 0 {
+		return fmt.Errorf("retry spool max must not be negative")
+	}
+
+	if config.RetrySpoolDir != "" {
+		if info, err := os.Stat(config.RetrySpoolDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("retry spool directory %s is not a directory", config.RetrySpoolDir)
+		}
+	}
+
+	if config.ProxyTimeout < 0 {
+		return fmt.Errorf("proxy timeout must not be negative")
+	}
+
+	switch config.RetryTimeout {
+	case proxy.RetryTimeoutPerAttempt, proxy.RetryTimeoutShared:
+	default:
+		return fmt.Errorf("invalid retry timeout mode: %s. Valid options: per-attempt, shared", config.RetryTimeout)
+	}
+
+	if config.RetryMaxTime < 0 {
+		return fmt.Errorf("retry max time must not be negative")
+	}
+
+	if config.WebSocketIdleTimeout < 0 {
+		return fmt.Errorf("WebSocket idle timeout must not be negative")
+	}
+
+	if config.WebSocketPingInterval < 0 {
+		return fmt.Errorf("WebSocket ping interval must not be negative")
+	}
+
+	if config.WebSocketIdleTimeout > 0 && config.WebSocketPingInterval >= config.WebSocketIdleTimeout {
+		return fmt.Errorf("-websocket-ping-interval must be shorter than -websocket-idle-timeout")
+	}
+
+	if config.BackendMaxConnAge < 0 {
+		return fmt.Errorf("backend max connection age must not be negative")
+	}
+
+	if config.TLSHandshakeTimeout < 0 {
+		return fmt.Errorf("backend TLS handshake timeout must not be negative")
+	}
+
+	if config.IdleConnTimeout < 0 {
+		return fmt.Errorf("backend idle connection timeout must not be negative")
+	}
+
+	if config.MaxIdleConns < 0 {
+		return fmt.Errorf("backend max idle connections must not be negative")
+	}
+
+	if config.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("backend max idle connections per host must be positive")
+	}
+
+	if config.BackendHTTPProxy != "" {
+		proxyURL, err := url.Parse(config.BackendHTTPProxy)
+		if err != nil {
+			return fmt.Errorf("invalid backend HTTP proxy: %v", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid backend HTTP proxy %s: scheme must be http, https or socks5", config.BackendHTTPProxy)
+		}
+		if proxyURL.Host == "" {
+			return fmt.Errorf("invalid backend HTTP proxy %s: missing host", config.BackendHTTPProxy)
+		}
+	}
+
+	if (config.BackendClientCert == "") != (config.BackendClientKey == "") {
+		return fmt.Errorf("-backend-client-cert and -backend-client-key must be set together")
+	}
+	if _, err := backendTLSConfig(config); err != nil {
+		return err
+	}
+
+	if config.ClientWriteTimeout < 0 {
+		return fmt.Errorf("client write timeout must not be negative")
+	}
+
+	if config.ReadTimeout < 0 {
+		return fmt.Errorf("read timeout must not be negative")
+	}
+
+	if config.WriteTimeout < 0 {
+		return fmt.Errorf("write timeout must not be negative")
+	}
+
+	if config.IdleTimeout < 0 {
+		return fmt.Errorf("idle timeout must not be negative")
+	}
+
+	for _, mediaType := range config.AllowedContentTypes {
+		if _, _, err := mime.ParseMediaType(mediaType); err != nil || !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("invalid allowed content type %q", mediaType)
+		}
+	}
+
+	if config.StickyCookie != "" {
+		if err := (&http.Cookie{Name: config.StickyCookie, Value: "x"}).Valid(); err != nil {
+			return fmt.Errorf("invalid sticky cookie name %q", config.StickyCookie)
+		}
+	}
+
+	if config.DecisionLogSize < 0 {
+		return fmt.Errorf("debug decisions size must not be negative")
+	}
+
+	if config.DecisionLogSize > 0 && config.AdminToken == "" {
+		return fmt.Errorf("-debug-decisions requires -admin-token")
+	}
+
+	if config.AccessLog != "" && config.Mode == "tcp" {
+		return fmt.Errorf("-access-log is not supported with -mode tcp")
+	}
 
-	// Validate configuration
-	if err := validateConfig(config); err != nil {
-		log.Fatalf("Configuration error: %v", err)
+	if config.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max concurrent requests must not be negative")
 	}
 
-	// Create load balancer based on algorithm
-	loadBalancer, err := createLoadBalancer(config.Algorithm)
-	if err != nil {
-		log.Fatalf("Error creating load balancer: %v", err)
+	if config.ConcurrencyQueue < 0 {
+		return fmt.Errorf("max concurrent queue must not be negative")
 	}
 
-	// Add backends to load balancer
-	for _, backendURL := range config.Backends {
-		parsedURL, err := url.Parse(backendURL)
-		if err != nil {
-			log.Fatalf("Invalid backend URL %s: %v", backendURL, err)
-		}
+	if config.ConcurrencyQueue > 0 && config.MaxConcurrentRequests == 0 {
+		return fmt.Errorf("-max-concurrent-queue requires -max-concurrent-requests")
+	}
+
+	if config.ConcurrencyQueueTimeout < 0 {
+		return fmt.Errorf("max concurrent queue timeout must not be negative")
+	}
 
-		backend := &balancer.Backend{
-			URL:   parsedURL,
-			Alive: true, // Will be checked by health checker
+	if config.ConcurrencyRetryAfter < 0 {
+		return fmt.Errorf("max concurrent retry after must not be negative")
+	}
+
+	switch config.TrailingSlash {
+	case "", proxy.TrailingSlashAdd, proxy.TrailingSlashStrip:
+	default:
+		return fmt.Errorf("invalid trailing slash mode: %s. Valid options: add, strip", config.TrailingSlash)
+	}
+
+	for _, page := range []struct {
+		flag   string
+		path   string
+		status int
+	}{
+		{"no-backend", config.NoBackendPage, config.NoBackendStatus},
+		{"bad-gateway", config.BadGatewayPage, config.BadGatewayStatus},
+		{"maintenance", config.MaintenancePage, config.MaintenanceStatus},
+	} {
+		// 0 keeps the default status, which for bad-gateway depends on the error
+		if page.status != 0 && (page.status < 400 || page.status > 599) {
+			return fmt.Errorf("-%s-status must be a 4xx or 5xx status code, got %d", page.flag, page.status)
+		}
+		if page.path == "" {
+			continue
 		}
+		if _, err := proxy.LoadErrorPage(page.path, page.status); err != nil {
+			return fmt.Errorf("-%s-page: %v", page.flag, err)
+		}
+	}
 
-		loadBalancer.AddBackend(backend)
-		log.Printf("Added backend: %s", backendURL)
+	if config.CompressionMinSize < 0 {
+		return fmt.Errorf("compression min size must not be negative")
 	}
 
-	// Create health checker
-	healthChecker := balancer.NewHealthChecker(
-		loadBalancer,
-		config.HealthCheckInterval,
-		config.HealthCheckTimeout,
-	)
+	if _, err := proxy.ParseCacheRules(config.CacheControl); err != nil {
+		return err
+	}
 
-	// Start health checking
-	healthChecker.StartHealthCheck()
-	defer healthChecker.StopHealthCheck()
+	if config.CacheSize < 0 {
+		return fmt.Errorf("cache size must not be negative")
+	}
 
-	// Create reverse proxy
-	reverseProxy := proxy.NewReverseProxy(loadBalancer, healthChecker)
+	if config.CacheTTL < 0 {
+		return fmt.Errorf("cache TTL must not be negative")
+	}
 
-	// Create HTTP server
-	server := &http.Server{
-		Addr:         ":" + config.Port,
-		Handler:      reverseProxy,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+	if _, err := proxy.ParseHeaderRules(config.RequestHeaders); err != nil {
+		return fmt.Errorf("request headers: %v", err)
 	}
 
-	// Start server in goroutine
-	go func() {
-		log.Printf("Load balancer starting on port %s", config.Port)
-		log.Printf("Algorithm: %s", config.Algorithm)
-		log.Printf("Backends: %v", config.Backends)
-		log.Printf("Health check interval: %v", config.HealthCheckInterval)
+	if _, err := proxy.ParseHeaderRules(config.ResponseHeaders); err != nil {
+		return fmt.Errorf("response headers: %v", err)
+	}
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+	if _, err := proxy.ParseCORS(config.CORSAllowedOrigins, config.CORSAllowedMethods, config.CORSAllowedHeaders); err != nil {
+		return err
+	}
+
+	if config.StatsDAddr != "" && config.StatsDInterval <= 0 {
+		return fmt.Errorf("statsd interval must be positive")
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive")
+	}
+
+	if config.StateFile != "" && config.StateInterval <= 0 {
+		return fmt.Errorf("state interval must be positive")
+	}
+
+	if config.PassiveFailures < 0 {
+		return fmt.Errorf("passive failures must not be negative")
+	}
+
+	if config.PassiveWindow < 0 {
+		return fmt.Errorf("passive window must not be negative")
+	}
+
+	if config.OutlierErrorRate < 0 || config.OutlierErrorRate > 100 {
+		return fmt.Errorf("outlier error rate must be between 0 and 100")
+	}
+
+	if config.OutlierErrorRate > 0 {
+		if config.OutlierMinRequests < 1 {
+			return fmt.Errorf("outlier min requests must be positive")
 		}
-	}()
+		if config.OutlierWindow <= 0 {
+			return fmt.Errorf("outlier window must be positive")
+		}
+		if config.OutlierCooldown <= 0 {
+			return fmt.Errorf("outlier cooldown must be positive")
+		}
+	}
 
-	// Handle graceful shutdown
-	handleGracefulShutdown(server, healthChecker)
+	if _, err := balancer.ParseMinHealthy(config.MinHealthy); err != nil {
+		return err
+	}
+
+	if config.LogSyslog {
+		if _, ok := syslogFacilities[config.SyslogFacility]; !ok {
+			return fmt.Errorf("invalid syslog facility: %s", config.SyslogFacility)
+		}
+	}
+
+	return nil
 }
 
-// parseFlags parses command line flags and returns configuration
-func parseFlags() *Config {
-	var (
-		port           = flag.String("port", "8080", "Port to listen on")
-		backends       = flag.String("backends", "", "Comma-separated list of backend URLs (e.g., http://localhost:3001,http://localhost:3002)")
-		algorithm      = flag.String("algorithm", "round-robin", "Load balancing algorithm (round-robin, least-connections, ip-hash)")
-		healthInterval = flag.Duration("health-interval", 30*time.Second, "Health check interval")
-		healthTimeout  = flag.Duration("health-timeout", 5*time.Second, "Health check timeout")
-		showHelp       = flag.Bool("help", false, "Show help message")
-	)
+// parseBackendSpec parses a backend given as <url> followed by optional
+// |-separated attributes: a bare number sets the weight, name=<name> a
+// friendly name, max-connections=<n> a connection cap, priority=<n> a
+// failover tier and health-path, health-timeout and health-status override
+// the health check settings, e.g.
+// http://localhost:3001|5|name=api-1|max-connections=100|health-path=/ready.
+// Backends without an explicit weight get a weight of 1.
+func parseBackendSpec(spec string) (*balancer.Backend, error) {
+	rawURL, rawAttrs, hasAttrs := strings.Cut(spec, "|")
 
-	flag.Parse()
+	parsedURL, err := balancer.ParseBackendURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
 
-	if *showHelp {
-		printHelp()
-		os.Exit(0)
+	backend := &balancer.Backend{URL: parsedURL, Weight: 1, Ready: true}
+	if !hasAttrs {
+		return backend, nil
 	}
 
-	var backendList []string
-	if *backends != "" {
-		backendList = strings.Split(*backends, ",")
-		for i, backend := range backendList {
-			backendList[i] = strings.TrimSpace(backend)
+	for _, attr := range strings.Split(rawAttrs, "|") {
+		key, value, isKeyValue := strings.Cut(strings.TrimSpace(attr), "=")
+		switch {
+		case !isKeyValue:
+			backend.Weight, err = strconv.Atoi(key)
+			if err != nil || backend.Weight < 0 {
+				return nil, fmt.Errorf("weight must be a non-negative integer, got %q", attr)
+			}
+		case key == "name":
+			if value == "" {
+				return nil, fmt.Errorf("backend name must not be empty")
+			}
+			backend.Name = value
+		case key == "max-connections":
+			maxConnections, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || maxConnections < 0 {
+				return nil, fmt.Errorf("max-connections must be a non-negative integer, got %q", value)
+			}
+			backend.MaxConnections = int32(maxConnections)
+		case key == "priority":
+			backend.Priority, err = strconv.Atoi(value)
+			if err != nil || backend.Priority < 0 {
+				return nil, fmt.Errorf("priority must be a non-negative integer, got %q", value)
+			}
+		case key == "health-path":
+			if !strings.HasPrefix(value, "/") {
+				return nil, fmt.Errorf("health-path must start with /, got %q", value)
+			}
+			backend.Health.Path = value
+		case key == "health-timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("health-timeout must be a positive duration, got %q", value)
+			}
+			backend.Health.Timeout = timeout
+		case key == "health-status":
+			// Codes are separated by spaces, since commas separate backends
+			expectStatus, err := balancer.ParseStatusSet(strings.Join(strings.Fields(value), ","))
+			if err != nil || len(expectStatus) == 0 {
+				return nil, fmt.Errorf("health-status must list status codes or ranges, got %q", value)
+			}
+			backend.Health.ExpectStatus = expectStatus
+		default:
+			return nil, fmt.Errorf("unknown backend attribute %q", key)
 		}
 	}
 
-	return &Config{
-		Port:                *port,
-		Backends:            backendList,
-		Algorithm:           *algorithm,
-		HealthCheckInterval: *healthInterval,
-		HealthCheckTimeout:  *healthTimeout,
+	return backend, nil
+}
+
+// validateBackendScheme checks that a backend URL suits the proxy mode:
+// tcp://host:port in TCP mode, any other scheme in HTTP mode
+func validateBackendScheme(backendURL *url.URL, mode string) error {
+	switch {
+	case mode == "tcp" && backendURL.Scheme != "tcp":
+		return fmt.Errorf("-mode tcp requires tcp://host:port backends")
+	case mode == "tcp" && backendURL.Port() == "":
+		return fmt.Errorf("tcp backends must include a port")
+	case mode != "tcp" && backendURL.Scheme == "tcp":
+		return fmt.Errorf("tcp:// backends require -mode tcp")
 	}
+	return nil
 }
 
-// validateConfig validates the configuration
-func validateConfig(config *Config) error {
-	if len(config.Backends) == 0 {
-		return fmt.Errorf("at least one backend must be specified")
+// parsePools parses semicolon-separated pools like
+// "api=http://localhost:3001,http://localhost:3002|2;static=http://localhost:3003"
+// into each pool's backend specs
+func parsePools(expr string) (map[string][]string, error) {
+	pools := make(map[string][]string)
+	for _, part := range strings.Split(expr, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		name, list, found := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid pool %q: expected <name>=<backends>", part)
+		}
+		if _, ok := pools[name]; ok {
+			return nil, fmt.Errorf("duplicate pool %s", name)
+		}
+
+		var specs []string
+		for _, spec := range strings.Split(list, ",") {
+			if spec = strings.TrimSpace(spec); spec == "" {
+				continue
+			}
+			backend, err := parseBackendSpec(spec)
+			if err == nil {
+				// Pools route HTTP requests, so they never hold TCP backends
+				err = validateBackendScheme(backend.URL, "http")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid backend %s in pool %s: %v", spec, name, err)
+			}
+			specs = append(specs, spec)
+		}
+		if len(specs) == 0 {
+			return nil, fmt.Errorf("pool %s has no backends", name)
+		}
+		pools[name] = specs
 	}
+	return pools, nil
+}
+
+// addBackends adds the backends given by specs to a balancer, restoring any saved state
+func addBackends(lb balancer.LoadBalancer, specs []string, savedState map[string]balancer.BackendState) {
+	for _, spec := range specs {
+		backend, err := parseBackendSpec(spec)
+		if err != nil {
+			log.Fatalf("Invalid backend %s: %v", spec, err)
+		}
+		backendURL := backend.URL.String()
+		backend.ID = backendURL
+		backend.Alive = true // Will be checked by health checker
 
-	validAlgorithms := map[string]bool{
-		"round-robin":       true,
-		"least-connections": true,
-		"ip-hash":           true,
+		if balancer.RestoreState(backend, savedState) {
+			log.Printf("Restored state for backend %s (alive: %t)", backendURL, backend.Alive)
+		}
+
+		lb.AddBackend(backend)
+		log.Printf("Added backend: %s", backendURL)
 	}
+}
 
-	if !validAlgorithms[config.Algorithm] {
-		return fmt.Errorf("invalid algorithm: %s. Valid options: round-robin, least-connections, ip-hash", config.Algorithm)
+// errorPage loads a custom error page from path, if set, with the given
+// status code. Files are checked by validateConfig, so errors are fatal.
+func errorPage(path string, statusCode int) proxy.ErrorPage {
+	if path == "" {
+		return proxy.ErrorPage{StatusCode: statusCode}
 	}
 
-	if config.HealthCheckInterval <= 0 {
-		return fmt.Errorf("health check interval must be positive")
+	page, err := proxy.LoadErrorPage(path, statusCode)
+	if err != nil {
+		log.Fatalf("Error loading error page: %v", err)
 	}
+	log.Printf("Loaded error page from %s (%s)", path, page.ContentType)
+	return page
+}
 
-	if config.HealthCheckTimeout <= 0 {
-		return fmt.Errorf("health check timeout must be positive")
+// accessLogWriter opens the access log file for appending, or returns nil if the log is off
+func accessLogWriter(path string) io.Writer {
+	switch path {
+	case "":
+		return nil
+	case "-":
+		return os.Stdout
 	}
 
-	return nil
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Error opening access log: %v", err)
+	}
+	log.Printf("Writing access log to %s", path)
+	return file
 }
 
-// createLoadBalancer creates a load balancer based on the specified algorithm
-func createLoadBalancer(algorithm string) (balancer.LoadBalancer, error) {
-	switch algorithm {
+// createLoadBalancer creates a load balancer based on the configured algorithm
+func createLoadBalancer(config *Config) (balancer.LoadBalancer, error) {
+	switch config.Algorithm {
 	case "round-robin":
 		return balancer.NewRoundRobinBalancer(), nil
+	case "weighted-round-robin":
+		return balancer.NewWeightedRoundRobinBalancer(config.SlowStart), nil
 	case "least-connections":
-		return balancer.NewLeastConnectionsBalancer(), nil
+		return balancer.NewLeastConnectionsBalancer(config.LeastConnTieBreak), nil
 	case "ip-hash":
-		return balancer.NewIPHashBalancer(), nil
+		return balancer.NewIPHashBalancer(config.IPHashFallback, config.IPHashRetry), nil
+	case "p2c":
+		return balancer.NewP2CBalancer(), nil
+	case "least-response-time":
+		return balancer.NewLeastResponseTimeBalancer(), nil
+	case "weighted-random":
+		return balancer.NewWeightedRandomBalancer(config.SlowStart), nil
 	default:
-		return nil, fmt.Errorf("unsupported load balancing algorithm: %s", algorithm)
+		return nil, fmt.Errorf("unsupported load balancing algorithm: %s", config.Algorithm)
 	}
 }
 
-// handleGracefulShutdown handles graceful shutdown on OS signals
-func handleGracefulShutdown(server *http.Server, healthChecker balancer.HealthChecker) {
-	// Channel to receive OS signals
-	sigChan := make(chan os.Signal, 1)
+// createAlgorithmOverrides creates a balancer for every algorithm other than
+// the configured one, for per-request overrides. The proxy fills in their
+// backends from the primary balancer.
+func createAlgorithmOverrides(config *Config) map[string]balancer.LoadBalancer {
+	overrides := make(map[string]balancer.LoadBalancer)
+	for _, algorithm := range algorithms {
+		if algorithm == config.Algorithm {
+			continue
+		}
 
-	// Register channel to receive specific signals
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		overrideConfig := *config
+		overrideConfig.Algorithm = algorithm
+		if lb, err := createLoadBalancer(&overrideConfig); err == nil {
+			overrides[algorithm] = lb
+		}
+	}
+	return overrides
+}
 
-	// Wait for signal
-	sig := <-sigChan
+// handleGracefulShutdown handles graceful shutdown on OS signals, waiting up
+// to timeout for in-flight requests to finish. reload is called on SIGHUP.
+func handleGracefulShutdown(server *http.Server, healthChecker balancer.HealthChecker, reverseProxy *proxy.ReverseProxy, timeout time.Duration, reload func()) {
+	sig := waitForSignal(reload)
 	log.Printf("Received signal: %v. Starting graceful shutdown...", sig)
 
 	// Create context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// Stop health checker
 	log.Println("Stopping health checker...")
 	healthChecker.StopHealthCheck()
 
+	// Stop sending new requests to backends
+	reverseProxy.BeginShutdown()
+
+	// Report progress while in-flight requests drain
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if inFlight := reverseProxy.InFlight(); inFlight > 0 {
+					log.Printf("Waiting for %d in-flight requests to finish...", inFlight)
+				}
+			}
+		}
+	}()
+
 	// Shutdown HTTP server
 	log.Println("Shutting down HTTP server...")
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Error during server shutdown: %v", err)
+		log.Printf("Error during server shutdown: %v, abandoning %d in-flight requests", err, reverseProxy.InFlight())
 		return
 	}
 
 	log.Println("Graceful shutdown completed")
 }
 
+// waitForSignal blocks until the process is asked to terminate, calling
+// reload for every SIGHUP received meanwhile
+func waitForSignal(reload func()) os.Signal {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		sig := <-sigChan
+		if sig != syscall.SIGHUP {
+			return sig
+		}
+		reload()
+	}
+}
+
 // printHelp prints usage information
 func printHelp() {
 	fmt.Println("Go Load Balancer - HTTP Reverse Proxy Load Balancer")
@@ -211,13 +1611,93 @@ func printHelp() {
 	fmt.Println("    -port <port>")
 	fmt.Println("        Port to listen on (default: 8080)")
 	fmt.Println()
+	fmt.Println("    -mode <mode>")
+	fmt.Println("        Proxy mode (default: http)")
+	fmt.Println("        http: HTTP reverse proxy")
+	fmt.Println("        tcp:  forward raw TCP connections to tcp://host:port backends, checked")
+	fmt.Println("              by opening a connection; HTTP-only options are ignored")
+	fmt.Println()
 	fmt.Println("    -backends <urls>")
 	fmt.Println("        Comma-separated list of backend URLs")
-	fmt.Println("        Example: http://localhost:3001,http://localhost:3002")
+	fmt.Println("        Append |<weight> to set a backend's weight (default: 1), |name=<name>")
+	fmt.Println("        to give it a friendly name and |max-connections=<n> to cap its")
+	fmt.Println("        concurrent connections. |priority=<n> puts it in a failover tier: tiers")
+	fmt.Println("        with a higher number only get requests while every backend of the")
+	fmt.Println("        lower tiers is unavailable (default: 0, the primary tier)")
+	fmt.Println("        |health-path=<path>, |health-timeout=<duration> and |health-status=<codes>")
+	fmt.Println("        (space-separated) override the health check settings for a backend")
+	fmt.Println("        Example: http://localhost:3001|5|name=api-1,http://localhost:3002")
+	fmt.Println()
+	fmt.Println("    -allow-empty-backends")
+	fmt.Println("        Allow starting with no -backends and adding them later via the admin API;")
+	fmt.Println("        requests get 503 until then. Requires -admin-token")
+	fmt.Println()
+	fmt.Println("    -backends-dns <url>")
+	fmt.Println("        Instead of -backends, resolve the URL's host name and use one backend per")
+	fmt.Println("        A/AAAA record, with the URL's scheme and port. Backend attributes such as")
+	fmt.Println("        |weight apply to each. Example: http://api.default.svc.cluster.local:8080")
+	fmt.Println()
+	fmt.Println("    -backends-dns-interval <duration>")
+	fmt.Println("        How often the -backends-dns name is re-resolved (default: 30s)")
+	fmt.Println()
+	fmt.Println("    -pools <pools>")
+	fmt.Println("        Semicolon-separated named backend pools for -routes, each given as")
+	fmt.Println("        <name>=<backends> in the -backends syntax")
+	fmt.Println("        Example: api=http://localhost:3001,http://localhost:3002;static=http://localhost:3003")
+	fmt.Println()
+	fmt.Println("    -routes <routes>")
+	fmt.Println("        Semicolon-separated <pattern>=<pool> routes sending matching request paths")
+	fmt.Println("        to a pool; the first match wins and other requests use -backends")
+	fmt.Println("        Patterns are path prefixes, or regular expressions when prefixed with ~")
+	fmt.Println("        Example: /api/=api;~\\.(css|js)$=static")
+	fmt.Println()
+	fmt.Println("    -host-routes <routes>")
+	fmt.Println("        Comma-separated <host>=<pool> routes by Host header, checked before -routes")
+	fmt.Println("        Hosts are exact names or *.<domain> wildcards; exact names win over")
+	fmt.Println("        wildcards and longer wildcards over shorter ones")
+	fmt.Println("        Example: api.example.com=api,*.example.com=app")
+	fmt.Println()
+	fmt.Println("    -reject-unknown-hosts")
+	fmt.Println("        Respond 404 to requests whose Host matches no -host-routes rule instead")
+	fmt.Println("        of routing them by path or to -backends")
+	fmt.Println()
+	fmt.Println("    -unmatched-route <action>")
+	fmt.Println("        What happens to requests that match no -routes or -host-routes rule:")
+	fmt.Println("        default sends them to -backends, 404 and 502 answer with that status,")
+	fmt.Println("        and a pool name sends them to that pool (default: default)")
+	fmt.Println("        Each unmatched request is logged")
 	fmt.Println()
 	fmt.Println("    -algorithm <algorithm>")
 	fmt.Println("        Load balancing algorithm (default: round-robin)")
-	fmt.Println("        Options: round-robin, least-connections, ip-hash")
+	fmt.Println("        Options: round-robin, weighted-round-robin, least-connections, ip-hash, p2c,")
+	fmt.Println("        least-response-time, weighted-random")
+	fmt.Println()
+	fmt.Println("    -slow-start <duration>")
+	fmt.Println("        Ramp the weight of a backend that comes back up linearly from near zero")
+	fmt.Println("        to its full weight over this duration; weighted-round-robin and")
+	fmt.Println("        weighted-random only")
+	fmt.Println("        (default: 0, off)")
+	fmt.Println()
+	fmt.Println("    -least-conn-tie-break <strategy>")
+	fmt.Println("        How least-connections picks among equally loaded backends (default: first)")
+	fmt.Println("        Options: first, random, round-robin")
+	fmt.Println()
+	fmt.Println("    -ip-hash-fallback <strategy>")
+	fmt.Println("        How ip-hash picks a backend when the request has no valid client IP")
+	fmt.Println("        (default: round-robin). Options: round-robin, first")
+	fmt.Println()
+	fmt.Println("    -ip-hash-retry <strategy>")
+	fmt.Println("        How ip-hash picks the backend for a retry: next walks on from the client's")
+	fmt.Println("        hashed position, round-robin rotates over the remaining backends")
+	fmt.Println("        (default: next)")
+	fmt.Println()
+	fmt.Println("    -allow-algorithm-override")
+	fmt.Println("        Let trusted proxies route single requests with another algorithm by")
+	fmt.Println("        sending X-LB-Algorithm: <algorithm>. Requires -trusted-proxies")
+	fmt.Println()
+	fmt.Println("    -trusted-proxies <list>")
+	fmt.Println("        Comma-separated IPs and CIDR ranges of trusted proxies")
+	fmt.Println("        Example: 10.0.0.0/8,192.168.1.5")
 	fmt.Println()
 	fmt.Println("    -health-interval <duration>")
 	fmt.Println("        Health check interval (default: 30s)")
@@ -227,6 +1707,387 @@ func printHelp() {
 	fmt.Println("        Health check timeout (default: 5s)")
 	fmt.Println("        Example: 2s, 10s")
 	fmt.Println()
+	fmt.Println("    -health-path <path>")
+	fmt.Println("        Path probed on each backend by health checks (default: /health)")
+	fmt.Println("        Example: /healthz, /ready")
+	fmt.Println()
+	fmt.Println("    -health-ready-path <path>")
+	fmt.Println("        Path probed on backends that pass the health check to decide whether")
+	fmt.Println("        they are ready; backends that are live but not ready get no requests")
+	fmt.Println("        but are not counted as failing (default: off)")
+	fmt.Println("        Example: /ready")
+	fmt.Println()
+	fmt.Println("    -health-method <method>")
+	fmt.Println("        HTTP method used by health checks (default: GET)")
+	fmt.Println("        Example: HEAD")
+	fmt.Println()
+	fmt.Println("    -health-expect-status <codes>")
+	fmt.Println("        Status codes or ranges that count as healthy (default: 200-299)")
+	fmt.Println("        Example: 200,204, 200-399")
+	fmt.Println()
+	fmt.Println("    -health-json-expect <path=value>")
+	fmt.Println("        Require a field of the JSON health response to equal a value")
+	fmt.Println("        Example: .status=UP, .checks.db=ok, .ready=true")
+	fmt.Println()
+	fmt.Println("    -health-concurrency <n>")
+	fmt.Println("        Maximum number of backends health checked at once (default: 10)")
+	fmt.Println()
+	fmt.Println("    -health-max-backoff <duration>")
+	fmt.Println("        Check backends that keep failing less often: after each further failed")
+	fmt.Println("        check the wait doubles, from -health-interval up to this duration, and")
+	fmt.Println("        a passing check resets it (default: 0, off)")
+	fmt.Println()
+	fmt.Println("    -health-body-contains <text>")
+	fmt.Println("        Require the health response body to contain this text")
+	fmt.Println("        Example: '\"ready\":true'")
+	fmt.Println()
+	fmt.Println("    -health-insecure-skip-verify")
+	fmt.Println("        Skip TLS certificate verification for health checks only")
+	fmt.Println("        Proxied traffic still verifies backend certificates")
+	fmt.Println()
+	fmt.Println("    -min-healthy <count|percent>")
+	fmt.Println("        Keep failing backends in rotation instead of dropping below this threshold")
+	fmt.Println("        Example: 2, 50%")
+	fmt.Println()
+	fmt.Println("    -passive-failures <n>")
+	fmt.Println("        Mark a backend down after n consecutive failed requests, without waiting")
+	fmt.Println("        for the next health check (default: 0, off)")
+	fmt.Println()
+	fmt.Println("    -passive-window <duration>")
+	fmt.Println("        Time within which the -passive-failures must occur (default: 10s)")
+	fmt.Println()
+	fmt.Println("    -outlier-error-rate <percent>")
+	fmt.Println("        Eject a backend for -outlier-cooldown when the share of its requests that")
+	fmt.Println("        failed within -outlier-window reaches this percentage (default: 0, off)")
+	fmt.Println()
+	fmt.Println("    -outlier-min-requests <n>")
+	fmt.Println("        Requests a backend must serve within the window before it can be")
+	fmt.Println("        ejected (default: 20)")
+	fmt.Println()
+	fmt.Println("    -outlier-window <duration>")
+	fmt.Println("        Sliding window for outlier error rates (default: 30s)")
+	fmt.Println()
+	fmt.Println("    -outlier-cooldown <duration>")
+	fmt.Println("        How long an ejected backend is kept out of rotation (default: 30s)")
+	fmt.Println()
+	fmt.Println("    -debug-headers")
+	fmt.Println("        Add X-LB-Algorithm and X-LB-Backend-Count headers to every response")
+	fmt.Println()
+	fmt.Println("    -request-id-header <name>")
+	fmt.Println("        Header carrying a unique ID for each proxied request, sent to the")
+	fmt.Println("        backend, returned to the client and prefixed to its log lines. A valid")
+	fmt.Println("        ID sent by the client is reused (default: X-Request-ID, empty = off)")
+	fmt.Println()
+	fmt.Println("    -served-by-header <name>")
+	fmt.Println("        Set this response header to the name, or else the URL, of the backend")
+	fmt.Println("        that served the request, e.g. X-Served-By (default: off)")
+	fmt.Println()
+	fmt.Println("    -admin-token <token>")
+	fmt.Println("        Bearer token required for the /admin/ API")
+	fmt.Println("        The admin API is disabled when no token is set")
+	fmt.Println()
+	fmt.Println("    -debug-decisions <n>")
+	fmt.Println("        Keep the last n routing decisions in memory for GET /debug/decisions")
+	fmt.Println("        (default: 0, off). Requires -admin-token")
+	fmt.Println()
+	fmt.Println("    -access-log <file>")
+	fmt.Println("        Append a JSON line per proxied request to file, or - for stdout,")
+	fmt.Println("        with its status, duration, retries and the backends tried (default: off)")
+	fmt.Println()
+	fmt.Println("    -max-retries <n>")
+	fmt.Println("        Retry a request that fails with a connection error or a -retry-on status")
+	fmt.Println("        on up to n other backends (default: 0). Only idempotent methods are retried")
+	fmt.Println()
+	fmt.Println("    -retry-on <statuses>")
+	fmt.Println("        Backend response statuses that are retried, as codes and ranges such as")
+	fmt.Println("        502,503,504 or 500-599 (default: 502,503,504)")
+	fmt.Println()
+	fmt.Println("    -max-body-size <bytes>")
+	fmt.Println("        Reject requests whose body is larger than this with 413 Request Entity Too Large")
+	fmt.Println("        (default: 0, no limit)")
+	fmt.Println()
+	fmt.Println("    -retry-max-body <bytes>")
+	fmt.Println("        Largest request body buffered in memory for retries (default: 1048576)")
+	fmt.Println("        Requests with larger bodies are streamed and not retried")
+	fmt.Println()
+	fmt.Println("    -retry-spool-max <bytes>")
+	fmt.Println("        Spool bodies larger than -retry-max-body, up to this size, to a temp file")
+	fmt.Println("        so they can be retried (default: 0, disabled)")
+	fmt.Println()
+	fmt.Println("    -retry-spool-dir <path>")
+	fmt.Println("        Directory for spooled request bodies (default: system temp dir)")
+	fmt.Println()
+	fmt.Println("    -retry-non-idempotent")
+	fmt.Println("        Also retry requests with non-idempotent methods such as POST and PATCH")
+	fmt.Println()
+	fmt.Println("    -retry-timeout <mode>")
+	fmt.Println("        How -proxy-timeout applies to retried requests: per-attempt gives every")
+	fmt.Println("        attempt the full timeout, shared makes all attempts share it")
+	fmt.Println("        (default: per-attempt)")
+	fmt.Println()
+	fmt.Println("    -retry-max-time <duration>")
+	fmt.Println("        Cap on the time all attempts of a retried request take together")
+	fmt.Println("        (default: 0, no cap beyond the proxy timeout of each attempt)")
+	fmt.Println()
+	fmt.Println("    -proxy-timeout <duration>")
+	fmt.Println("        Timeout for each proxied request, including the response body (default: 30s)")
+	fmt.Println("        Use 0 for no limit, e.g. for long streaming responses")
+	fmt.Println()
+	fmt.Println("    -websocket-idle-timeout <duration>")
+	fmt.Println("        Close upgraded connections such as WebSockets with no traffic either way")
+	fmt.Println("        for this long (default: 0, never)")
+	fmt.Println()
+	fmt.Println("    -websocket-ping-interval <duration>")
+	fmt.Println("        Send a WebSocket ping to clients this often, keeping quiet sockets open")
+	fmt.Println("        (default: 0, off). Must be shorter than -websocket-idle-timeout")
+	fmt.Println()
+	fmt.Println("    -backend-max-conn-age <duration>")
+	fmt.Println("        Maximum lifetime of a pooled backend connection (default: unlimited)")
+	fmt.Println("        Example: 5m, 1h")
+	fmt.Println()
+	fmt.Println("    -backend-tls-handshake-timeout <duration>")
+	fmt.Println("        Timeout for the TLS handshake with HTTPS backends (default: 10s)")
+	fmt.Println()
+	fmt.Println("    -backend-idle-conn-timeout <duration>")
+	fmt.Println("        Close pooled backend connections idle for longer than this (default: 90s)")
+	fmt.Println()
+	fmt.Println("    -backend-max-idle-conns <n>")
+	fmt.Println("        Maximum idle pooled connections across all backends (default: 100, 0 = unlimited)")
+	fmt.Println()
+	fmt.Println("    -backend-max-idle-conns-per-host <n>")
+	fmt.Println("        Maximum idle pooled connections per backend (default: 32)")
+	fmt.Println()
+	fmt.Println("    -backend-http2")
+	fmt.Println("        Speak HTTP/2 to all backends: h2c with prior knowledge for http://")
+	fmt.Println("        backends, and no fallback to HTTP/1.1 for https:// backends")
+	fmt.Println()
+	fmt.Println("    -backend-http-proxy <url>")
+	fmt.Println("        Send backend connections through this HTTP proxy")
+	fmt.Println("        Overrides the HTTP_PROXY/HTTPS_PROXY environment variables")
+	fmt.Println("        Example: http://proxy.corp:3128")
+	fmt.Println()
+	fmt.Println("    -backend-proxy-from-env")
+	fmt.Println("        Use HTTP_PROXY, HTTPS_PROXY and NO_PROXY for backend connections (default: true)")
+	fmt.Println("        Disable with -backend-proxy-from-env=false")
+	fmt.Println()
+	fmt.Println("    -health-use-proxy")
+	fmt.Println("        Send health checks through the backend proxy too (default: direct)")
+	fmt.Println()
+	fmt.Println("    -backend-client-cert <file>")
+	fmt.Println("        PEM client certificate presented to HTTPS backends for mutual TLS")
+	fmt.Println("        Used for health checks too; requires -backend-client-key")
+	fmt.Println()
+	fmt.Println("    -backend-client-key <file>")
+	fmt.Println("        PEM private key of -backend-client-cert")
+	fmt.Println()
+	fmt.Println("    -backend-ca <file>")
+	fmt.Println("        PEM CA bundle used to verify HTTPS backends (default: system roots)")
+	fmt.Println()
+	fmt.Println("    -backend-insecure-skip-verify")
+	fmt.Println("        Skip TLS certificate verification for backends and health checks")
+	fmt.Println("        For testing only; a warning is logged at startup")
+	fmt.Println()
+	fmt.Println("    -client-write-timeout <duration>")
+	fmt.Println("        Abort a response when a single write to the client blocks this long")
+	fmt.Println("        (default: no limit)")
+	fmt.Println()
+	fmt.Println("    -read-timeout <duration>")
+	fmt.Println("        Maximum time to read a client request, including the body (default: 30s)")
+	fmt.Println("        Use 0 for no limit")
+	fmt.Println()
+	fmt.Println("    -write-timeout <duration>")
+	fmt.Println("        Maximum time to write a response to the client, from the end of the")
+	fmt.Println("        request headers (default: -proxy-timeout plus 5s, or the time all attempts")
+	fmt.Println("        of a retried request may take plus 5s)")
+	fmt.Println("        Use 0 for no limit, e.g. for long-polling clients")
+	fmt.Println()
+	fmt.Println("    -idle-timeout <duration>")
+	fmt.Println("        How long an idle client keep-alive connection is kept open (default: 120s)")
+	fmt.Println("        Use 0 to fall back to -read-timeout")
+	fmt.Println()
+	fmt.Println("    -require-response-headers <list>")
+	fmt.Println("        Comma-separated headers every backend response must have. Responses")
+	fmt.Println("        without them are treated as backend errors (default: none)")
+	fmt.Println()
+	fmt.Println("    -allowed-content-types <list>")
+	fmt.Println("        Comma-separated media types backend responses may have, e.g.")
+	fmt.Println("        application/json,text/*. Others are treated as backend errors (default: any)")
+	fmt.Println()
+	fmt.Println("    -sticky-cookie <name>")
+	fmt.Println("        Pin each client to the backend that served its first request with a")
+	fmt.Println("        cookie of this name, while that backend is alive (default: off)")
+	fmt.Println()
+	fmt.Println("    -max-concurrent-requests <n>")
+	fmt.Println("        Maximum proxied requests in flight at once; more wait in the queue or are")
+	fmt.Println("        rejected with a 503 (default: 0, no limit)")
+	fmt.Println()
+	fmt.Println("    -max-concurrent-queue <n>")
+	fmt.Println("        Requests over the concurrency limit that may wait for a slot; more are")
+	fmt.Println("        rejected with a 503 (default: 0, reject immediately)")
+	fmt.Println()
+	fmt.Println("    -max-concurrent-queue-timeout <duration>")
+	fmt.Println("        Maximum time a queued request waits for a slot before it is rejected")
+	fmt.Println("        (default: 10s, 0 waits until the client gives up)")
+	fmt.Println()
+	fmt.Println("    -max-concurrent-retry-after <duration>")
+	fmt.Println("        Send a Retry-After header, rounded up to whole seconds, with 503s for")
+	fmt.Println("        requests over the concurrency limit (default: 0, omitted)")
+	fmt.Println()
+	fmt.Println("    -preserve-host")
+	fmt.Println("        Send the client's Host header to backends instead of the backend's own")
+	fmt.Println("        host, for backends that route by virtual host")
+	fmt.Println()
+	fmt.Println("    -trailing-slash <mode>")
+	fmt.Println("        Normalize trailing slashes on proxied paths (default: unchanged)")
+	fmt.Println("        Options: add, strip")
+	fmt.Println()
+	fmt.Println("    -collapse-slashes")
+	fmt.Println("        Collapse repeated slashes in proxied paths")
+	fmt.Println()
+	fmt.Println("    -pool-path-normalization <settings>")
+	fmt.Println("        Semicolon-separated path normalization per pool, e.g.")
+	fmt.Println("        api=strip,collapse;static=none. Each pool lists add, strip, collapse")
+	fmt.Println("        or none, replacing -trailing-slash and -collapse-slashes for it")
+	fmt.Println()
+	fmt.Println("    -read-only")
+	fmt.Println("        Start in read-only mode (toggle at runtime via /admin/read-only)")
+	fmt.Println()
+	fmt.Println("    -read-only-safe-methods <methods>")
+	fmt.Println("        Methods still proxied in read-only mode (default: GET,HEAD,OPTIONS)")
+	fmt.Println()
+	fmt.Println("    -maintenance")
+	fmt.Println("        Start in maintenance mode, answering all proxied requests without")
+	fmt.Println("        contacting backends (toggle at runtime via /admin/maintenance)")
+	fmt.Println()
+	fmt.Println("    -maintenance-page <file>")
+	fmt.Println("        Serve this file instead of the plain-text response in maintenance mode;")
+	fmt.Println("        the content type follows the file extension")
+	fmt.Println()
+	fmt.Println("    -maintenance-status <code>")
+	fmt.Println("        Status code sent in maintenance mode (default: 503)")
+	fmt.Println()
+	fmt.Println("    -no-backend-page <file>")
+	fmt.Println("        Serve this file instead of the plain-text error when no healthy backend")
+	fmt.Println("        is available; the content type follows the file extension")
+	fmt.Println()
+	fmt.Println("    -no-backend-status <code>")
+	fmt.Println("        Status code sent when no healthy backend is available (default: 503)")
+	fmt.Println()
+	fmt.Println("    -bad-gateway-page <file>")
+	fmt.Println("        Serve this file instead of the plain-text error when a backend request")
+	fmt.Println("        fails; the content type follows the file extension")
+	fmt.Println()
+	fmt.Println("    -bad-gateway-status <code>")
+	fmt.Println("        Status code sent when a backend request fails, whether it timed out or")
+	fmt.Println("        not (default: 502, or 504 Gateway Timeout if it timed out)")
+	fmt.Println()
+	fmt.Println("    -status-page")
+	fmt.Println("        Serve an auto-refreshing HTML dashboard of the backends on /status")
+	fmt.Println()
+	fmt.Println("    -runtime-metrics")
+	fmt.Println("        Include Go runtime metrics (goroutines, heap, GC, file descriptors) in /stats")
+	fmt.Println()
+	fmt.Println("    -statsd-addr <host:port>")
+	fmt.Println("        Push metrics to a StatsD/DogStatsD server over UDP")
+	fmt.Println()
+	fmt.Println("    -statsd-prefix <prefix>")
+	fmt.Println("        Prefix for StatsD metric names (default: lb.)")
+	fmt.Println()
+	fmt.Println("    -statsd-tags <tags>")
+	fmt.Println("        Comma-separated key:value tags added to every metric")
+	fmt.Println("        Example: env:prod,region:eu-west-1")
+	fmt.Println()
+	fmt.Println("    -statsd-interval <duration>")
+	fmt.Println("        Interval for pushing backend gauges (default: 10s)")
+	fmt.Println()
+	fmt.Println("    -state-file <path>")
+	fmt.Println("        Persist backend health state to this file and restore it at startup")
+	fmt.Println()
+	fmt.Println("    -state-interval <duration>")
+	fmt.Println("        Interval between state snapshots (default: 30s)")
+	fmt.Println()
+	fmt.Println("    -state-ttl <duration>")
+	fmt.Println("        Ignore a state file older than this at startup (default: 10m)")
+	fmt.Println()
+	fmt.Println("    -shutdown-timeout <duration>")
+	fmt.Println("        Maximum time to wait for in-flight requests after SIGINT/SIGTERM before")
+	fmt.Println("        exiting anyway (default: 30s)")
+	fmt.Println()
+	fmt.Println("    -log-syslog")
+	fmt.Println("        Send log output to syslog instead of stderr")
+	fmt.Println("        Falls back to stderr if syslog is unavailable")
+	fmt.Println()
+	fmt.Println("    -syslog-addr <address>")
+	fmt.Println("        Remote syslog server as [network://]host:port (default: local syslog)")
+	fmt.Println("        Example: udp://logs.internal:514, tcp://10.0.0.5:601")
+	fmt.Println()
+	fmt.Println("    -syslog-facility <facility>")
+	fmt.Println("        Syslog facility (default: daemon)")
+	fmt.Println("        Options: daemon, user, local0-local7")
+	fmt.Println()
+	fmt.Println("    -enable-compression")
+	fmt.Println("        Gzip responses for clients that send Accept-Encoding: gzip, unless the")
+	fmt.Println("        backend already encoded them")
+	fmt.Println()
+	fmt.Println("    -compression-min-size <bytes>")
+	fmt.Println("        Smallest response body gzipped; bodies of unknown length are always")
+	fmt.Println("        compressed (default: 1024)")
+	fmt.Println()
+	fmt.Println("    -always-flush")
+	fmt.Println("        Flush every response to the client as it arrives from the backend;")
+	fmt.Println("        responses of unknown length and event streams are always flushed")
+	fmt.Println()
+	fmt.Println("    -cache-control <rules>")
+	fmt.Println("        Set Cache-Control on responses to matching paths, overriding the backend")
+	fmt.Println("        Rules are <pattern>=<value> separated by semicolons; first match wins")
+	fmt.Println("        A pattern ending in * matches any path with that prefix")
+	fmt.Println("        Example: '/api/*=no-store;/account/*=private, no-cache'")
+	fmt.Println()
+	fmt.Println("    -cache-size <n>")
+	fmt.Println("        Cache up to n GET responses in memory and answer repeated identical")
+	fmt.Println("        requests from the cache, least recently used evicted first (default: off)")
+	fmt.Println()
+	fmt.Println("    -cache-ttl <duration>")
+	fmt.Println("        How long to cache responses without max-age or s-maxage (default: 1m)")
+	fmt.Println("        0 only caches responses that set one")
+	fmt.Println()
+	fmt.Println("    -request-headers <rules>")
+	fmt.Println("        Add, set or remove headers on requests sent to backends")
+	fmt.Println("        Rules are add:<name>=<value>, set:<name>=<value> or remove:<name>,")
+	fmt.Println("        separated by semicolons and applied in order")
+	fmt.Println("        Example: 'remove:X-Internal-Token;set:X-Proxied-By=go-load-balancer'")
+	fmt.Println()
+	fmt.Println("    -response-headers <rules>")
+	fmt.Println("        Add, set or remove headers on backend responses, with the same syntax")
+	fmt.Println("        as -request-headers")
+	fmt.Println()
+	fmt.Println("    -cors-allowed-origins <origins>")
+	fmt.Println("        Answer CORS preflight requests and add Access-Control-Allow-Origin")
+	fmt.Println("        to responses for these comma-separated origins, or * for any")
+	fmt.Println("        Example: 'https://app.example.com,https://admin.example.com'")
+	fmt.Println()
+	fmt.Println("    -cors-allowed-methods <methods>")
+	fmt.Printf("        Methods allowed in cross-origin requests (default: %s)\n", proxy.DefaultCORSMethods)
+	fmt.Println()
+	fmt.Println("    -cors-allowed-headers <headers>")
+	fmt.Println("        Request headers allowed in cross-origin requests, or * for any")
+	fmt.Printf("        (default: %s)\n", proxy.DefaultCORSHeaders)
+	fmt.Println()
+	fmt.Println("    -startup-check")
+	fmt.Println("        Before serving, report for each backend whether the host is reachable")
+	fmt.Println("        and whether its health check passes")
+	fmt.Println()
+	fmt.Println("    -check-config")
+	fmt.Println("        Validate the flags and config file, print a summary of the backends,")
+	fmt.Println("        algorithm and timeouts, and exit: 0 if the configuration is valid, 1")
+	fmt.Println("        otherwise. Nothing is started and no port is bound. With -startup-check,")
+	fmt.Println("        the backends are diagnosed too and any failing one exits with 1")
+	fmt.Println()
+	fmt.Println("    -config <path>")
+	fmt.Println("        Load settings from a JSON file keyed by flag name (without the dash)")
+	fmt.Println("        Flags given on the command line override values from the file")
+	fmt.Println("        On SIGHUP, backends and pools are reloaded from the file")
+	fmt.Println()
 	fmt.Println("    -help")
 	fmt.Println("        Show this help message")
 	fmt.Println()
@@ -237,6 +2098,9 @@ func printHelp() {
 	fmt.Println("    # Use least-connections algorithm on port 9000")
 	fmt.Println("    go-load-balancer -port 9000 -algorithm least-connections -backends http://localhost:3001,http://localhost:3002")
 	fmt.Println()
+	fmt.Println("    # Send five times as much traffic to the first backend")
+	fmt.Println("    go-load-balancer -algorithm weighted-round-robin -backends 'http://localhost:3001|5,http://localhost:3002|1'")
+	fmt.Println()
 	fmt.Println("    # Use IP hash with custom health check settings")
 	fmt.Println("    go-load-balancer -algorithm ip-hash -health-interval 10s -health-timeout 2s -backends http://localhost:3001,http://localhost:3002")
 	fmt.Println()
@@ -244,4 +2108,19 @@ func printHelp() {
 	fmt.Println("    GET /health")
 	fmt.Println("        Load balancer health check endpoint")
 	fmt.Println("        Shows status of all backend servers")
+	fmt.Println()
+	fmt.Println("    GET /stats")
+	fmt.Println("        Internal load balancer statistics")
+	fmt.Println()
+	fmt.Println("    GET|PUT /admin/health-check")
+	fmt.Println("        Show or change the health check interval and timeout (requires -admin-token)")
+	fmt.Println()
+	fmt.Println("    GET|PUT /admin/read-only")
+	fmt.Println("        Show or toggle read-only mode (requires -admin-token)")
+	fmt.Println()
+	fmt.Println("    GET|PUT /admin/maintenance")
+	fmt.Println("        Show or toggle maintenance mode (requires -admin-token)")
+	fmt.Println()
+	fmt.Println("    GET /debug/decisions")
+	fmt.Println("        Recent routing decisions (requires -admin-token and -debug-decisions)")
 }
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"go-load-balancer/balancer"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// accessLogEntry is the JSON line written to the access log for a proxied request
+type accessLogEntry struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id,omitempty"`
+	ClientIP      string    `json:"client_ip"`
+	Method        string    `json:"method"`
+	Host          string    `json:"host"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	Bytes         int64     `json:"bytes"`
+	DurationMs    float64   `json:"duration_ms"`
+	Retries       int       `json:"retries"`
+	TriedBackends []string  `json:"tried_backends,omitempty"`
+	FinalBackend  string    `json:"final_backend,omitempty"`
+}
+
+// accessLog writes one JSON line per proxied request. A nil *accessLog writes nothing.
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newAccessLog returns an access log writing to w, or nil if w is nil
+func newAccessLog(w io.Writer) *accessLog {
+	if w == nil {
+		return nil
+	}
+	return &accessLog{w: w}
+}
+
+// accessWriter records what the access log reports about a response as it is written
+type accessWriter struct {
+	http.ResponseWriter
+	start  time.Time
+	status int
+	bytes  int64
+	tried  []*balancer.Backend
+}
+
+// track wraps w to record the response for the access log, or returns w and
+// nil if the log is off
+func (al *accessLog) track(w http.ResponseWriter) (http.ResponseWriter, *accessWriter) {
+	if al == nil {
+		return w, nil
+	}
+	aw := &accessWriter{ResponseWriter: w, start: time.Now()}
+	return aw, aw
+}
+
+func (aw *accessWriter) WriteHeader(statusCode int) {
+	// Informational responses such as 100 Continue are followed by the real one
+	if aw.status == 0 && statusCode >= 200 {
+		aw.status = statusCode
+	}
+	aw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (aw *accessWriter) Write(p []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(p)
+	aw.bytes += int64(n)
+	return n, err
+}
+
+// Hijack hands over the connection of an upgraded request, which is logged as switching protocols
+func (aw *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(aw.ResponseWriter).Hijack()
+	if err == nil {
+		aw.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (aw *accessWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// try records an attempt of the request on a backend
+func (aw *accessWriter) try(backend *balancer.Backend) {
+	if aw != nil {
+		aw.tried = append(aw.tried, backend)
+	}
+}
+
+// write logs a finished request. Every backend it was sent to is listed in
+// tried_backends, in order; the last one produced the response.
+func (al *accessLog) write(aw *accessWriter, r *http.Request) {
+	if al == nil {
+		return
+	}
+
+	entry := accessLogEntry{
+		Time:       aw.start,
+		ClientIP:   r.RemoteAddr,
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Status:     aw.status,
+		Bytes:      aw.bytes,
+		DurationMs: float64(time.Since(aw.start)) / float64(time.Millisecond),
+		Retries:    max(len(aw.tried)-1, 0),
+	}
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK // nothing was written, so the server sends an empty 200
+	}
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		entry.RequestID = id
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.ClientIP = host
+	}
+	for _, backend := range aw.tried {
+		entry.TriedBackends = append(entry.TriedBackends, backend.URL.String())
+	}
+	if len(aw.tried) > 0 {
+		entry.FinalBackend = aw.tried[len(aw.tried)-1].URL.String()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	al.mu.Lock()
+	al.w.Write(append(line, '\n'))
+	al.mu.Unlock()
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAccessLogRetries(t *testing.T) {
+	dead := newDeadBackend(t)
+	live := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	var buf bytes.Buffer
+	rp := newTestProxy(Options{MaxRetries: 1, AccessLog: &buf}, dead, live)
+	if resp := serve(rp, httptest.NewRequest("GET", "/orders", nil)); resp.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200 from the retry", resp.Code)
+	}
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log line %q: %v", buf.String(), err)
+	}
+	tried := []string{dead.URL.String(), live.URL.String()}
+	if entry.Status != http.StatusOK || entry.Path != "/orders" || entry.Bytes != 2 {
+		t.Errorf("got status %d, path %q and %d bytes, want 200, /orders and 2", entry.Status, entry.Path, entry.Bytes)
+	}
+	if entry.Retries != 1 || !slices.Equal(entry.TriedBackends, tried) || entry.FinalBackend != live.URL.String() {
+		t.Errorf("got %d retries over %v ending on %s, want 1 over %v ending on %s",
+			entry.Retries, entry.TriedBackends, entry.FinalBackend, tried, live.URL)
+	}
+}
+
+func TestAccessLogWithoutBackend(t *testing.T) {
+	var buf bytes.Buffer
+	rp := newTestProxy(Options{AccessLog: &buf})
+	if resp := serve(rp, httptest.NewRequest("GET", "/", nil)); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503 without backends", resp.Code)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log line %q: %v", buf.String(), err)
+	}
+	if entry["status"] != float64(http.StatusServiceUnavailable) || entry["retries"] != float64(0) {
+		t.Errorf("got status %v and %v retries, want 503 and 0", entry["status"], entry["retries"])
+	}
+	for _, field := range []string{"tried_backends", "final_backend"} {
+		if _, ok := entry[field]; ok {
+			t.Errorf("got %s without a backend, want it left out", field)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"go-load-balancer/balancer"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// handleAdmin authenticates and dispatches admin API requests
+func (rp *ReverseProxy) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	// The admin API is disabled unless a token is configured
+	if rp.options.AdminToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(rp.options.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Rejected unauthorized admin request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/admin/health-check":
+		rp.handleAdminHealthCheck(w, r)
+	case "/admin/read-only":
+		rp.handleAdminReadOnly(w, r)
+	case "/admin/maintenance":
+		rp.handleAdminMaintenance(w, r)
+	case "/admin/backends":
+		rp.handleAdminBackends(w, r)
+	case "/admin/backends/drain":
+		rp.handleAdminDrain(w, r)
+	case DecisionsPath:
+		rp.handleDecisions(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// healthCheckTiming is the admin representation of health check timing
+type healthCheckTiming struct {
+	Interval string `json:"interval"`
+	Timeout  string `json:"timeout"`
+}
+
+// handleAdminHealthCheck reports or changes the health check interval and timeout
+func (rp *ReverseProxy) handleAdminHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if rp.healthChecker == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		interval, timeout := rp.healthChecker.Timing()
+
+		var update healthCheckTiming
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if update.Interval != "" {
+			if interval, err = time.ParseDuration(update.Interval); err != nil {
+				http.Error(w, "Invalid interval: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if update.Timeout != "" {
+			if timeout, err = time.ParseDuration(update.Timeout); err != nil {
+				http.Error(w, "Invalid timeout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := rp.healthChecker.UpdateTiming(interval, timeout); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	interval, timeout := rp.healthChecker.Timing()
+	writeJSON(w, http.StatusOK, healthCheckTiming{
+		Interval: interval.String(),
+		Timeout:  timeout.String(),
+	})
+}
+
+// modeToggle is the admin representation of an on/off mode
+type modeToggle struct {
+	Enabled bool `json:"enabled"`
+}
+
+// handleAdminReadOnly reports or toggles read-only mode
+func (rp *ReverseProxy) handleAdminReadOnly(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var update modeToggle
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rp.readOnly.Swap(update.Enabled) != update.Enabled {
+			if update.Enabled {
+				log.Printf("Read-only mode enabled: only %s requests are proxied", strings.Join(rp.options.SafeMethods, ", "))
+			} else {
+				log.Println("Read-only mode disabled")
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, modeToggle{Enabled: rp.readOnly.Load()})
+}
+
+// handleAdminMaintenance reports or toggles maintenance mode
+func (rp *ReverseProxy) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var update modeToggle
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rp.maintenance.Swap(update.Enabled) != update.Enabled {
+			if update.Enabled {
+				log.Println("Maintenance mode enabled: no requests are proxied")
+			} else {
+				log.Println("Maintenance mode disabled")
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, modeToggle{Enabled: rp.maintenance.Load()})
+}
+
+// adminBackend is the admin representation of a backend
+type adminBackend struct {
+	URL            string `json:"url"`
+	Name           string `json:"name,omitempty"`
+	Weight         *int   `json:"weight,omitempty"`
+	MaxConnections int32  `json:"max_connections,omitempty"`
+	Priority       int    `json:"priority,omitempty"`
+	Alive          bool   `json:"alive"`
+	Ready          bool   `json:"ready"`
+	Draining       bool   `json:"draining"`
+	Connections    int32  `json:"connections"`
+	Dynamic        bool   `json:"dynamic"`
+}
+
+// newAdminBackend describes a backend for admin responses
+func newAdminBackend(backend *balancer.Backend) adminBackend {
+	weight := backend.Weight
+	return adminBackend{
+		URL:            backend.URL.String(),
+		Name:           backend.Name,
+		Weight:         &weight,
+		MaxConnections: backend.MaxConnections,
+		Priority:       backend.Priority,
+		Alive:          backend.Alive,
+		Ready:          backend.Ready,
+		Draining:       backend.Draining,
+		Connections:    atomic.LoadInt32(&backend.Connections),
+		Dynamic:        backend.Dynamic,
+	}
+}
+
+// handleAdminBackends lists, adds or removes backends
+func (rp *ReverseProxy) handleAdminBackends(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		backends := make([]adminBackend, 0)
+		for _, backend := range rp.loadBalancer.GetBackends() {
+			backends = append(backends, newAdminBackend(backend))
+		}
+		writeJSON(w, http.StatusOK, backends)
+	case http.MethodPost:
+		rp.addBackend(w, r)
+	case http.MethodDelete:
+		rp.removeBackend(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addBackend adds a backend given as {"url": ..., "weight": ..., "name": ...,
+// "max_connections": ..., "priority": ...}. The backend is health checked before it is put
+// into rotation.
+func (rp *ReverseProxy) addBackend(w http.ResponseWriter, r *http.Request) {
+	var request adminBackend
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	backendURL, err := balancer.ParseBackendURL(request.URL)
+	if err == nil && rp.options.ValidateBackendURL != nil {
+		err = rp.options.ValidateBackendURL(backendURL)
+	}
+	if err != nil {
+		http.Error(w, "Invalid backend URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	weight := 1
+	if request.Weight != nil {
+		if *request.Weight < 0 {
+			http.Error(w, "Weight must not be negative", http.StatusBadRequest)
+			return
+		}
+		weight = *request.Weight
+	}
+	if request.MaxConnections < 0 {
+		http.Error(w, "Max connections must not be negative", http.StatusBadRequest)
+		return
+	}
+	if request.Priority < 0 {
+		http.Error(w, "Priority must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	backend := &balancer.Backend{
+		ID:             backendURL.String(),
+		Name:           request.Name,
+		URL:            backendURL,
+		Weight:         weight,
+		MaxConnections: request.MaxConnections,
+		Priority:       request.Priority,
+		Ready:          true,
+		Dynamic:        true,
+	}
+
+	if rp.loadBalancer.GetBackend(backend.ID) != nil {
+		http.Error(w, "Backend already exists", http.StatusConflict)
+		return
+	}
+
+	// Without a health checker, backends are trusted to be up
+	rp.loadBalancer.AddBackend(backend)
+	alive := true
+	if rp.healthChecker != nil {
+		alive = rp.healthChecker.CheckHealth(backend)
+	}
+	rp.loadBalancer.UpdateBackendStatus(backend, alive)
+	log.Printf("Added backend via admin API: %s (alive: %t)", backend.URL.String(), alive)
+
+	writeJSON(w, http.StatusCreated, newAdminBackend(backend))
+}
+
+// removeBackend removes the backend given by the url query parameter
+func (rp *ReverseProxy) removeBackend(w http.ResponseWriter, r *http.Request) {
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" {
+		http.Error(w, "Missing url parameter", http.StatusBadRequest)
+		return
+	}
+
+	backend := rp.loadBalancer.GetBackend(rawURL)
+	if backend == nil {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	rp.loadBalancer.RemoveBackend(backend)
+	log.Printf("Removed backend via admin API: %s", backend.URL.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// drainRequest starts or stops draining a backend
+type drainRequest struct {
+	URL      string `json:"url"`
+	Draining bool   `json:"draining"`
+}
+
+// handleAdminDrain takes a backend out of rotation for new requests, or puts
+// it back, given as {"url": ..., "draining": true|false}
+func (rp *ReverseProxy) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request drainRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	backend := rp.loadBalancer.GetBackend(request.URL)
+	if backend == nil {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	if backend.Draining != request.Draining {
+		rp.loadBalancer.UpdateBackendDraining(backend, request.Draining)
+		if request.Draining {
+			log.Printf("Draining backend via admin API: %s (%d connections in flight)", backend.URL.String(), atomic.LoadInt32(&backend.Connections))
+			if atomic.LoadInt32(&backend.Connections) == 0 {
+				log.Printf("Backend %s is drained and safe to remove", backend.URL.String())
+			}
+		} else {
+			log.Printf("Backend returned to rotation via admin API: %s", backend.URL.String())
+		}
+	}
+
+	writeJSON(w, http.StatusOK, newAdminBackend(backend))
+}
+
+// writeJSON writes an indented JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAddBackendValidatesURL(t *testing.T) {
+	rp := newTestProxy(Options{
+		AdminToken: "secret",
+		ValidateBackendURL: func(backendURL *url.URL) error {
+			if backendURL.Scheme == "tcp" {
+				return errors.New("tcp:// backends require -mode tcp")
+			}
+			return nil
+		},
+	})
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"tcp://10.0.0.1:9000", http.StatusBadRequest},
+		{"http://10.0.0.1:8080", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/admin/backends", strings.NewReader(`{"url":"`+tt.url+`"}`))
+		r.Header.Set("Authorization", "Bearer secret")
+		if got := serve(rp, r).Code; got != tt.want {
+			t.Errorf("adding %s: got status %d, want %d", tt.url, got, tt.want)
+		}
+	}
+
+	backends := rp.loadBalancer.GetBackends()
+	if len(backends) != 1 || !backends[0].Dynamic {
+		t.Errorf("got backends %v, want only the http one, marked dynamic", backends)
+	}
+}
@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long responses without max-age are cached when no TTL is configured
+const DefaultCacheTTL = time.Minute
+
+// maxCachedBodySize is the largest response body kept in the response cache
+const maxCachedBodySize = 1 << 20
+
+// cachedResponse is a backend response kept for repeated identical requests
+type cachedResponse struct {
+	key     string
+	vary    map[string]string // request header values the response varies on
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache keeps successful GET responses in memory, evicting the least
+// recently used once full. A nil *responseCache caches nothing.
+type responseCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+}
+
+// newResponseCache returns a cache of up to size responses, or nil if size is
+// not positive. Responses without max-age are kept for ttl (0 skips them).
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	if size <= 0 {
+		return nil
+	}
+	return &responseCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// cacheable reports whether a request may be answered from, or its response
+// kept in, the cache. Requests with credentials are never cached, since
+// the cache is shared by all clients.
+func (rc *responseCache) cacheable(r *http.Request) bool {
+	if rc == nil || r.Method != http.MethodGet || isUpgradeRequest(r) {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+		return false
+	}
+	return !hasCacheDirective(r.Header, "no-store")
+}
+
+// lookup returns the fresh cached response for a request, if any. Clients
+// sending "Cache-Control: no-cache" always get a response from a backend.
+func (rc *responseCache) lookup(r *http.Request) *cachedResponse {
+	if !rc.cacheable(r) || hasCacheDirective(r.Header, "no-cache") {
+		return nil
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[cacheKey(r)]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cachedResponse)
+	if time.Now().After(entry.expires) {
+		rc.remove(element)
+		return nil
+	}
+	for name, value := range entry.vary {
+		if strings.Join(r.Header.Values(name), ", ") != value {
+			return nil
+		}
+	}
+
+	rc.lru.MoveToFront(element)
+	return entry
+}
+
+// capture starts recording a backend response for the cache, returning nil
+// if it may not be cached: only complete 200 responses without cookies or
+// trailers, whose Cache-Control allows shared caching, are kept
+func (rc *responseCache) capture(r *http.Request, resp *http.Response) *cacheCapture {
+	if !rc.cacheable(r) || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	if len(resp.Header.Values("Set-Cookie")) > 0 || len(resp.Trailer) > 0 || resp.ContentLength > maxCachedBodySize {
+		return nil
+	}
+
+	lifetime, ok := cacheLifetime(resp.Header, rc.ttl)
+	if !ok {
+		return nil
+	}
+
+	vary := make(map[string]string)
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				vary[name] = strings.Join(r.Header.Values(name), ", ")
+			}
+		}
+	}
+
+	header := resp.Header.Clone()
+	removeHopByHopHeaders(header)
+	now := time.Now()
+	return &cacheCapture{
+		cache: rc,
+		entry: &cachedResponse{
+			key:     cacheKey(r),
+			vary:    vary,
+			header:  header,
+			stored:  now,
+			expires: now.Add(lifetime),
+		},
+	}
+}
+
+// store adds a captured response, evicting the least recently used ones
+// beyond the cache size
+func (rc *responseCache) store(entry *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if element, ok := rc.entries[entry.key]; ok {
+		rc.remove(element)
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+	for rc.lru.Len() > rc.size {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// remove deletes an entry; the caller must hold rc.mu
+func (rc *responseCache) remove(element *list.Element) {
+	rc.lru.Remove(element)
+	delete(rc.entries, element.Value.(*cachedResponse).key)
+}
+
+// cacheCapture collects a response body as it is relayed to the client
+type cacheCapture struct {
+	cache    *responseCache
+	entry    *cachedResponse
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+// Write records body bytes, giving up once the body exceeds maxCachedBodySize
+func (cc *cacheCapture) Write(p []byte) (int, error) {
+	if cc.tooLarge || cc.body.Len()+len(p) > maxCachedBodySize {
+		cc.tooLarge = true
+		cc.body.Reset()
+		return len(p), nil
+	}
+	return cc.body.Write(p)
+}
+
+// finish stores the captured response once its whole body was relayed
+func (cc *cacheCapture) finish() {
+	if cc == nil || cc.tooLarge {
+		return
+	}
+	cc.entry.body = cc.body.Bytes()
+	cc.cache.store(cc.entry)
+}
+
+// cacheKey identifies requests answered by the same cached response
+func cacheKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.RequestURI()
+}
+
+// cacheLifetime returns how long a response may be cached according to its
+// Cache-Control header: s-maxage or max-age if given, ttl otherwise. It
+// reports false for responses that must not be kept in a shared cache.
+func cacheLifetime(header http.Header, ttl time.Duration) (time.Duration, bool) {
+	maxAge, sharedMaxAge := -1, -1
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+			switch name {
+			case "no-store", "no-cache", "private":
+				return 0, false
+			case "max-age", "s-maxage":
+				seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+				if err != nil {
+					return 0, false
+				}
+				if name == "max-age" {
+					maxAge = seconds
+				} else {
+					sharedMaxAge = seconds
+				}
+			}
+		}
+	}
+
+	lifetime := ttl
+	if sharedMaxAge >= 0 {
+		lifetime = time.Duration(sharedMaxAge) * time.Second
+	} else if maxAge >= 0 {
+		lifetime = time.Duration(maxAge) * time.Second
+	}
+	return lifetime, lifetime > 0
+}
+
+// hasCacheDirective reports whether a Cache-Control header contains a directive
+func hasCacheDirective(header http.Header, directive string) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveCached answers a request from the cache, applying the same response
+// header rules and compression as for proxied responses
+func (rp *ReverseProxy) serveCached(w http.ResponseWriter, r *http.Request, entry *cachedResponse) {
+	for name, values := range entry.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	rp.setRequestID(w.Header(), r)
+	rp.applyCacheRules(w.Header(), r.URL.Path)
+	rp.options.CORS.apply(w.Header(), r)
+	rp.options.ResponseHeaders.apply(w.Header())
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+	w.Header().Set("X-Cache", "HIT")
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: entry.header, ContentLength: int64(len(entry.body))}
+	compress := rp.negotiateCompression(w.Header(), r, resp)
+	w.WriteHeader(http.StatusOK)
+	if err := copyBody(w, bytes.NewReader(entry.body), compress, false); err != nil {
+		logRequest(r, "Error writing cached response: %v", err)
+		return
+	}
+
+	logRequest(r, "Served %s %s from cache", r.Method, r.URL.Path)
+	rp.options.StatsD.Count("requests.cache_hits", 1)
+}
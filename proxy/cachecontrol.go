@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CacheRule sets the Cache-Control header on responses to matching paths
+type CacheRule struct {
+	// Pattern is an exact path, or a path prefix when it ends in "*"
+	Pattern string
+
+	// Value is the Cache-Control header value, e.g. "no-store"
+	Value string
+}
+
+// ParseCacheRules parses semicolon-separated rules like
+// "/api/*=no-store;/account/*=private, no-cache". Rules are matched in order.
+func ParseCacheRules(expr string) ([]CacheRule, error) {
+	var rules []CacheRule
+	for _, part := range strings.Split(expr, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		pattern, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid cache rule %q: expected <pattern>=<cache-control>", part)
+		}
+
+		pattern, value = strings.TrimSpace(pattern), strings.TrimSpace(value)
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid cache rule %q: pattern must start with /", part)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("invalid cache rule %q: empty Cache-Control value", part)
+		}
+
+		rules = append(rules, CacheRule{Pattern: pattern, Value: value})
+	}
+	return rules, nil
+}
+
+// Matches reports whether the rule applies to a request path
+func (cr CacheRule) Matches(requestPath string) bool {
+	if prefix, ok := strings.CutSuffix(cr.Pattern, "*"); ok {
+		return strings.HasPrefix(requestPath, prefix)
+	}
+	return requestPath == cr.Pattern
+}
+
+// applyCacheRules overrides Cache-Control using the first rule matching the request path
+func (rp *ReverseProxy) applyCacheRules(header http.Header, requestPath string) {
+	for _, rule := range rp.options.CacheRules {
+		if rule.Matches(requestPath) {
+			header.Set("Cache-Control", rule.Value)
+			return
+		}
+	}
+}
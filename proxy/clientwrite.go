@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// slowClientThreshold is how long a single write to the client may block
+// before the request is counted as held up by a slow client
+const slowClientThreshold = time.Second
+
+// ClientWriteStats counts requests held up writing the response to the client
+type ClientWriteStats struct {
+	Slow     int64 `json:"slow"`
+	TimedOut int64 `json:"timed_out"`
+}
+
+// clientWriteStats accumulates ClientWriteStats across requests
+type clientWriteStats struct {
+	slow     atomic.Int64
+	timedOut atomic.Int64
+}
+
+// Snapshot returns the current counts
+func (cs *clientWriteStats) Snapshot() ClientWriteStats {
+	return ClientWriteStats{
+		Slow:     cs.slow.Load(),
+		TimedOut: cs.timedOut.Load(),
+	}
+}
+
+// clientWriter copies a response body to the client. Each write gets its own
+// deadline when a timeout is set, so a client that keeps reading is never cut
+// off while one that stops reading releases the backend connection. Streaming
+// responses are flushed after every write.
+type clientWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+	flush      bool
+	slow       bool
+	timedOut   bool
+}
+
+func newClientWriter(w http.ResponseWriter, timeout time.Duration, flush bool) *clientWriter {
+	return &clientWriter{
+		w:          w,
+		controller: http.NewResponseController(w),
+		timeout:    timeout,
+		flush:      flush,
+	}
+}
+
+func (cw *clientWriter) Write(p []byte) (int, error) {
+	if cw.timeout > 0 {
+		cw.controller.SetWriteDeadline(time.Now().Add(cw.timeout))
+	}
+
+	start := time.Now()
+	n, err := cw.w.Write(p)
+	if err == nil && cw.flush {
+		if flushErr := cw.controller.Flush(); !errors.Is(flushErr, http.ErrNotSupported) {
+			err = flushErr
+		}
+	}
+	if time.Since(start) >= slowClientThreshold {
+		cw.slow = true
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		cw.timedOut = true
+	}
+	return n, err
+}
+
+// recordClientWrite counts a finished response that was held up by the client
+func (rp *ReverseProxy) recordClientWrite(cw *clientWriter, backendTag string) {
+	if cw.slow || cw.timedOut {
+		rp.clientWrites.slow.Add(1)
+		rp.options.StatsD.Count("requests.slow_client", 1, backendTag)
+	}
+	if cw.timedOut {
+		rp.clientWrites.timedOut.Add(1)
+		rp.options.StatsD.Count("requests.client_write_timeout", 1, backendTag)
+	}
+}
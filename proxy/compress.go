@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressionMinSize is the smallest response body compressed when no minimum is configured
+const DefaultCompressionMinSize = 1024
+
+// gzipWriters reuses gzip writers, which allocate large buffers, across responses
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// compressible reports whether a response may be gzipped for clients that
+// accept it: compression is enabled, the response has a body of at least the
+// minimum size (or of unknown size) and is neither encoded already, partial,
+// an event stream nor marked no-transform
+func (rp *ReverseProxy) compressible(r *http.Request, resp *http.Response) bool {
+	if !rp.options.Compression || r.Method == http.MethodHead {
+		return false
+	}
+
+	switch {
+	case resp.StatusCode < 200,
+		resp.StatusCode == http.StatusNoContent,
+		resp.StatusCode == http.StatusPartialContent,
+		resp.StatusCode == http.StatusNotModified:
+		return false
+	}
+
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/event-stream" {
+		return false
+	}
+
+	return resp.ContentLength < 0 || resp.ContentLength >= rp.options.CompressionMinSize
+}
+
+// negotiateCompression reports whether a response is gzipped for the client,
+// adjusting the client's response headers accordingly
+func (rp *ReverseProxy) negotiateCompression(header http.Header, r *http.Request, resp *http.Response) bool {
+	if !rp.compressible(r, resp) {
+		return false
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r.Header) {
+		return false
+	}
+	setGzipHeaders(header)
+	return true
+}
+
+// acceptsGzip reports whether a request's Accept-Encoding allows gzip
+func acceptsGzip(header http.Header) bool {
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "gzip" && coding != "*" {
+				continue
+			}
+
+			// An explicit q=0 refuses the coding
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// setGzipHeaders adjusts response headers for a gzipped body. The length is
+// no longer known up front, and a strong ETag no longer matches the bytes sent.
+func setGzipHeaders(header http.Header) {
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", "gzip")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// copyBody copies a response body to the client, gzipping it if compress is
+// set. When stream is set, compressed output is flushed after each read.
+func copyBody(dst io.Writer, src io.Reader, compress, stream bool) error {
+	if !compress {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	gz := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(gz)
+	gz.Reset(dst)
+
+	var w io.Writer = gz
+	if stream {
+		w = gzipFlushWriter{gz}
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return gz.Close()
+}
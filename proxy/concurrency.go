@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyStats reports in-flight proxied requests against the global limit
+type ConcurrencyStats struct {
+	InFlight   int64  `json:"in_flight"`
+	Limit      int64  `json:"limit"`
+	Queued     int64  `json:"queued"`
+	QueueLimit int64  `json:"queue_limit"`
+	Rejected   uint64 `json:"rejected"`
+}
+
+// concurrencyLimiter caps proxied requests in flight across the whole proxy.
+// Requests over the limit wait in a bounded queue for a free slot, and are
+// rejected when the queue is full or the wait times out. A limit of 0 only
+// counts requests.
+type concurrencyLimiter struct {
+	limit        int64
+	queueLimit   int64
+	queueTimeout time.Duration
+	slots        chan struct{}
+	inFlight     atomic.Int64
+	queued       atomic.Int64
+	rejected     atomic.Uint64
+}
+
+// newConcurrencyLimiter creates a limiter admitting up to limit requests at
+// once, with up to queueLimit more waiting at most queueTimeout for a slot
+func newConcurrencyLimiter(limit, queueLimit int, queueTimeout time.Duration) *concurrencyLimiter {
+	cl := &concurrencyLimiter{
+		limit:        int64(limit),
+		queueLimit:   int64(queueLimit),
+		queueTimeout: queueTimeout,
+	}
+	if limit > 0 {
+		cl.slots = make(chan struct{}, limit)
+	}
+	return cl
+}
+
+// acquire admits a request, waiting in the queue if all slots are taken. It
+// reports false when the request is rejected. An admitted request must be
+// released once it completes.
+func (cl *concurrencyLimiter) acquire(ctx context.Context) bool {
+	if cl.slots != nil && !cl.wait(ctx) {
+		cl.rejected.Add(1)
+		return false
+	}
+	cl.inFlight.Add(1)
+	return true
+}
+
+// wait takes a slot, queueing for one if none is free
+func (cl *concurrencyLimiter) wait(ctx context.Context) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if cl.queued.Add(1) > cl.queueLimit {
+		cl.queued.Add(-1)
+		return false
+	}
+	defer cl.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if cl.queueTimeout > 0 {
+		timer := time.NewTimer(cl.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release ends a request admitted by acquire
+func (cl *concurrencyLimiter) release() {
+	cl.inFlight.Add(-1)
+	if cl.slots != nil {
+		<-cl.slots
+	}
+}
+
+// Snapshot returns the current counts
+func (cl *concurrencyLimiter) Snapshot() ConcurrencyStats {
+	return ConcurrencyStats{
+		InFlight:   cl.inFlight.Load(),
+		Limit:      cl.limit,
+		Queued:     cl.queued.Load(),
+		QueueLimit: cl.queueLimit,
+		Rejected:   cl.rejected.Load(),
+	}
+}
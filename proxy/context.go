@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"go-load-balancer/balancer"
+	"net/http"
+)
+
+// Selection describes the backend chosen for a proxied request
+type Selection struct {
+	Backend   *balancer.Backend
+	Algorithm string
+}
+
+// selectionKey is the context key under which the *Selection is stored
+type selectionKey struct{}
+
+// WithSelection returns a shallow copy of r whose context carries an empty
+// Selection. Middleware wrapping ReverseProxy passes the returned request to
+// ServeHTTP and, once it returns, reads the chosen backend with SelectionFromContext.
+func WithSelection(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), selectionKey{}, &Selection{}))
+}
+
+// SelectionFromContext returns the backend selection stored in ctx. It is set
+// on the context of requests prepared with WithSelection and on the outbound
+// request sent to the backend, so custom transports can read it too.
+func SelectionFromContext(ctx context.Context) (*Selection, bool) {
+	selection, ok := ctx.Value(selectionKey{}).(*Selection)
+	return selection, ok
+}
+
+// recordSelection fills in the request's Selection, attaching a new one if
+// the caller did not provide it, and returns the resulting context
+func recordSelection(ctx context.Context, algorithm string, backend *balancer.Backend) context.Context {
+	selection, ok := SelectionFromContext(ctx)
+	if !ok {
+		selection = &Selection{}
+		ctx = context.WithValue(ctx, selectionKey{}, selection)
+	}
+
+	selection.Backend = backend
+	selection.Algorithm = algorithm
+	return ctx
+}
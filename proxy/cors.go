@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultCORSMethods are the methods allowed in cross-origin requests when none are configured
+const DefaultCORSMethods = "GET,HEAD,POST,PUT,PATCH,DELETE"
+
+// DefaultCORSHeaders are the request headers allowed in cross-origin requests when none are configured
+const DefaultCORSHeaders = "Content-Type,Authorization"
+
+// CORS answers cross-origin preflight requests and adds CORS headers to
+// responses on behalf of the backends. A nil *CORS handles nothing.
+type CORS struct {
+	origins   map[string]bool // lowercase scheme://host[:port]
+	anyOrigin bool
+	methods   []string
+	headers   map[string]bool // canonical header names
+	anyHeader bool
+}
+
+// ParseCORS parses comma-separated lists of allowed origins, methods and
+// request headers, where "*" allows any origin or header. It returns nil if
+// no origins are given, which leaves CORS to the backends.
+func ParseCORS(origins, methods, headers string) (*CORS, error) {
+	cors := &CORS{origins: make(map[string]bool), headers: make(map[string]bool)}
+	for _, origin := range splitList(origins) {
+		if origin == "*" {
+			cors.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid CORS origin %q: expected * or <scheme>://<host>[:<port>]", origin)
+		}
+		cors.origins[strings.ToLower(origin)] = true
+	}
+	if !cors.anyOrigin && len(cors.origins) == 0 {
+		return nil, nil
+	}
+
+	for _, method := range splitList(methods) {
+		if !ValidHeaderName(method) {
+			return nil, fmt.Errorf("invalid CORS method %q", method)
+		}
+		cors.methods = append(cors.methods, strings.ToUpper(method))
+	}
+	if len(cors.methods) == 0 {
+		return nil, fmt.Errorf("no CORS methods allowed")
+	}
+
+	for _, name := range splitList(headers) {
+		if name == "*" {
+			cors.anyHeader = true
+			continue
+		}
+		if !ValidHeaderName(name) {
+			return nil, fmt.Errorf("invalid CORS header %q", name)
+		}
+		cors.headers[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return cors, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request's
+// Origin header, or "" if the origin is not allowed
+func (c *CORS) allowOrigin(origin string) string {
+	switch {
+	case origin == "":
+		return ""
+	case c.anyOrigin:
+		return "*"
+	case c.origins[strings.ToLower(origin)]:
+		return origin
+	}
+	return ""
+}
+
+// apply sets the CORS headers of a response, replacing any the backend sent.
+// Unless any origin is allowed, responses vary by Origin, so caches keep them apart.
+func (c *CORS) apply(header http.Header, r *http.Request) {
+	if c == nil {
+		return
+	}
+	if !c.anyOrigin {
+		addVary(header, "Origin")
+	}
+	if allowed := c.allowOrigin(r.Header.Get("Origin")); allowed != "" {
+		header.Set("Access-Control-Allow-Origin", allowed)
+	} else {
+		header.Del("Access-Control-Allow-Origin")
+	}
+}
+
+// handlePreflight answers a CORS preflight request without contacting a
+// backend, reporting whether the request was one. Preflights for origins,
+// methods or headers that are not allowed get a 403.
+func (rp *ReverseProxy) handlePreflight(w http.ResponseWriter, r *http.Request) bool {
+	cors := rp.options.CORS
+	method := r.Header.Get("Access-Control-Request-Method")
+	if cors == nil || r.Method != http.MethodOptions || r.Header.Get("Origin") == "" || method == "" {
+		return false
+	}
+
+	header := w.Header()
+	for _, name := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		addVary(header, name)
+	}
+
+	origin := r.Header.Get("Origin")
+	requested := splitList(strings.Join(r.Header.Values("Access-Control-Request-Headers"), ","))
+	allowed := cors.allowOrigin(origin)
+	if allowed == "" || !slices.Contains(cors.methods, method) || !cors.allowsHeaders(requested) {
+		http.Error(w, "CORS request not allowed", http.StatusForbidden)
+		logRequest(r, "Rejected CORS preflight from %s for %s %s", origin, method, r.URL.Path)
+		return true
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowed)
+	header.Set("Access-Control-Allow-Methods", strings.Join(cors.methods, ", "))
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// allowsHeaders reports whether every requested header may be sent
+func (c *CORS) allowsHeaders(requested []string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, name := range requested {
+		if !c.headers[textproto.CanonicalMIMEHeaderKey(name)] {
+			return false
+		}
+	}
+	return true
+}
+
+// addVary adds a header name to the Vary header unless it is already listed
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(listed), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
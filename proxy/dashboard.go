@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// StatusPath serves a human-readable dashboard of the default pool's backends
+const StatusPath = "/status"
+
+// dashboardRefresh is how often the dashboard reloads itself, in seconds
+const dashboardRefresh = 5
+
+var dashboardTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"errorRate": errorRate,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Load Balancer Status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.up { color: #1a7f37; }
+.down { color: #cf222e; }
+.draining { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Load Balancer Status</h1>
+<p>
+Status: <strong class="{{if eq .Health.Status "healthy"}}up{{else}}down{{end}}">{{.Health.Status}}</strong> &middot;
+{{.Health.HealthyBackends}}/{{.Health.TotalBackends}} backends alive &middot;
+{{.Health.InFlightRequests}} requests in flight &middot;
+algorithm {{.Algorithm}}
+</p>
+<table>
+<tr><th>Backend</th><th>State</th><th>Connections</th><th>Successes</th><th>Errors</th><th>Error rate</th></tr>
+{{range .Health.Backends}}
+<tr>
+<td>{{.URL}}</td>
+<td>{{if not .Alive}}<span class="down">down</span>{{else if not .Ready}}<span class="draining">not ready</span>{{else if .Draining}}<span class="draining">draining</span>{{else}}<span class="up">up</span>{{end}}</td>
+<td class="num">{{.Connections}}</td>
+<td class="num">{{.SuccessCount}}</td>
+<td class="num">{{.ErrorCount}}</td>
+<td class="num">{{errorRate .}}</td>
+</tr>
+{{else}}
+<tr><td colspan="6">No backends configured</td></tr>
+{{end}}
+</table>
+<p><small>Updated {{.Updated.Format "2006-01-02 15:04:05 MST"}}, refreshing every {{.Refresh}}s</small></p>
+</body>
+</html>
+`))
+
+// dashboardData is rendered by dashboardTemplate
+type dashboardData struct {
+	Health    healthResponse
+	Algorithm string
+	Refresh   int
+	Updated   time.Time
+}
+
+// errorRate formats the share of a backend's requests that failed
+func errorRate(backend backendStatus) string {
+	total := backend.SuccessCount + backend.ErrorCount
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(backend.ErrorCount)/float64(total))
+}
+
+// handleStatusPage serves the HTML dashboard with the same data as /health
+func (rp *ReverseProxy) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health, _ := rp.health()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := dashboardTemplate.Execute(w, dashboardData{
+		Health:    health,
+		Algorithm: rp.options.Algorithm,
+		Refresh:   dashboardRefresh,
+		Updated:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DecisionsPath serves recent routing decisions. Like the admin API it
+// requires the admin token.
+const DecisionsPath = "/debug/decisions"
+
+// Decision records how a single request was routed
+type Decision struct {
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Algorithm string    `json:"algorithm"`
+	Backend   string    `json:"backend"`
+	Sticky    bool      `json:"sticky"`
+	Retries   int       `json:"retries"`
+	Failed    []string  `json:"failed,omitempty"`
+}
+
+// decisionLog keeps the most recent routing decisions in a fixed-size ring.
+// A nil *decisionLog records nothing.
+type decisionLog struct {
+	mu      sync.Mutex
+	entries []Decision
+	next    int
+	full    bool
+}
+
+// newDecisionLog returns a log of the given size, or nil if size is not positive
+func newDecisionLog(size int) *decisionLog {
+	if size <= 0 {
+		return nil
+	}
+	return &decisionLog{entries: make([]Decision, size)}
+}
+
+// record stores the routing of a request, overwriting the oldest entry once full.
+// backend is nil when no backend was available; failed lists backends that were retried away from.
+func (dl *decisionLog) record(r *http.Request, algorithm string, backend *balancer.Backend, sticky bool, failed []*balancer.Backend) {
+	if dl == nil {
+		return
+	}
+
+	decision := Decision{
+		Time:      time.Now(),
+		ClientIP:  r.RemoteAddr,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Algorithm: algorithm,
+		Sticky:    sticky,
+		Retries:   len(failed),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		decision.ClientIP = host
+	}
+	if backend != nil {
+		decision.Backend = backend.URL.String()
+	}
+	for _, b := range failed {
+		decision.Failed = append(decision.Failed, b.URL.String())
+	}
+
+	dl.mu.Lock()
+	dl.entries[dl.next] = decision
+	dl.next = (dl.next + 1) % len(dl.entries)
+	if dl.next == 0 {
+		dl.full = true
+	}
+	dl.mu.Unlock()
+}
+
+// snapshot returns the recorded decisions, oldest first
+func (dl *decisionLog) snapshot() []Decision {
+	if dl == nil {
+		return []Decision{}
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	if !dl.full {
+		return append([]Decision{}, dl.entries[:dl.next]...)
+	}
+	return append(append([]Decision{}, dl.entries[dl.next:]...), dl.entries[:dl.next]...)
+}
+
+// decisionsResponse is the body served on /debug/decisions
+type decisionsResponse struct {
+	Size      int        `json:"size"`
+	Decisions []Decision `json:"decisions"`
+}
+
+// handleDecisions serves the recent routing decisions on /debug/decisions
+func (rp *ReverseProxy) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	if rp.decisions == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, decisionsResponse{
+		Size:      len(rp.decisions.entries),
+		Decisions: rp.decisions.snapshot(),
+	})
+}
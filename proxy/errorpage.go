@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrorPage replaces the plain-text response the proxy sends when it cannot
+// reach a backend. The zero value keeps the default text and status code.
+type ErrorPage struct {
+	// StatusCode is the response status (0 means the default for the error)
+	StatusCode int
+
+	// ContentType is the Content-Type of Body
+	ContentType string
+
+	// Body is sent instead of the default text (nil keeps the default text)
+	Body []byte
+}
+
+// LoadErrorPage reads an error page body from a file. The content type is
+// derived from the file extension, or sniffed from the content if unknown.
+func LoadErrorPage(path string, statusCode int) (ErrorPage, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return ErrorPage{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	return ErrorPage{StatusCode: statusCode, ContentType: contentType, Body: body}, nil
+}
+
+// write sends the error page, falling back to text and statusCode for unset fields
+func (ep ErrorPage) write(w http.ResponseWriter, text string, statusCode int) {
+	if ep.StatusCode != 0 {
+		statusCode = ep.StatusCode
+	}
+	if ep.Body == nil {
+		http.Error(w, text, statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", ep.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(ep.Body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	w.Write(ep.Body)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package proxy
+
+// openFDs is not supported on this platform
+func openFDs() int {
+	return -1
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Header rule operations
+const (
+	HeaderAdd    = "add"    // appends a value, keeping existing ones
+	HeaderSet    = "set"    // replaces all values
+	HeaderRemove = "remove" // deletes the header
+)
+
+// hopByHopHeaders apply to a single connection and are never forwarded
+// (RFC 9110, section 7.6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HeaderRule adds, sets or removes one header
+type HeaderRule struct {
+	Op    string
+	Name  string
+	Value string
+}
+
+// HeaderRules are applied in order to the headers of proxied requests or responses
+type HeaderRules []HeaderRule
+
+// ParseHeaderRules parses semicolon-separated rules of the form
+// "add:<name>=<value>", "set:<name>=<value>" or "remove:<name>", e.g.
+// "set:X-Proxied-By=go-load-balancer;remove:X-Internal-Token".
+// Hop-by-hop headers are managed by the proxy and cannot be used in rules.
+func ParseHeaderRules(expr string) (HeaderRules, error) {
+	var rules HeaderRules
+	for _, part := range strings.Split(expr, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		op, spec, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header rule %q: expected <op>:<name>[=<value>]", part)
+		}
+		op = strings.ToLower(strings.TrimSpace(op))
+		name, value, hasValue := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+
+		switch op {
+		case HeaderAdd, HeaderSet:
+			if !hasValue {
+				return nil, fmt.Errorf("invalid header rule %q: %s needs a value", part, op)
+			}
+		case HeaderRemove:
+			if hasValue {
+				return nil, fmt.Errorf("invalid header rule %q: remove takes no value", part)
+			}
+		default:
+			return nil, fmt.Errorf("invalid header rule %q: unknown operation %q (use add, set or remove)", part, op)
+		}
+
+		if !ValidHeaderName(name) {
+			return nil, fmt.Errorf("invalid header rule %q: invalid header name %q", part, name)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if isHopByHop(name) {
+			return nil, fmt.Errorf("invalid header rule %q: %s is a hop-by-hop header managed by the proxy", part, name)
+		}
+
+		rules = append(rules, HeaderRule{Op: op, Name: name, Value: strings.TrimSpace(value)})
+	}
+	return rules, nil
+}
+
+// apply runs the rules against a header
+func (rules HeaderRules) apply(header http.Header) {
+	for _, rule := range rules {
+		switch rule.Op {
+		case HeaderAdd:
+			header.Add(rule.Name, rule.Value)
+		case HeaderSet:
+			header.Set(rule.Name, rule.Value)
+		case HeaderRemove:
+			header.Del(rule.Name)
+		}
+	}
+}
+
+// removeHopByHopHeaders deletes connection-specific headers, including any
+// named in the Connection header. "TE: trailers" is kept, since it tells the
+// backend the client understands trailers.
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+
+	keepTrailers := false
+	for _, value := range header.Values("Te") {
+		if strings.EqualFold(strings.TrimSpace(value), "trailers") {
+			keepTrailers = true
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	if keepTrailers {
+		header.Set("Te", "trailers")
+	}
+}
+
+// isHopByHop reports whether a canonical header name is hop-by-hop
+func isHopByHop(name string) bool {
+	for _, hopByHop := range hopByHopHeaders {
+		if name == hopByHop {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidHeaderName reports whether name is a valid HTTP header field name
+func ValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c >= 0x7f || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
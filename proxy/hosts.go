@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// HostRoute sends requests for a matching Host to a named backend pool
+type HostRoute struct {
+	// Pattern is an exact host name, or a wildcard like "*.example.com"
+	// matching any subdomain of example.com but not example.com itself
+	Pattern string
+
+	// Pool names the backend pool matching requests are sent to
+	Pool string
+}
+
+// ParseHostRoutes parses comma-separated rules like
+// "api.example.com=api,*.example.com=app". Host names are case-insensitive.
+func ParseHostRoutes(expr string) ([]HostRoute, error) {
+	var routes []HostRoute
+	for _, part := range strings.Split(expr, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		pattern, pool, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid host route %q: expected <host>=<pool>", part)
+		}
+
+		route := HostRoute{
+			Pattern: strings.ToLower(strings.TrimSpace(pattern)),
+			Pool:    strings.TrimSpace(pool),
+		}
+		if route.Pool == "" {
+			return nil, fmt.Errorf("invalid host route %q: empty pool name", part)
+		}
+
+		name := strings.TrimPrefix(route.Pattern, "*.")
+		if name == "" || strings.ContainsAny(name, "*:/ ") {
+			return nil, fmt.Errorf("invalid host route %q: expected a host name or *.<domain>", part)
+		}
+
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// matchHost returns the pool for a request's Host header. An exact match
+// wins over wildcards, and among wildcards the longest, most specific one
+// wins regardless of rule order.
+func matchHost(routes []HostRoute, host string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	pool, longest := "", 0
+	for _, route := range routes {
+		if route.Pattern == host {
+			return route.Pool, true
+		}
+
+		suffix, wildcard := strings.CutPrefix(route.Pattern, "*")
+		if wildcard && strings.HasSuffix(host, suffix) && len(host) > len(suffix) && len(suffix) > longest {
+			pool, longest = route.Pool, len(suffix)
+		}
+	}
+	return pool, longest > 0
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchHostPrecedence(t *testing.T) {
+	// Listed least specific first, so order can't be what decides
+	routes, err := ParseHostRoutes("*.example.com=wildcard,*.api.example.com=api-wildcard,v1.api.example.com=v1,Example.com=apex")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"v1.api.example.com", "v1"},           // exact beats every wildcard
+		{"v2.api.example.com", "api-wildcard"}, // longest wildcard wins
+		{"api.example.com", "wildcard"},        // *.api.example.com needs a subdomain
+		{"www.example.com:8080", "wildcard"},   // the port is ignored
+		{"EXAMPLE.com.", "apex"},               // case and a trailing dot are ignored
+		{"a.b.example.com", "wildcard"},        // wildcards match nested subdomains
+		{"example.org", ""},
+		{"notexample.com", ""},
+	}
+	for _, tt := range tests {
+		if got, ok := matchHost(routes, tt.host); got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s matched %q (%v), want %q", tt.host, got, ok, tt.want)
+		}
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	routes, err := ParseHostRoutes("*.example.com=app,api.example.com=api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools := map[string]balancer.LoadBalancer{
+		"api": newPool(newNamedBackend(t, "api")),
+		"app": newPool(newNamedBackend(t, "app")),
+	}
+	rp := newTestProxy(Options{HostRoutes: routes, Pools: pools}, newNamedBackend(t, "default"))
+
+	for host, want := range map[string]string{"api.example.com": "api", "www.example.com": "app", "other.org": "default"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		if got := serve(rp, r).Body.String(); got != want {
+			t.Errorf("request for %s went to %q, want %q", host, got, want)
+		}
+	}
+
+	// Unknown hosts get a 404 when rejected
+	rp = newTestProxy(Options{HostRoutes: routes, Pools: pools, RejectUnknownHosts: true}, newNamedBackend(t, "default"))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "other.org"
+	if resp := serve(rp, r); resp.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown host, want 404", resp.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"fmt"
+	"go-load-balancer/balancer"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// AlgorithmHeader names the request header that overrides the algorithm for
+// a single request, when overrides are enabled and the client is trusted
+const AlgorithmHeader = "X-LB-Algorithm"
+
+// route is the algorithm and balancer a request is routed with
+type route struct {
+	algorithm     string
+	balancer      balancer.LoadBalancer
+	normalization PathNormalization
+}
+
+// routeFor returns the pool of the host route or else the first path route
+// matching the request, or else the default pool. Requests matching none of
+// the configured routes are handled as set by UnmatchedRoute. It returns the
+// status to answer with instead if the request is not routed, e.g. because
+// its host matches no host route and unknown hosts are rejected.
+func (rp *ReverseProxy) routeFor(r *http.Request) (route, int) {
+	if pool, ok := matchHost(rp.options.HostRoutes, r.Host); ok {
+		return rp.poolRoute(pool), 0
+	}
+	if rp.options.RejectUnknownHosts {
+		logRequest(r, "Rejected %s %s: no route for host %s", r.Method, r.URL.Path, r.Host)
+		return route{}, http.StatusNotFound
+	}
+
+	for _, pathRoute := range rp.options.Routes {
+		if pathRoute.Matches(r.URL.Path) {
+			return rp.poolRoute(pathRoute.Pool), 0
+		}
+	}
+
+	if len(rp.options.HostRoutes) > 0 || len(rp.options.Routes) > 0 {
+		return rp.unmatchedRoute(r)
+	}
+	return rp.defaultRoute(r), 0
+}
+
+// poolRoute returns the route to a named pool
+func (rp *ReverseProxy) poolRoute(pool string) route {
+	return route{algorithm: rp.options.Algorithm, balancer: rp.options.Pools[pool], normalization: rp.pathNormalization(pool)}
+}
+
+// defaultRoute returns the configured balancer, or the override balancer
+// named by the request's AlgorithmHeader if the request comes from a trusted
+// proxy. Overrides only apply to the default pool.
+func (rp *ReverseProxy) defaultRoute(r *http.Request) route {
+	primary := route{algorithm: rp.options.Algorithm, balancer: rp.loadBalancer, normalization: rp.pathNormalization("")}
+
+	name := r.Header.Get(AlgorithmHeader)
+	if name == "" || name == rp.options.Algorithm {
+		return primary
+	}
+
+	override, ok := rp.options.AlgorithmOverrides[name]
+	if !ok || !rp.isTrustedProxy(r) {
+		return primary
+	}
+
+	rp.syncOverride(override)
+	return route{algorithm: name, balancer: override, normalization: primary.normalization}
+}
+
+// syncOverride makes an override balancer's backends match the primary
+// balancer's. Backends are shared by pointer, so health status and connection
+// counts stay consistent across balancers.
+func (rp *ReverseProxy) syncOverride(override balancer.LoadBalancer) {
+	rp.overrideMu.Lock()
+	defer rp.overrideMu.Unlock()
+
+	wanted := make(map[*balancer.Backend]bool)
+	for _, backend := range rp.loadBalancer.GetBackends() {
+		wanted[backend] = true
+	}
+
+	for _, backend := range override.GetBackends() {
+		if wanted[backend] {
+			delete(wanted, backend)
+		} else {
+			override.RemoveBackend(backend)
+		}
+	}
+
+	// Add in primary order so index-based algorithms see the same pool
+	for _, backend := range rp.loadBalancer.GetBackends() {
+		if wanted[backend] {
+			override.AddBackend(backend)
+		}
+	}
+}
+
+// isTrustedProxy reports whether the request's direct peer is in the trusted proxy list
+func (rp *ReverseProxy) isTrustedProxy(r *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range rp.options.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// ranges, e.g. "10.0.0.0/8,192.168.1.5"
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"fmt"
+	"go-load-balancer/balancer"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Trailing slash normalization modes
+const (
+	TrailingSlashAdd   = "add"
+	TrailingSlashStrip = "strip"
+)
+
+// PathNormalization is how the paths of requests proxied to a backend group are normalized
+type PathNormalization struct {
+	TrailingSlash   string // TrailingSlashAdd, TrailingSlashStrip or "" to leave trailing slashes unchanged
+	CollapseSlashes bool
+}
+
+// ParsePathNormalization parses semicolon-separated per-pool settings like
+// "api=strip,collapse;static=add". Each pool lists any of add, strip and
+// collapse, or none to leave its paths unchanged.
+func ParsePathNormalization(expr string) (map[string]PathNormalization, error) {
+	pools := make(map[string]PathNormalization)
+	for _, part := range strings.Split(expr, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		name, list, found := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid path normalization %q: expected <pool>=<settings>", part)
+		}
+		if _, ok := pools[name]; ok {
+			return nil, fmt.Errorf("duplicate path normalization for pool %s", name)
+		}
+
+		var normalization PathNormalization
+		for _, setting := range strings.Split(list, ",") {
+			switch setting = strings.TrimSpace(setting); setting {
+			case TrailingSlashAdd, TrailingSlashStrip:
+				if normalization.TrailingSlash != "" {
+					return nil, fmt.Errorf("invalid path normalization %q: add and strip are exclusive", part)
+				}
+				normalization.TrailingSlash = setting
+			case "collapse":
+				normalization.CollapseSlashes = true
+			case "none":
+			default:
+				return nil, fmt.Errorf("invalid path normalization %q: unknown setting %q. Valid options: add, strip, collapse, none", part, setting)
+			}
+		}
+		pools[name] = normalization
+	}
+	return pools, nil
+}
+
+// pathNormalization returns the path normalization of a pool, or the global
+// TrailingSlash and CollapseSlashes settings if the pool has none of its own.
+// The default pool always uses the global settings.
+func (rp *ReverseProxy) pathNormalization(pool string) PathNormalization {
+	if normalization, ok := rp.options.PoolPathNormalization[pool]; ok {
+		return normalization
+	}
+	return PathNormalization{TrailingSlash: rp.options.TrailingSlash, CollapseSlashes: rp.options.CollapseSlashes}
+}
+
+// normalize applies the path normalization to a proxied request path
+func (n PathNormalization) normalize(requestPath string) string {
+	if n.CollapseSlashes {
+		for strings.Contains(requestPath, "//") {
+			requestPath = strings.ReplaceAll(requestPath, "//", "/")
+		}
+	}
+
+	if requestPath == "" || requestPath == "/" {
+		return requestPath
+	}
+
+	switch n.TrailingSlash {
+	case TrailingSlashStrip:
+		requestPath = strings.TrimRight(requestPath, "/")
+		if requestPath == "" {
+			requestPath = "/"
+		}
+	case TrailingSlashAdd:
+		// Paths that look like files (/app.js) are left alone
+		if !strings.HasSuffix(requestPath, "/") && !strings.Contains(path.Base(requestPath), ".") {
+			requestPath += "/"
+		}
+	}
+
+	return requestPath
+}
+
+// backendURL returns the URL a request is sent to on a backend of a route:
+// the request path, normalized as set for the route's pool, is appended to
+// the backend URL's path, if it has one, so that /users on a backend at
+// http://host/api becomes /api/users
+func backendURL(route route, backend *balancer.Backend, r *http.Request) *url.URL {
+	target := *backend.URL
+	target.Path = joinPath(backend.URL.Path, route.normalization.normalize(r.URL.Path))
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+	return &target
+}
+
+// joinPath joins a base path and a request path with a single slash
+func joinPath(base, requestPath string) string {
+	if base == "" || base == "/" {
+		return requestPath
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(requestPath, "/")
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newPathEchoBackend returns a backend that answers with the path it received
+func newPathEchoBackend(t *testing.T) *balancer.Backend {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+}
+
+func TestPoolPathNormalization(t *testing.T) {
+	routes, err := ParseRoutes("/api/=api;/static/=static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalization, err := ParsePathNormalization("api=strip,collapse;static=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := newTestProxy(Options{
+		Routes:                routes,
+		Pools:                 map[string]balancer.LoadBalancer{"api": newPool(newPathEchoBackend(t)), "static": newPool(newPathEchoBackend(t))},
+		TrailingSlash:         TrailingSlashAdd,
+		PoolPathNormalization: normalization,
+	}, newPathEchoBackend(t))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api//users/", "/api/users"},
+		{"/static/css/", "/static/css/"},
+		{"/static/css", "/static/css"},
+		{"/other", "/other/"}, // unmatched, so the default pool's global setting applies
+	}
+	for _, tt := range tests {
+		if got := serve(rp, httptest.NewRequest("GET", tt.path, nil)).Body.String(); got != tt.want {
+			t.Errorf("%s was proxied as %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePathNormalization(t *testing.T) {
+	got, err := ParsePathNormalization("api=strip, collapse; static=add;assets=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]PathNormalization{
+		"api":    {TrailingSlash: TrailingSlashStrip, CollapseSlashes: true},
+		"static": {TrailingSlash: TrailingSlashAdd},
+		"assets": {},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for pool, normalization := range want {
+		if got[pool] != normalization {
+			t.Errorf("pool %s: got %+v, want %+v", pool, got[pool], normalization)
+		}
+	}
+
+	for _, expr := range []string{"api", "=strip", "api=add,strip", "api=lower", "api=strip;api=add"} {
+		if _, err := ParsePathNormalization(expr); err == nil {
+			t.Errorf("%q: got no error", expr)
+		}
+	}
+}
+
+func TestBackendBasePath(t *testing.T) {
+	tests := []struct {
+		base string
+		path string
+		want string
+	}{
+		{"", "/users", "/users"},
+		{"", "/", "/"},
+		{"/api", "/users", "/api/users"},
+		{"/api", "/", "/api/"},
+		{"/api/", "/users?page=2", "/api/users?page=2"},
+	}
+	for _, tt := range tests {
+		backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.URL.RequestURI())
+		})
+		backend.URL.Path = tt.base
+
+		rp := newTestProxy(Options{}, backend)
+		if got := serve(rp, httptest.NewRequest("GET", tt.path, nil)).Body.String(); got != tt.want {
+			t.Errorf("%s on a backend with base path %q was proxied as %s, want %s", tt.path, tt.base, got, tt.want)
+		}
+	}
+}
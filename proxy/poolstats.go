@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"go-load-balancer/balancer"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// poolCounters tracks connection pool activity for one backend address
+type poolCounters struct {
+	dials  atomic.Int64
+	closed atomic.Int64
+	reused atomic.Int64
+	fresh  atomic.Int64
+	inUse  atomic.Int64
+}
+
+// PoolStats reports connection pool activity for one backend address
+type PoolStats struct {
+	Open   int64 `json:"open"`
+	Idle   int64 `json:"idle"`
+	InUse  int64 `json:"in_use"`
+	Dials  int64 `json:"dials"`
+	Closed int64 `json:"closed"`
+	Reused int64 `json:"reused"`
+	New    int64 `json:"new"`
+}
+
+// poolStats tracks connection pool activity per backend address
+type poolStats struct {
+	mu    sync.Mutex
+	hosts map[string]*poolCounters
+}
+
+// counters returns the counters for a dial address, creating them if needed
+func (ps *poolStats) counters(addr string) *poolCounters {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.hosts == nil {
+		ps.hosts = make(map[string]*poolCounters)
+	}
+	counters, ok := ps.hosts[addr]
+	if !ok {
+		counters = &poolCounters{}
+		ps.hosts[addr] = counters
+	}
+	return counters
+}
+
+// Snapshot returns the current pool figures keyed by backend address
+func (ps *poolStats) Snapshot() map[string]PoolStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	snapshot := make(map[string]PoolStats, len(ps.hosts))
+	for addr, counters := range ps.hosts {
+		stats := PoolStats{
+			Dials:  counters.dials.Load(),
+			Closed: counters.closed.Load(),
+			Reused: counters.reused.Load(),
+			New:    counters.fresh.Load(),
+			InUse:  counters.inUse.Load(),
+		}
+		stats.Open = stats.Dials - stats.Closed
+		stats.Idle = max(0, stats.Open-stats.InUse)
+		snapshot[addr] = stats
+	}
+	return snapshot
+}
+
+// wrapDial counts dials and closes of backend connections
+func (ps *poolStats) wrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		counters := ps.counters(addr)
+		counters.dials.Add(1)
+		return &countedConn{Conn: conn, counters: counters}, nil
+	}
+}
+
+// trace returns a context that records connection reuse for requests to
+// backendURL, and a function to call once the request has completed
+func (ps *poolStats) trace(ctx context.Context, backendURL *url.URL) (context.Context, func()) {
+	counters := ps.counters(balancer.DialAddr(backendURL))
+	var acquired atomic.Int64
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				counters.reused.Add(1)
+			} else {
+				counters.fresh.Add(1)
+			}
+			counters.inUse.Add(1)
+			acquired.Add(1)
+		},
+	})
+
+	return ctx, func() {
+		counters.inUse.Add(-acquired.Load())
+	}
+}
+
+// countedConn counts when a backend connection is closed
+type countedConn struct {
+	net.Conn
+	counters *poolCounters
+	once     sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.counters.closed.Add(1) })
+	return c.Conn.Close()
+}
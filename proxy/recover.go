@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover wraps a handler so that a panic while serving a request is logged
+// with its stack trace and answered with a 500, instead of resetting the
+// client's connection. If the response has already started, it can no longer
+// be replaced and the connection is aborted.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+			switch {
+			case rw.hijacked:
+			case rw.wroteHeader:
+				panic(http.ErrAbortHandler)
+			default:
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoverWriter records whether a response has started, so Recover knows if
+// it can still send a 500
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (rw *recoverWriter) WriteHeader(statusCode int) {
+	// Informational responses such as 100 Continue are followed by the real one
+	if statusCode >= 200 {
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recoverWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(p)
+}
+
+// Hijack hands over the connection for upgraded requests, after which
+// Recover no longer writes a response
+func (rw *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *recoverWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	rp := newTestProxy(Options{}, backend)
+
+	// Inject a fault before or after the proxied response has started
+	faulty := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic("injected fault")
+		case "/panic-after-response":
+			rp.ServeHTTP(w, r)
+			panic("injected fault")
+		}
+		rp.ServeHTTP(w, r)
+	})
+	server := httptest.NewServer(Recover(faulty))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got %d from a panicking handler, want 500", resp.StatusCode)
+	}
+
+	// Once the response has started it can't become a 500, so the connection is aborted
+	if resp, err := http.Get(server.URL + "/panic-after-response"); err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			t.Errorf("got a complete %d response from a handler that panicked after writing it", resp.StatusCode)
+		}
+	}
+
+	// The server keeps serving
+	resp, err = http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("server is down after the panics: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q after the panics, want 200 \"ok\"", resp.StatusCode, body)
+	}
+}
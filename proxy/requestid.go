@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the header carrying request IDs when none is configured
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs; longer ones are replaced
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key under which a request's ID is stored
+type requestIDKey struct{}
+
+// tagRequest gives a request an ID, reusing a valid one sent by the client,
+// and sets it on the request headers, which are copied to the backend, and on
+// the response. The returned request carries the ID for logRequest.
+func (rp *ReverseProxy) tagRequest(w http.ResponseWriter, r *http.Request) *http.Request {
+	name := rp.options.RequestIDHeader
+	if name == "" {
+		return r
+	}
+
+	id := r.Header.Get(name)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	r.Header.Set(name, id)
+	w.Header().Set(name, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// setRequestID sets the request's ID on a response header, replacing any
+// value the backend sent
+func (rp *ReverseProxy) setRequestID(header http.Header, r *http.Request) {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		header.Set(rp.options.RequestIDHeader, id)
+	}
+}
+
+// logRequest logs a message about a request, prefixed with its ID if it has one
+func logRequest(r *http.Request, format string, args ...any) {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		format = "[%s] " + format
+		args = append([]any{id}, args...)
+	}
+	log.Printf(format, args...)
+}
+
+// validRequestID reports whether an incoming ID is safe to reuse in headers and logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-load-balancer/balancer"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultRetryMaxBody is the largest request body buffered for retries when
+// Options.RetryMaxBody is not set
+const DefaultRetryMaxBody = 1 << 20
+
+// Retry timeout modes: how ProxyTimeout applies to the attempts of a retried request
+const (
+	RetryTimeoutPerAttempt = "per-attempt"
+	RetryTimeoutShared     = "shared"
+)
+
+// DefaultRetryOn are the backend response statuses retried when Options.RetryOn is not set
+var DefaultRetryOn = balancer.StatusSet{{Min: 502, Max: 502}, {Min: 503, Max: 503}, {Min: 504, Max: 504}}
+
+// idempotentMethods are retried by default since repeating them is safe
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryBody is a request body kept so it can be re-sent on each attempt,
+// either in memory or spooled to a temporary file
+type retryBody struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// reader returns a reader over the whole body for one attempt
+func (rb *retryBody) reader() io.Reader {
+	if rb.file != nil {
+		return io.NewSectionReader(rb.file, 0, rb.size)
+	}
+	return bytes.NewReader(rb.data)
+}
+
+// Close removes the spool file, if any
+func (rb *retryBody) Close() {
+	if rb.file != nil {
+		removeSpoolFile(rb.file)
+	}
+}
+
+// canRetry reports whether a failed request may be retried on another backend,
+// provided its body fits within the retry body limits
+func (rp *ReverseProxy) canRetry(r *http.Request) bool {
+	if rp.options.MaxRetries <= 0 {
+		return false
+	}
+	if !idempotentMethods[r.Method] && !rp.options.RetryNonIdempotent {
+		return false
+	}
+	return r.ContentLength <= max(rp.options.RetryMaxBody, rp.options.RetrySpoolMax)
+}
+
+// retryable reports whether a failed attempt should be retried on another
+// backend: connection errors always are, responses only with a RetryOn status
+func (rp *ReverseProxy) retryable(resp *http.Response, err error) bool {
+	return err != nil || rp.options.RetryOn.Contains(resp.StatusCode)
+}
+
+// withRetryBudget bounds the time all attempts of a retried request may take
+// together: ProxyTimeout in shared mode, and RetryMaxTime in either mode.
+// Each attempt is still limited to ProxyTimeout on its own.
+func (rp *ReverseProxy) withRetryBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	budget := rp.options.RetryMaxTime
+	if rp.options.RetryTimeout == RetryTimeoutShared && rp.options.ProxyTimeout > 0 && (budget == 0 || rp.options.ProxyTimeout < budget) {
+		budget = rp.options.ProxyTimeout
+	}
+	if budget == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// RetryTimeBudget returns how long a request may spend on all its backend
+// attempts, from the proxy timeout and retry settings (0 means no limit)
+func RetryTimeBudget(proxyTimeout time.Duration, maxRetries int, mode string, maxTime time.Duration) time.Duration {
+	budget := proxyTimeout
+	if mode != RetryTimeoutShared {
+		budget *= time.Duration(maxRetries + 1)
+	}
+	if maxTime > 0 && (budget == 0 || maxTime < budget) {
+		budget = maxTime
+	}
+	return budget
+}
+
+// bufferBody keeps the request body so it can be re-sent on retry. Bodies up
+// to the retry body limit are held in memory; larger ones are spooled to disk
+// if spooling is enabled. If the body turns out too large for either, it
+// returns nil and replaces r.Body so that the part already read is still
+// streamed to the backend.
+func (rp *ReverseProxy) bufferBody(r *http.Request) (*retryBody, error) {
+	limit := rp.options.RetryMaxBody
+	buffered, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buffered)) <= limit {
+		return &retryBody{data: buffered, size: int64(len(buffered))}, nil
+	}
+
+	if rp.options.RetrySpoolMax <= limit {
+		r.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(buffered), r.Body), body: r.Body}
+		return nil, nil
+	}
+
+	file, err := os.CreateTemp(rp.options.RetrySpoolDir, "lb-body-*")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(file, io.MultiReader(bytes.NewReader(buffered), io.LimitReader(r.Body, rp.options.RetrySpoolMax+1-int64(len(buffered)))))
+	if err != nil {
+		removeSpoolFile(file)
+		return nil, err
+	}
+	if size <= rp.options.RetrySpoolMax {
+		return &retryBody{file: file, size: size}, nil
+	}
+
+	// Too large even for the spool: stream the spooled part, then the rest
+	r.Body = &prefixedBody{
+		Reader:  io.MultiReader(io.NewSectionReader(file, 0, size), r.Body),
+		body:    r.Body,
+		cleanup: func() { removeSpoolFile(file) },
+	}
+	return nil, nil
+}
+
+// prefixedBody replaces a request body whose beginning was already read
+type prefixedBody struct {
+	io.Reader
+	body    io.Closer
+	cleanup func()
+	once    sync.Once
+}
+
+func (pb *prefixedBody) Close() error {
+	pb.once.Do(func() {
+		if pb.cleanup != nil {
+			pb.cleanup()
+		}
+	})
+	return pb.body.Close()
+}
+
+// removeSpoolFile closes and deletes a spool file
+func removeSpoolFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// isBodyTooLarge reports whether err comes from a request body exceeding MaxBodySize
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// rejectLargeBody answers a request whose body exceeds MaxBodySize
+func (rp *ReverseProxy) rejectLargeBody(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+	logRequest(r, "Rejected %s %s: request body larger than %d bytes", r.Method, r.URL.Path, rp.options.MaxBodySize)
+	rp.options.StatsD.Count("requests.body_too_large", 1)
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"go-load-balancer/balancer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSlowBackend returns a backend that answers only after a second, or when
+// the request is cancelled, counting the requests it receives
+func newSlowBackend(t *testing.T, hits *atomic.Int32) *balancer.Backend {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+}
+
+func TestRetryTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		maxTime      time.Duration
+		wantAttempts int32
+		wantMax      time.Duration
+	}{
+		{"per-attempt", RetryTimeoutPerAttempt, 0, 2, 600 * time.Millisecond},
+		{"shared", RetryTimeoutShared, 0, 1, 400 * time.Millisecond},
+		{"capped per-attempt", RetryTimeoutPerAttempt, 300 * time.Millisecond, 2, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			rp := newTestProxy(Options{
+				MaxRetries:   1,
+				ProxyTimeout: 200 * time.Millisecond,
+				RetryTimeout: tt.mode,
+				RetryMaxTime: tt.maxTime,
+			}, newSlowBackend(t, &hits), newSlowBackend(t, &hits))
+
+			start := time.Now()
+			resp := serve(rp, httptest.NewRequest("GET", "/", nil))
+			elapsed := time.Since(start)
+
+			if resp.Code != http.StatusGatewayTimeout {
+				t.Errorf("got %d, want 504", resp.Code)
+			}
+			if got := hits.Load(); got != tt.wantAttempts {
+				t.Errorf("backends got %d attempts, want %d", got, tt.wantAttempts)
+			}
+			if elapsed > tt.wantMax {
+				t.Errorf("request took %v, want at most %v", elapsed, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRetryTimeBudget(t *testing.T) {
+	tests := []struct {
+		proxyTimeout time.Duration
+		maxRetries   int
+		mode         string
+		maxTime      time.Duration
+		want         time.Duration
+	}{
+		{30 * time.Second, 0, RetryTimeoutPerAttempt, 0, 30 * time.Second},
+		{30 * time.Second, 2, RetryTimeoutPerAttempt, 0, 90 * time.Second},
+		{30 * time.Second, 2, RetryTimeoutShared, 0, 30 * time.Second},
+		{30 * time.Second, 2, RetryTimeoutPerAttempt, 45 * time.Second, 45 * time.Second},
+		{30 * time.Second, 2, RetryTimeoutShared, 45 * time.Second, 30 * time.Second},
+		{0, 2, RetryTimeoutPerAttempt, 0, 0},
+		{0, 2, RetryTimeoutPerAttempt, time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := RetryTimeBudget(tt.proxyTimeout, tt.maxRetries, tt.mode, tt.maxTime); got != tt.want {
+			t.Errorf("RetryTimeBudget(%v, %d, %s, %v) = %v, want %v", tt.proxyTimeout, tt.maxRetries, tt.mode, tt.maxTime, got, tt.want)
+		}
+	}
+}
+
+func TestRetrySendsFullBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 32<<10) // 512 KiB
+
+	// The first backend reads the whole body before failing
+	var firstRead atomic.Int64
+	failing := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		firstRead.Store(n)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	echo := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+
+	rp := newTestProxy(Options{MaxRetries: 1}, failing, echo)
+	resp := serve(rp, httptest.NewRequest("PUT", "/upload", bytes.NewReader(payload)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200 from the retry", resp.Code)
+	}
+	if firstRead.Load() != int64(len(payload)) {
+		t.Errorf("first backend read %d bytes, want %d", firstRead.Load(), len(payload))
+	}
+	if !bytes.Equal(resp.Body.Bytes(), payload) {
+		t.Errorf("retry received %d bytes, want the intact %d byte body", resp.Body.Len(), len(payload))
+	}
+
+	// Bodies over the limit are streamed once and not retried
+	firstRead.Store(0)
+	rp = newTestProxy(Options{MaxRetries: 1, RetryMaxBody: 1024}, failing, echo)
+	r := httptest.NewRequest("PUT", "/upload", bytes.NewReader(payload))
+	r.ContentLength = -1 // unknown up front, so the limit is only noticed while buffering
+	if resp := serve(rp, r); resp.Code != http.StatusBadGateway {
+		t.Errorf("got %d for a body over the retry limit, want the first backend's 502", resp.Code)
+	}
+	if firstRead.Load() != int64(len(payload)) {
+		t.Errorf("first backend read %d bytes of a streamed body, want %d", firstRead.Load(), len(payload))
+	}
+}
@@ -2,216 +2,872 @@ package proxy
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"go-load-balancer/balancer"
+	"go-load-balancer/statsd"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Options holds optional reverse proxy settings
+type Options struct {
+	// Algorithm is the name of the configured load balancing algorithm
+	Algorithm string
+
+	// AlgorithmOverrides are balancers that trusted clients can select per request
+	// with the X-LB-Algorithm header, keyed by algorithm name. They are kept in
+	// sync with the primary balancer's backends.
+	AlgorithmOverrides map[string]balancer.LoadBalancer
+
+	// Routes send requests with matching paths to backend pools other than the
+	// default one; the first matching route wins
+	Routes []PathRoute
+
+	// HostRoutes send requests for matching Host headers to backend pools,
+	// taking precedence over Routes
+	HostRoutes []HostRoute
+
+	// RejectUnknownHosts responds 404 to requests whose host matches no HostRoutes
+	// rule instead of routing them by path or to the default pool
+	RejectUnknownHosts bool
+
+	// UnmatchedRoute handles requests that match none of the Routes and HostRoutes:
+	// UnmatchedDefault (or "") sends them to the default pool, UnmatchedNotFound
+	// and UnmatchedBadGateway answer with that status, and any other value names
+	// the pool they are sent to
+	UnmatchedRoute string
+
+	// Pools are the backend pools named by Routes and HostRoutes, each with its own balancer
+	Pools map[string]balancer.LoadBalancer
+
+	// TrustedProxies are the client addresses allowed to override the algorithm
+	TrustedProxies []netip.Prefix
+
+	// DebugHeaders stamps responses with X-LB-Algorithm and X-LB-Backend-Count
+	DebugHeaders bool
+
+	// RequestIDHeader names the header carrying each proxied request's ID, taken
+	// from the client if it sent a valid one and generated otherwise. The ID is
+	// sent to the backend, returned to the client and prefixed to the request's
+	// log lines ("" disables it).
+	RequestIDHeader string
+
+	// ServedByHeader names a response header set to the name, or else the URL,
+	// of the backend that handled the request ("" disables it)
+	ServedByHeader string
+
+	// AdminToken enables the /admin/ API, guarded by a bearer token check
+	AdminToken string
+
+	// ValidateBackendURL, when set, checks the URL of a backend added through
+	// the admin API beyond it having a scheme and host, e.g. that the scheme
+	// suits the proxy mode. An error rejects the backend.
+	ValidateBackendURL func(*url.URL) error
+
+	// MaxRetries is how many other backends a failed request is retried on
+	MaxRetries int
+
+	// RetryOn are the backend response statuses that are retried, along with
+	// connection errors (empty means DefaultRetryOn)
+	RetryOn balancer.StatusSet
+
+	// RetryMaxBody is the largest request body buffered for retries (0 means DefaultRetryMaxBody).
+	// Requests with larger bodies are streamed and not retried.
+	RetryMaxBody int64
+
+	// RetrySpoolMax lets request bodies larger than RetryMaxBody, up to this size, be
+	// spooled to a temporary file so they can be retried (0 disables spooling)
+	RetrySpoolMax int64
+
+	// RetrySpoolDir is the directory for spooled request bodies ("" means os.TempDir)
+	RetrySpoolDir string
+
+	// RetryNonIdempotent also retries requests with non-idempotent methods such as POST
+	RetryNonIdempotent bool
+
+	// RetryTimeout decides whether each attempt of a retried request gets the
+	// full ProxyTimeout (RetryTimeoutPerAttempt, the default) or all attempts
+	// share it (RetryTimeoutShared)
+	RetryTimeout string
+
+	// RetryMaxTime caps the time all attempts of a retried request take together (0 means no cap)
+	RetryMaxTime time.Duration
+
+	// ProxyTimeout bounds each proxied request, including reading the response (0 means no limit)
+	ProxyTimeout time.Duration
+
+	// WebSocketIdleTimeout closes upgraded connections that see no traffic in
+	// either direction for this long (0 means never)
+	WebSocketIdleTimeout time.Duration
+
+	// WebSocketPingInterval, when set, sends a ping frame to WebSocket clients
+	// this often, so that their pongs keep quiet sockets from going idle
+	WebSocketPingInterval time.Duration
+
+	// MaxConnAge limits how long a pooled backend connection is reused (0 means no limit)
+	MaxConnAge time.Duration
+
+	// TLSHandshakeTimeout bounds the TLS handshake with HTTPS backends (0 means no limit)
+	TLSHandshakeTimeout time.Duration
+
+	// IdleConnTimeout closes pooled backend connections idle for longer than this (0 means no limit)
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns limits idle pooled connections across all backends (0 means no limit)
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost limits idle pooled connections per backend (0 means http.DefaultMaxIdleConnsPerHost)
+	MaxIdleConnsPerHost int
+
+	// BackendHTTP2 speaks HTTP/2 to all backends, using h2c for plain HTTP
+	// backends, so concurrent requests share one connection per backend
+	BackendHTTP2 bool
+
+	// BackendProxy selects an HTTP proxy for backend connections, like http.Transport.Proxy (nil connects directly)
+	BackendProxy func(*http.Request) (*url.URL, error)
+
+	// BackendTLS configures connections to HTTPS backends, e.g. with a client certificate (nil uses the defaults)
+	BackendTLS *tls.Config
+
+	// ClientWriteTimeout aborts a response when a single write to the client blocks this long (0 means no limit)
+	ClientWriteTimeout time.Duration
+
+	// PreserveHost sends the client's Host header to backends instead of the backend's own host
+	PreserveHost bool
+
+	// TrailingSlash adds or strips trailing slashes on proxied paths ("" leaves them unchanged)
+	TrailingSlash string
+
+	// CollapseSlashes replaces repeated slashes in proxied paths with a single one
+	CollapseSlashes bool
+
+	// PoolPathNormalization replaces TrailingSlash and CollapseSlashes for the named pools
+	PoolPathNormalization map[string]PathNormalization
+
+	// MaxBodySize rejects requests with larger bodies with a 413 (0 means no limit)
+	MaxBodySize int64
+
+	// ReadOnly starts the proxy in read-only mode, which can be toggled via the admin API
+	ReadOnly bool
+
+	// Maintenance starts the proxy in maintenance mode, which can be toggled via
+	// the admin API. All proxied requests get MaintenancePage while it is on.
+	Maintenance bool
+
+	// MaintenancePage is sent for every proxied request in maintenance mode (default: plain-text 503)
+	MaintenancePage ErrorPage
+
+	// SafeMethods are the methods still proxied in read-only mode (default GET, HEAD, OPTIONS)
+	SafeMethods []string
+
+	// MaxConcurrentRequests caps proxied requests in flight at once; further
+	// requests queue or get a 503 (0 means no limit). Health, stats and admin
+	// requests are not counted.
+	MaxConcurrentRequests int
+
+	// ConcurrencyQueue is how many requests over MaxConcurrentRequests may wait for a slot
+	ConcurrencyQueue int
+
+	// ConcurrencyQueueTimeout bounds the wait for a slot (0 means until the client gives up)
+	ConcurrencyQueueTimeout time.Duration
+
+	// ConcurrencyRetryAfter is sent as Retry-After on 503s for requests over the limit (0 omits it)
+	ConcurrencyRetryAfter time.Duration
+
+	// ResponseRules reject backend responses that are missing required headers
+	// or have a disallowed Content-Type, as if the backend request had failed
+	ResponseRules ResponseRules
+
+	// DecisionLogSize keeps this many recent routing decisions for /debug/decisions (0 disables it)
+	DecisionLogSize int
+
+	// StickyCookie, when set, names a cookie that pins each client to the
+	// backend that served its first request, for as long as that backend is alive
+	StickyCookie string
+
+	// Compression gzips responses for clients that accept it, unless already encoded
+	Compression bool
+
+	// CompressionMinSize is the smallest response body compressed (0 means DefaultCompressionMinSize).
+	// Bodies of unknown length are always compressed.
+	CompressionMinSize int64
+
+	// AlwaysFlush flushes every response to the client as it arrives from the
+	// backend. Streaming responses, such as chunked bodies and event streams,
+	// are flushed either way.
+	AlwaysFlush bool
+
+	// NoBackendPage is sent when no healthy backend is available (default: plain-text 503)
+	NoBackendPage ErrorPage
+
+	// BadGatewayPage is sent when the backend request fails (default: plain-text
+	// 502, or 504 if it timed out)
+	BadGatewayPage ErrorPage
+
+	// CacheRules override the Cache-Control header on responses to matching paths
+	CacheRules []CacheRule
+
+	// CacheSize keeps up to this many GET responses in memory to answer repeated requests (0 disables caching)
+	CacheSize int
+
+	// CacheTTL is how long cached responses without max-age or s-maxage are kept (0 only caches responses that have one)
+	CacheTTL time.Duration
+
+	// RequestHeaders are applied to the headers of requests sent to backends
+	RequestHeaders HeaderRules
+
+	// ResponseHeaders are applied to the headers of backend responses relayed to clients
+	ResponseHeaders HeaderRules
+
+	// CORS, when set, answers preflight requests and adds CORS headers to responses
+	CORS *CORS
+
+	// AccessLog, when set, receives a JSON line for every proxied request with
+	// its status, duration and the backends it was tried on
+	AccessLog io.Writer
+
+	// StatusPage serves an auto-refreshing HTML dashboard of the backends on StatusPath
+	StatusPage bool
+
+	// RuntimeMetrics adds Go runtime metrics of the load balancer process to /stats
+	RuntimeMetrics bool
+
+	// StatsD, when set, receives per-request metrics
+	StatsD *statsd.Client
+}
+
 type ReverseProxy struct {
-	loadBalancer  balancer.LoadBalancer
-	healthChecker balancer.HealthChecker
+	loadBalancer     balancer.LoadBalancer
+	healthChecker    balancer.HealthChecker
+	options          Options
+	transport        http.RoundTripper
+	client           *http.Client
+	poolStats        poolStats
+	readOnly         atomic.Bool
+	maintenance      atomic.Bool
+	shuttingDown     atomic.Bool
+	safeMethods      map[string]bool
+	selectionLatency latencyRecorder
+	requestRate      rateCounter
+	clientWrites     clientWriteStats
+	concurrency      *concurrencyLimiter
+	decisions        *decisionLog
+	accessLog        *accessLog
+	cache            *responseCache
+	overrideMu       sync.Mutex
 }
 
-func NewReverseProxy(lb balancer.LoadBalancer, hc balancer.HealthChecker) *ReverseProxy {
-	return &ReverseProxy{
+func NewReverseProxy(lb balancer.LoadBalancer, hc balancer.HealthChecker, options Options) *ReverseProxy {
+	if options.RetryMaxBody <= 0 {
+		options.RetryMaxBody = DefaultRetryMaxBody
+	}
+	if len(options.RetryOn) == 0 {
+		options.RetryOn = DefaultRetryOn
+	}
+	if options.CompressionMinSize <= 0 {
+		options.CompressionMinSize = DefaultCompressionMinSize
+	}
+	if len(options.SafeMethods) == 0 {
+		options.SafeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	}
+
+	rp := &ReverseProxy{
 		loadBalancer:  lb,
 		healthChecker: hc,
+		options:       options,
+		safeMethods:   make(map[string]bool),
+		decisions:     newDecisionLog(options.DecisionLogSize),
+		accessLog:     newAccessLog(options.AccessLog),
+		cache:         newResponseCache(options.CacheSize, options.CacheTTL),
+	}
+	rp.transport = newTransport(options, &rp.poolStats)
+	rp.client = &http.Client{
+		Transport: rp.transport,
+		Timeout:   options.ProxyTimeout,
 	}
+
+	for _, method := range options.SafeMethods {
+		rp.safeMethods[strings.ToUpper(method)] = true
+	}
+	rp.readOnly.Store(options.ReadOnly)
+	rp.maintenance.Store(options.Maintenance)
+	rp.concurrency = newConcurrencyLimiter(options.MaxConcurrentRequests, options.ConcurrencyQueue, options.ConcurrencyQueueTimeout)
+
+	return rp
 }
 
 // ServeHTTP handles incoming HTTP requests
 func (rp *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rp.options.DebugHeaders {
+		rp.setDebugHeaders(w)
+	}
+
 	// Handle health endpoint
 	if r.URL.Path == "/health" {
 		rp.handleHealthCheck(w, r)
 		return
 	}
 
-	// Select backend
-	backend := rp.loadBalancer.SelectBackend(r)
+	// Handle the HTML status dashboard
+	if rp.options.StatusPage && r.URL.Path == StatusPath {
+		rp.handleStatusPage(w, r)
+		return
+	}
+
+	// Handle stats endpoint
+	if r.URL.Path == "/stats" {
+		rp.handleStats(w, r)
+		return
+	}
+
+	// Handle admin API
+	if strings.HasPrefix(r.URL.Path, "/admin/") || r.URL.Path == DecisionsPath {
+		rp.handleAdmin(w, r)
+		return
+	}
+
+	// Tag the request so it can be correlated across the logs of the load balancer and backends
+	r = rp.tagRequest(w, r)
+
+	// Log every proxied request once it is done, including ones answered without a backend
+	w, access := rp.accessLog.track(w)
+	if access != nil {
+		defer func() { rp.accessLog.write(access, r) }()
+	}
+
+	// Answer CORS preflights without a backend; other requests get CORS
+	// headers on every response, including errors
+	if rp.handlePreflight(w, r) {
+		return
+	}
+	rp.options.CORS.apply(w.Header(), r)
+
+	// Answer everything in maintenance mode without picking a backend; health
+	// checks keep running so backend states are current when it is lifted
+	if rp.maintenance.Load() {
+		rp.options.MaintenancePage.write(w, "Service is under maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Reject writes while in read-only mode
+	if rp.readOnly.Load() && !rp.safeMethods[r.Method] {
+		http.Error(w, "Service is in read-only mode", http.StatusServiceUnavailable)
+		logRequest(r, "Rejected %s %s: read-only mode", r.Method, r.URL.Path)
+		return
+	}
+
+	// Answer repeated GETs from the response cache without contacting a backend
+	if entry := rp.cache.lookup(r); entry != nil {
+		rp.serveCached(w, r, entry)
+		return
+	}
+
+	// Shed load beyond the global concurrency limit, once the queue is full
+	if !rp.concurrency.acquire(r.Context()) {
+		if rp.options.ConcurrencyRetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rp.options.ConcurrencyRetryAfter.Seconds()))))
+		}
+		http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+		logRequest(r, "Rejected %s %s: %d requests already in flight", r.Method, r.URL.Path, rp.options.MaxConcurrentRequests)
+		rp.options.StatsD.Count("requests.over_capacity", 1)
+		return
+	}
+	defer rp.concurrency.release()
+
+	// Pick the pool by host and path routes, honoring a per-request algorithm override
+	route, status := rp.routeFor(r)
+	if status != 0 {
+		http.Error(w, "No route for request", status)
+		return
+	}
+	if rp.options.DebugHeaders {
+		w.Header().Set("X-LB-Algorithm", route.algorithm)
+	}
+
+	// Refuse bodies over the size limit, whether declared up front or streamed
+	if rp.options.MaxBodySize > 0 {
+		if r.ContentLength > rp.options.MaxBodySize {
+			rp.rejectLargeBody(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, rp.options.MaxBodySize)
+	}
+
+	// Keep the body so the request can be re-sent to another backend;
+	// bodies too large to keep are streamed and the request is not retried
+	maxAttempts := 1
+	var body *retryBody
+	if rp.canRetry(r) {
+		buffered, err := rp.bufferBody(r)
+		if isBodyTooLarge(err) {
+			rp.rejectLargeBody(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			logRequest(r, "Error reading request body: %v", err)
+			return
+		}
+		defer r.Body.Close()
+		if buffered != nil {
+			defer buffered.Close()
+			body = buffered
+			maxAttempts += rp.options.MaxRetries
+		}
+	}
+	if maxAttempts > 1 {
+		ctx, cancel := rp.withRetryBudget(r.Context())
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// Clients pinned to an alive backend skip the algorithm
+	start := time.Now()
+	backend := rp.stickyBackend(route, r)
+	sticky := backend != nil
+	if !sticky {
+		backend = rp.selectBackend(route, r)
+	}
 	if backend == nil {
-		http.Error(w, "No healthy backends available", http.StatusServiceUnavailable)
-		log.Printf("No healthy backends available for request: %s %s", r.Method, r.URL.Path)
+		rp.decisions.record(r, route.algorithm, nil, false, nil)
+		rp.options.NoBackendPage.write(w, "No healthy backends available", http.StatusServiceUnavailable)
+		logRequest(r, "No healthy backends available for request: %s %s", r.Method, r.URL.Path)
+		rp.options.StatsD.Count("requests.no_backend", 1)
 		return
 	}
 
+	rp.requestRate.Add()
+
+	// Upgraded connections such as WebSockets are relayed as raw bytes and never retried
+	if isUpgradeRequest(r) {
+		access.try(backend)
+		rp.decisions.record(r, route.algorithm, backend, sticky, nil)
+		rp.serveUpgrade(w, r, route, backend, start)
+		return
+	}
+
+	var failed []*balancer.Backend
+	for attempt := 1; ; attempt++ {
+		backendTag := "backend:" + backend.URL.Host
+		access.try(backend)
+		resp, done, err := rp.forward(route, r, backend, body)
+
+		// A streamed body over the limit is the client's fault, not the backend's
+		if isBodyTooLarge(err) {
+			done()
+			rp.rejectLargeBody(w, r)
+			return
+		}
+
+		// Responses that break the validation rules count as backend failures
+		if err == nil {
+			if err = rp.options.ResponseRules.validate(resp); err != nil {
+				resp.Body.Close()
+				resp = nil
+				rp.options.StatsD.Count("requests.invalid_response", 1, backendTag)
+			}
+		}
+
+		failedAttempt := err != nil || resp.StatusCode >= 500
+		rp.reportResult(backend, !failedAttempt)
+
+		// Retry failures on another backend while attempts and time remain
+		var next *balancer.Backend
+		if rp.retryable(resp, err) && attempt < maxAttempts {
+			switch ctxErr := r.Context().Err(); {
+			case ctxErr == nil:
+				failed = append(failed, backend)
+				next = rp.selectBackend(route, balancer.WithExcludedBackends(r, failed))
+			case errors.Is(ctxErr, context.DeadlineExceeded):
+				logRequest(r, "Not retrying %s %s: retry time budget used up", r.Method, r.URL.Path)
+			}
+		}
+
+		if next == nil {
+			rp.decisions.record(r, route.algorithm, backend, sticky, failed[:attempt-1])
+			rp.writeResponse(w, r, backend, resp, err, start)
+			done()
+			return
+		}
+
+		if err != nil {
+			logRequest(r, "Backend request failed: %v, retrying on %s", err, next.URL.String())
+		} else {
+			logRequest(r, "Backend %s returned %d, retrying on %s", backend.URL.String(), resp.StatusCode, next.URL.String())
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		atomic.AddInt32(&backend.ErrorCount, 1)
+		rp.options.StatsD.Count("requests.retries", 1, backendTag)
+		done()
+
+		backend = next
+	}
+}
+
+// reportResult feeds the outcome of a request to the passive health checks,
+// if the proxy has a health checker
+func (rp *ReverseProxy) reportResult(backend *balancer.Backend, success bool) {
+	if rp.healthChecker != nil {
+		rp.healthChecker.ReportResult(backend, success)
+	}
+}
+
+// selectBackend picks a backend for a request, timing the algorithm itself
+func (rp *ReverseProxy) selectBackend(route route, r *http.Request) *balancer.Backend {
+	start := time.Now()
+	backend := route.balancer.SelectBackend(r)
+	selectionTime := time.Since(start)
+	rp.selectionLatency.Observe(selectionTime)
+	rp.options.StatsD.Timing("selection.duration", selectionTime)
+	return backend
+}
+
+// forward sends one attempt of a request to a backend. A non-nil body is
+// sent instead of the request's own body. The returned done function must be
+// called once the response, if any, has been consumed.
+func (rp *ReverseProxy) forward(route route, r *http.Request, backend *balancer.Backend, body *retryBody) (*http.Response, func(), error) {
+	rp.acquireConnection(route.balancer, backend)
+
 	// Log the request
-	log.Printf("Proxying request %s %s to backend %s", r.Method, r.URL.Path, backend.URL.String())
+	logRequest(r, "Proxying request %s %s to backend %s", r.Method, r.URL.Path, backend.URL.String())
 
 	// Create a new request to the backend
-	targetURL := *backend.URL
-	targetURL.Path = r.URL.Path
-	targetURL.RawQuery = r.URL.RawQuery
+	targetURL := backendURL(route, backend, r)
+
+	// Create context with the proxy timeout, exposing the selection to the transport
+	ctx, cancel := rp.withProxyTimeout(recordSelection(r.Context(), route.algorithm, backend))
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+	// Record connection reuse for the pool stats
+	ctx, releasePoolConn := rp.poolStats.trace(ctx, backend.URL)
+
+	done := func() {
+		releasePoolConn()
+		cancel()
+		rp.releaseConnection(route.balancer, backend)
+	}
+
+	var requestBody io.Reader = r.Body
+	if body != nil {
+		requestBody = body.reader()
+	}
 
 	// Create the proxy request
-	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), r.Body)
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), requestBody)
 	if err != nil {
-		http.Error(w, "Error creating proxy request", http.StatusInternalServerError)
-		log.Printf("Error creating proxy request: %v", err)
-		return
+		return nil, done, err
+	}
+	if body != nil {
+		proxyReq.ContentLength = body.size
+	} else {
+		proxyReq.ContentLength = r.ContentLength
 	}
 
-	// Copy headers
+	// Copy headers, except those that only apply to the client connection
 	for name, values := range r.Header {
 		for _, value := range values {
 			proxyReq.Header.Add(name, value)
 		}
 	}
+	removeHopByHopHeaders(proxyReq.Header)
 
-	// Add X-Forwarded-For header
-	if clientIP := getClientIP(r); clientIP != "" {
-		proxyReq.Header.Set("X-Forwarded-For", clientIP)
+	// Add X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers
+	setForwardedHeaders(proxyReq.Header, r)
+	rp.options.RequestHeaders.apply(proxyReq.Header)
+	if rp.options.PreserveHost {
+		proxyReq.Host = r.Host
 	}
 
-	// Add X-Forwarded-Host header
-	proxyReq.Header.Set("X-Forwarded-Host", r.Host)
+	// Make the request, timing how long the backend takes to respond
+	requestStart := time.Now()
+	resp, err := rp.client.Do(proxyReq)
+	if err == nil {
+		backend.ObserveResponseTime(time.Since(requestStart))
+	}
+	return resp, done, err
+}
 
-	// Make the request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// isTimeout reports whether a backend request failed by running out of time,
+// such as hitting ProxyTimeout, rather than by a refused or broken connection
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
 	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
 
-	resp, err := client.Do(proxyReq)
-	if err != nil {
-		http.Error(w, "Backend server error", http.StatusBadGateway)
-		log.Printf("Backend request failed: %v", err)
-		atomic.AddInt32(&backend.ErrorCount, 1)
+// writeResponse relays a backend's response, or the error it failed with, to the client
+func (rp *ReverseProxy) writeResponse(w http.ResponseWriter, r *http.Request, backend *balancer.Backend, resp *http.Response, err error, start time.Time) {
+	backendTag := "backend:" + backend.URL.Host
 
-		// Decrement connection count for least-connections balancer
-		if lcb, ok := rp.loadBalancer.(*balancer.LeastConnectionsBalancer); ok {
-			lcb.DecrementConnections(backend)
+	if err != nil {
+		rp.setServedBy(w.Header(), backend)
+		if isTimeout(err) {
+			rp.options.BadGatewayPage.write(w, "Backend request timed out", http.StatusGatewayTimeout)
+			logRequest(r, "Backend request timed out: %v", err)
+		} else {
+			rp.options.BadGatewayPage.write(w, "Backend server error", http.StatusBadGateway)
+			logRequest(r, "Backend request failed: %v", err)
 		}
+		atomic.AddInt32(&backend.ErrorCount, 1)
+		rp.options.StatsD.Count("requests.errors", 1, backendTag)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Decrement connection count when request completes
-	defer func() {
-		if lcb, ok := rp.loadBalancer.(*balancer.LeastConnectionsBalancer); ok {
-			lcb.DecrementConnections(backend)
-		}
-	}()
-
-	// Copy response headers
+	// Copy response headers, except those that only apply to the backend connection
 	for name, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(name, value)
 		}
 	}
+	removeHopByHopHeaders(w.Header())
+	rp.setRequestID(w.Header(), r)
+	rp.setServedBy(w.Header(), backend)
+	rp.applyCacheRules(w.Header(), r.URL.Path)
+	rp.setStickyCookie(w.Header(), r, backend)
+	rp.options.CORS.apply(w.Header(), r)
+	rp.options.ResponseHeaders.apply(w.Header())
+
+	// Keep a copy of cacheable responses for later requests
+	var body io.Reader = resp.Body
+	if rp.cache.cacheable(r) {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	capture := rp.cache.capture(r, resp)
+	if capture != nil {
+		body = io.TeeReader(resp.Body, capture)
+	}
+
+	// Gzip the body for clients that accept it
+	compress := rp.negotiateCompression(w.Header(), r, resp)
 
-	// Set status code
+	// Set status code, announcing trailers sent after the body
+	announceTrailers(w.Header(), resp)
 	w.WriteHeader(resp.StatusCode)
 
-	// Copy response body
-	_, err = io.Copy(w, resp.Body)
+	// Copy response body, tracking clients that read slowly; streamed bodies
+	// are flushed as they arrive
+	stream := rp.options.AlwaysFlush || isStreaming(resp)
+	clientWriter := newClientWriter(w, rp.options.ClientWriteTimeout, stream)
+	if stream {
+		clientWriter.controller.Flush()
+	}
+	err = copyBody(clientWriter, body, compress, stream)
+	rp.recordClientWrite(clientWriter, backendTag)
+	if clientWriter.timedOut {
+		logRequest(r, "Client write timed out for %s %s, aborting response", r.Method, r.URL.Path)
+		return
+	}
 	if err != nil {
-		log.Printf("Error copying response body: %v", err)
+		logRequest(r, "Error copying response body: %v", err)
 		atomic.AddInt32(&backend.ErrorCount, 1)
+		rp.options.StatsD.Count("requests.errors", 1, backendTag)
 		return
 	}
+	copyTrailers(w.Header(), resp)
+	capture.finish()
 
 	// Update success count
 	atomic.AddInt32(&backend.SuccessCount, 1)
+	rp.options.StatsD.Count("requests", 1, backendTag, "status:"+strconv.Itoa(resp.StatusCode))
+	rp.options.StatsD.Timing("request.duration", time.Since(start), backendTag)
 }
 
-// handleHealthCheck handles health check requests
-func (rp *ReverseProxy) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	backends := rp.loadBalancer.GetBackends()
-	healthyCount := 0
+// withProxyTimeout applies the configured proxy timeout, if any, to a request context
+func (rp *ReverseProxy) withProxyTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if rp.options.ProxyTimeout > 0 {
+		return context.WithTimeout(ctx, rp.options.ProxyTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// acquireConnection counts an in-flight request against a backend selected by lb
+func (rp *ReverseProxy) acquireConnection(lb balancer.LoadBalancer, backend *balancer.Backend) {
+	countConnection(lb, backend)
+}
+
+// releaseConnection ends an in-flight request started with acquireConnection
+func (rp *ReverseProxy) releaseConnection(lb balancer.LoadBalancer, backend *balancer.Backend) {
+	uncountConnection(lb, backend)
+
+	if backend.Draining && !rp.shuttingDown.Load() && atomic.LoadInt32(&backend.Connections) == 0 {
+		log.Printf("Backend %s is drained and safe to remove", backend.URL.String())
+	}
+}
+
+// countConnection counts a connection to a backend selected by lb.
+// Connection trackers already count it when selecting.
+func countConnection(lb balancer.LoadBalancer, backend *balancer.Backend) {
+	if _, ok := lb.(balancer.ConnectionTracker); !ok {
+		atomic.AddInt32(&backend.Connections, 1)
+	}
+}
+
+// uncountConnection ends a connection counted by countConnection
+func uncountConnection(lb balancer.LoadBalancer, backend *balancer.Backend) {
+	if tracker, ok := lb.(balancer.ConnectionTracker); ok {
+		tracker.DecrementConnections(backend)
+		return
+	}
+	atomic.AddInt32(&backend.Connections, -1)
+}
 
-	type BackendStatus struct {
-		URL          string `json:"url"`
-		Alive        bool   `json:"alive"`
-		Connections  int32  `json:"connections"`
-		SuccessCount int32  `json:"success_count"`
-		ErrorCount   int32  `json:"error_count"`
+// setServedBy identifies the backend that handled a request, if enabled
+func (rp *ReverseProxy) setServedBy(header http.Header, backend *balancer.Backend) {
+	if rp.options.ServedByHeader == "" {
+		return
 	}
+	if backend.Name != "" {
+		header.Set(rp.options.ServedByHeader, backend.Name)
+	} else {
+		header.Set(rp.options.ServedByHeader, backend.URL.String())
+	}
+}
 
-	type HealthResponse struct {
-		Status          string          `json:"status"`
-		HealthyBackends int             `json:"healthy_backends"`
-		TotalBackends   int             `json:"total_backends"`
-		Backends        []BackendStatus `json:"backends"`
+// setDebugHeaders reports the active algorithm and number of backends in rotation
+func (rp *ReverseProxy) setDebugHeaders(w http.ResponseWriter) {
+	aliveCount := 0
+	for _, backend := range rp.loadBalancer.GetBackends() {
+		if backend.Alive && backend.Ready {
+			aliveCount++
+		}
 	}
 
-	var backendStatuses []BackendStatus
+	w.Header().Set("X-LB-Algorithm", rp.options.Algorithm)
+	w.Header().Set("X-LB-Backend-Count", strconv.Itoa(aliveCount))
+}
+
+// backendStatus describes a backend on /health and /status
+type backendStatus struct {
+	URL            string `json:"url"`
+	Name           string `json:"name,omitempty"`
+	Alive          bool   `json:"alive"`
+	Ready          bool   `json:"ready"`
+	Draining       bool   `json:"draining"`
+	Connections    int32  `json:"connections"`
+	MaxConnections int32  `json:"max_connections,omitempty"`
+	Priority       int    `json:"priority,omitempty"`
+	SuccessCount   int32  `json:"success_count"`
+	ErrorCount     int32  `json:"error_count"`
+
+	HealthSuccessCount int32      `json:"health_success_count"`
+	HealthFailCount    int32      `json:"health_fail_count"`
+	LastCheckedAt      *time.Time `json:"last_checked_at,omitempty"`
+	LastLatencyMs      float64    `json:"last_latency_ms"`
+}
+
+// healthResponse is the body served on /health
+type healthResponse struct {
+	Status           string          `json:"status"`
+	HealthyBackends  int             `json:"healthy_backends"`
+	TotalBackends    int             `json:"total_backends"`
+	InFlightRequests int64           `json:"in_flight_requests"`
+	Backends         []backendStatus `json:"backends"`
+}
+
+// health gathers the state of the default pool's backends, along with the
+// HTTP status code /health answers with
+func (rp *ReverseProxy) health() (healthResponse, int) {
+	backends := rp.loadBalancer.GetBackends()
+	healthyCount := 0
+
+	backendStatuses := make([]backendStatus, 0, len(backends))
 	for _, backend := range backends {
-		if backend.Alive {
+		if backend.Alive && backend.Ready {
 			healthyCount++
 		}
 
-		backendStatuses = append(backendStatuses, BackendStatus{
-			URL:          backend.URL.String(),
-			Alive:        backend.Alive,
-			Connections:  atomic.LoadInt32(&backend.Connections),
-			SuccessCount: atomic.LoadInt32(&backend.SuccessCount),
-			ErrorCount:   atomic.LoadInt32(&backend.ErrorCount),
-		})
+		status := backendStatus{
+			URL:                backend.URL.String(),
+			Name:               backend.Name,
+			Alive:              backend.Alive,
+			Ready:              backend.Ready,
+			Draining:           backend.Draining,
+			Connections:        atomic.LoadInt32(&backend.Connections),
+			MaxConnections:     backend.MaxConnections,
+			Priority:           backend.Priority,
+			SuccessCount:       atomic.LoadInt32(&backend.SuccessCount),
+			ErrorCount:         atomic.LoadInt32(&backend.ErrorCount),
+			HealthSuccessCount: atomic.LoadInt32(&backend.HealthSuccessCount),
+			HealthFailCount:    atomic.LoadInt32(&backend.HealthFailCount),
+			LastLatencyMs:      float64(atomic.LoadInt64((*int64)(&backend.LastLatency))) / float64(time.Millisecond),
+		}
+		if checkedAt := atomic.LoadInt64(&backend.LastCheckedAt); checkedAt != 0 {
+			lastCheckedAt := time.Unix(0, checkedAt)
+			status.LastCheckedAt = &lastCheckedAt
+		}
+		backendStatuses = append(backendStatuses, status)
 	}
 
-	status := "healthy"
-	if healthyCount == 0 {
-		status = "unhealthy"
-		w.WriteHeader(http.StatusServiceUnavailable)
-	} else {
-		w.WriteHeader(http.StatusOK)
+	status, statusCode := "healthy", http.StatusOK
+	switch {
+	case rp.shuttingDown.Load():
+		status, statusCode = "shutting_down", http.StatusServiceUnavailable
+	case healthyCount == 0:
+		status, statusCode = "unhealthy", http.StatusServiceUnavailable
 	}
 
-	response := HealthResponse{
-		Status:          status,
-		HealthyBackends: healthyCount,
-		TotalBackends:   len(backends),
-		Backends:        backendStatuses,
-	}
+	return healthResponse{
+		Status:           status,
+		HealthyBackends:  healthyCount,
+		TotalBackends:    len(backends),
+		InFlightRequests: rp.concurrency.inFlight.Load(),
+		Backends:         backendStatuses,
+	}, statusCode
+}
 
-	w.Header().Set("Content-Type", "application/json")
+// handleHealthCheck handles health check requests
+func (rp *ReverseProxy) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	response, statusCode := rp.health()
 
-	// Simple JSON response without external dependencies
-	fmt.Fprintf(w, `{
-  "status": "%s",
-  "healthy_backends": %d,
-  "total_backends": %d,
-  "backends": [`,
-		response.Status, response.HealthyBackends, response.TotalBackends)
+	// One compact object per backend per line, for jq/grep and diffing
+	if r.URL.Query().Get("format") == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(statusCode)
 
-	for i, backend := range backendStatuses {
-		if i > 0 {
-			fmt.Fprint(w, ",")
+		encoder := json.NewEncoder(w)
+		for _, backend := range response.Backends {
+			encoder.Encode(backend)
 		}
-		fmt.Fprintf(w, `
-    {
-      "url": "%s",
-      "alive": %t,
-      "connections": %d,
-      "success_count": %d,
-      "error_count": %d
-    }`, backend.URL, backend.Alive, backend.Connections, backend.SuccessCount, backend.ErrorCount)
+		return
 	}
 
-	fmt.Fprint(w, `
-  ]
-}`)
+	writeJSON(w, statusCode, response)
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
+// setForwardedHeaders describes the client connection to the backend. The
+// immediate peer's IP is appended to any X-Forwarded-For chain the request
+// arrived with, so proxies in front of the load balancer stay on record.
+func setForwardedHeaders(header http.Header, r *http.Request) {
+	peerIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peerIP = host
 	}
 
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+	if chain := r.Header.Values("X-Forwarded-For"); len(chain) > 0 {
+		header.Set("X-Forwarded-For", strings.Join(chain, ", ")+", "+peerIP)
+	} else {
+		header.Set("X-Forwarded-For", peerIP)
 	}
 
-	return r.RemoteAddr
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	header.Set("X-Forwarded-Proto", proto)
+	header.Set("X-Forwarded-Host", r.Host)
 }
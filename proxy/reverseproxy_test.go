@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"go-load-balancer/balancer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestBackend starts a server with the given handler and returns it as an
+// alive, ready backend
+func newTestBackend(t *testing.T, handler http.HandlerFunc) *balancer.Backend {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &balancer.Backend{URL: mustParseURL(t, server.URL), Alive: true, Ready: true, Weight: 1}
+}
+
+// newDeadBackend returns an alive backend whose server refuses connections
+func newDeadBackend(t *testing.T) *balancer.Backend {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return &balancer.Backend{URL: mustParseURL(t, server.URL), Alive: true, Ready: true, Weight: 1}
+}
+
+// newTestProxy returns a proxy without a health checker that balances
+// round-robin over the given backends, in order
+func newTestProxy(options Options, backends ...*balancer.Backend) *ReverseProxy {
+	lb := balancer.NewRoundRobinBalancer()
+	for _, backend := range backends {
+		lb.AddBackend(backend)
+	}
+	return NewReverseProxy(lb, nil, options)
+}
+
+func mustParseURL(t testing.TB, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// serve sends a request through the proxy and returns the recorded response
+func serve(rp *ReverseProxy, r *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	rp.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestServeHTTPWithoutHealthChecker(t *testing.T) {
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	rp := newTestProxy(Options{}, backend)
+	resp := serve(rp, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusOK || resp.Body.String() != "ok" {
+		t.Fatalf("got %d %q, want 200 \"ok\"", resp.Code, resp.Body.String())
+	}
+
+	// Failed requests are reported to the passive checks too
+	rp = newTestProxy(Options{}, newDeadBackend(t))
+	if resp := serve(rp, httptest.NewRequest("GET", "/", nil)); resp.Code != http.StatusBadGateway {
+		t.Fatalf("got %d from a dead backend, want 502", resp.Code)
+	}
+}
+
+func TestHealthDuringHealthChecks(t *testing.T) {
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {})
+	rp := newTestProxy(Options{}, backend)
+	checker := balancer.NewHealthChecker(rp.loadBalancer, time.Second, time.Second, balancer.HealthCheckOptions{})
+
+	// Run with -race: checks record their time while /health reads it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			checker.CheckHealth(backend)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		serve(rp, httptest.NewRequest("GET", "/health", nil))
+	}
+	<-done
+
+	var health healthResponse
+	if err := json.Unmarshal(serve(rp, httptest.NewRequest("GET", "/health", nil)).Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if status := health.Backends[0]; status.LastCheckedAt == nil || status.HealthSuccessCount != 20 {
+		t.Fatalf("got last check %v after %d passed checks, want a time after 20", status.LastCheckedAt, status.HealthSuccessCount)
+	}
+}
+
+func TestBackendErrorStatus(t *testing.T) {
+	slow := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	// The hijacked connection is closed without a response
+	reset := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})
+
+	tests := []struct {
+		name    string
+		backend *balancer.Backend
+		want    int
+	}{
+		{"slower than the proxy timeout", slow, http.StatusGatewayTimeout},
+		{"connection refused", newDeadBackend(t), http.StatusBadGateway},
+		{"connection closed", reset, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestProxy(Options{ProxyTimeout: 100 * time.Millisecond}, tt.backend)
+			if resp := serve(rp, httptest.NewRequest("GET", "/", nil)); resp.Code != tt.want {
+				t.Errorf("got %d, want %d", resp.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthJSONWithSpecialCharacters(t *testing.T) {
+	backendURL := mustParseURL(t, `http://10.0.0.1:8080/a"b\c?q=<x>&y="z"`)
+	name := "quote\" backslash\\ newline\n tab\t"
+	rp := newTestProxy(Options{}, &balancer.Backend{URL: backendURL, Name: name, Alive: true, Ready: true, Weight: 1})
+
+	body := serve(rp, httptest.NewRequest("GET", "/health", nil)).Body.Bytes()
+	var health healthResponse
+	if err := json.Unmarshal(body, &health); err != nil {
+		t.Fatalf("invalid JSON %s: %v", body, err)
+	}
+	if got := health.Backends[0]; got.URL != backendURL.String() || got.Name != name {
+		t.Errorf("got URL %q and name %q, want %q and %q", got.URL, got.Name, backendURL, name)
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Forwarded-Host"))
+	})
+	rp := newTestProxy(Options{}, backend)
+
+	tests := []struct {
+		name  string
+		chain []string
+		tls   bool
+		want  string
+	}{
+		{"without X-Forwarded-For", nil, false, "192.0.2.1|http|example.com"},
+		{"with X-Forwarded-For", []string{"203.0.113.5"}, false, "203.0.113.5, 192.0.2.1|http|example.com"},
+		{"with several X-Forwarded-For headers", []string{"203.0.113.5, 198.51.100.2", "10.1.1.1"}, false, "203.0.113.5, 198.51.100.2, 10.1.1.1, 192.0.2.1|http|example.com"},
+		{"over TLS", nil, true, "192.0.2.1|https|example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			r.RemoteAddr = "192.0.2.1:51000"
+			for _, value := range tt.chain {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := serve(rp, r).Body.String(); got != tt.want {
+				t.Errorf("backend got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
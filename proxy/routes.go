@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ways of handling requests that match none of the host and path routes,
+// besides sending them to a named pool
+const (
+	UnmatchedDefault    = "default"
+	UnmatchedNotFound   = "404"
+	UnmatchedBadGateway = "502"
+)
+
+// PathRoute sends requests with a matching path to a named backend pool
+type PathRoute struct {
+	// Pattern is a path prefix, or a regular expression when it starts with "~"
+	Pattern string
+
+	// Pool names the backend pool matching requests are sent to
+	Pool string
+
+	regexp *regexp.Regexp
+}
+
+// ParseRoutes parses semicolon-separated rules like
+// "/api/=api;~^/assets/.*\.css$=static". Rules are matched in order.
+func ParseRoutes(expr string) ([]PathRoute, error) {
+	var routes []PathRoute
+	for _, part := range strings.Split(expr, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		// Pool names cannot contain "=", patterns can
+		i := strings.LastIndex(part, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid route %q: expected <pattern>=<pool>", part)
+		}
+
+		route := PathRoute{
+			Pattern: strings.TrimSpace(part[:i]),
+			Pool:    strings.TrimSpace(part[i+1:]),
+		}
+		if route.Pool == "" {
+			return nil, fmt.Errorf("invalid route %q: empty pool name", part)
+		}
+
+		if expr, ok := strings.CutPrefix(route.Pattern, "~"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid route %q: %v", part, err)
+			}
+			route.regexp = re
+		} else if !strings.HasPrefix(route.Pattern, "/") {
+			return nil, fmt.Errorf("invalid route %q: pattern must start with / or ~", part)
+		}
+
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// unmatchedRoute handles a request that matches none of the configured host
+// and path routes: it goes to the default pool or the pool named by
+// UnmatchedRoute, or is answered with a 404 or 502. Each such request is
+// logged, so that missing routes stand out.
+func (rp *ReverseProxy) unmatchedRoute(r *http.Request) (route, int) {
+	switch unmatched := rp.options.UnmatchedRoute; unmatched {
+	case "", UnmatchedDefault:
+		logRequest(r, "No route matches %s %s for host %s, using the default pool", r.Method, r.URL.Path, r.Host)
+		return rp.defaultRoute(r), 0
+	case UnmatchedNotFound, UnmatchedBadGateway:
+		status, _ := strconv.Atoi(unmatched)
+		logRequest(r, "Rejected %s %s for host %s: no route matches", r.Method, r.URL.Path, r.Host)
+		return route{}, status
+	default:
+		logRequest(r, "No route matches %s %s for host %s, using pool %s", r.Method, r.URL.Path, r.Host, unmatched)
+		return rp.poolRoute(unmatched), 0
+	}
+}
+
+// Matches reports whether the route applies to a request path
+func (pr PathRoute) Matches(requestPath string) bool {
+	if pr.regexp != nil {
+		return pr.regexp.MatchString(requestPath)
+	}
+	return strings.HasPrefix(requestPath, pr.Pattern)
+}
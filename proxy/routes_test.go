@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newNamedBackend returns a backend that answers with its name
+func newNamedBackend(t *testing.T, name string) *balancer.Backend {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	})
+}
+
+// newPool returns a round-robin balancer over the given backends
+func newPool(backends ...*balancer.Backend) balancer.LoadBalancer {
+	lb := balancer.NewRoundRobinBalancer()
+	for _, backend := range backends {
+		lb.AddBackend(backend)
+	}
+	return lb
+}
+
+func TestUnmatchedRoute(t *testing.T) {
+	routes, err := ParseRoutes("/api/=api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools := map[string]balancer.LoadBalancer{
+		"api":      newPool(newNamedBackend(t, "api")),
+		"fallback": newPool(newNamedBackend(t, "fallback")),
+	}
+
+	tests := []struct {
+		unmatched  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"", http.StatusOK, "default"},
+		{UnmatchedDefault, http.StatusOK, "default"},
+		{UnmatchedNotFound, http.StatusNotFound, "No route for request\n"},
+		{UnmatchedBadGateway, http.StatusBadGateway, "No route for request\n"},
+		{"fallback", http.StatusOK, "fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unmatched, func(t *testing.T) {
+			rp := newTestProxy(Options{Routes: routes, Pools: pools, UnmatchedRoute: tt.unmatched}, newNamedBackend(t, "default"))
+
+			// Matched requests are routed whatever the setting
+			if resp := serve(rp, httptest.NewRequest("GET", "/api/users", nil)); resp.Body.String() != "api" {
+				t.Errorf("/api/users went to %q, want the api pool", resp.Body.String())
+			}
+
+			resp := serve(rp, httptest.NewRequest("GET", "/other", nil))
+			if resp.Code != tt.wantStatus || resp.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", resp.Code, resp.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUnmatchedRouteWithoutRoutes(t *testing.T) {
+	// Without routes every request belongs to the default pool
+	rp := newTestProxy(Options{UnmatchedRoute: UnmatchedNotFound}, newNamedBackend(t, "default"))
+	if resp := serve(rp, httptest.NewRequest("GET", "/other", nil)); resp.Code != http.StatusOK {
+		t.Errorf("got %d, want 200 from the default pool", resp.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"runtime"
+	"time"
+)
+
+// RuntimeStats describes the load balancer process itself
+type RuntimeStats struct {
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64  `json:"heap_sys_bytes"`
+	HeapObjects    uint64  `json:"heap_objects"`
+	NumGC          uint32  `json:"num_gc"`
+	LastGCPauseMs  float64 `json:"last_gc_pause_ms"`
+	TotalGCPauseMs float64 `json:"total_gc_pause_ms"`
+	OpenFDs        int     `json:"open_fds"`
+}
+
+// runtimeStats collects Go runtime metrics. OpenFDs is -1 where the
+// platform offers no cheap way to count open file descriptors.
+func runtimeStats() RuntimeStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	stats := RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		HeapSysBytes:   memStats.HeapSys,
+		HeapObjects:    memStats.HeapObjects,
+		NumGC:          memStats.NumGC,
+		TotalGCPauseMs: durationMs(time.Duration(memStats.PauseTotalNs)),
+		OpenFDs:        openFDs(),
+	}
+	if memStats.NumGC > 0 {
+		stats.LastGCPauseMs = durationMs(time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256]))
+	}
+	return stats
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
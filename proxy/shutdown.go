@@ -0,0 +1,25 @@
+package proxy
+
+import "go-load-balancer/balancer"
+
+// BeginShutdown prepares the proxy for a graceful shutdown. Every backend of
+// every pool is marked as draining, so no new requests are sent to them, and
+// /health reports the load balancer as shutting down.
+func (rp *ReverseProxy) BeginShutdown() {
+	rp.shuttingDown.Store(true)
+
+	pools := []balancer.LoadBalancer{rp.loadBalancer}
+	for _, pool := range rp.options.Pools {
+		pools = append(pools, pool)
+	}
+	for _, pool := range pools {
+		for _, backend := range pool.GetBackends() {
+			pool.UpdateBackendDraining(backend, true)
+		}
+	}
+}
+
+// InFlight returns the number of proxied requests currently being handled
+func (rp *ReverseProxy) InFlight() int64 {
+	return rp.concurrency.inFlight.Load()
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencySampleSize is the number of recent observations kept for percentile estimates
+const latencySampleSize = 1024
+
+// latencyRecorder keeps a fixed-size ring of recent durations so that
+// recording stays O(1) and percentiles are only computed when read
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples [latencySampleSize]time.Duration
+	next    int
+	count   uint64
+	max     time.Duration
+}
+
+// Observe records a single duration
+func (lr *latencyRecorder) Observe(d time.Duration) {
+	lr.mu.Lock()
+	lr.samples[lr.next] = d
+	lr.next = (lr.next + 1) % latencySampleSize
+	lr.count++
+	if d > lr.max {
+		lr.max = d
+	}
+	lr.mu.Unlock()
+}
+
+// LatencySummary summarizes recent observations in microseconds
+type LatencySummary struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_us"`
+	P99   float64 `json:"p99_us"`
+	Max   float64 `json:"max_us"`
+}
+
+// Summary returns percentiles over the most recent observations
+func (lr *latencyRecorder) Summary() LatencySummary {
+	lr.mu.Lock()
+	n := int(min(lr.count, latencySampleSize))
+	samples := make([]time.Duration, n)
+	copy(samples, lr.samples[:n])
+	summary := LatencySummary{Count: lr.count, Max: microseconds(lr.max)}
+	lr.mu.Unlock()
+
+	if n == 0 {
+		return summary
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	summary.P50 = microseconds(samples[percentileIndex(n, 0.50)])
+	summary.P99 = microseconds(samples[percentileIndex(n, 0.99)])
+	return summary
+}
+
+// percentileIndex returns the index of the given percentile in a sorted slice of length n
+func percentileIndex(n int, p float64) int {
+	index := int(float64(n)*p+0.5) - 1
+	return max(0, min(index, n-1))
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// rateWindow is the number of one-second buckets averaged by rateCounter
+const rateWindow = 60
+
+// rateCounter counts events in one-second buckets to compute a per-second
+// rate over the last rateWindow complete seconds
+type rateCounter struct {
+	mu      sync.Mutex
+	buckets [rateWindow]uint64
+	seconds [rateWindow]int64
+}
+
+// Add counts one event
+func (rc *rateCounter) Add() {
+	now := time.Now().Unix()
+	index := now % rateWindow
+
+	rc.mu.Lock()
+	if rc.seconds[index] != now {
+		rc.seconds[index] = now
+		rc.buckets[index] = 0
+	}
+	rc.buckets[index]++
+	rc.mu.Unlock()
+}
+
+// Rate returns the average events per second over the last complete window
+func (rc *rateCounter) Rate() float64 {
+	now := time.Now().Unix()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var total uint64
+	for i, second := range rc.seconds {
+		if second < now && second >= now-rateWindow {
+			total += rc.buckets[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
+
+// ScalingStats holds aggregate load figures for autoscaling decisions
+type ScalingStats struct {
+	ActiveConnections        int64   `json:"active_connections"`
+	HealthyBackends          int     `json:"healthy_backends"`
+	TotalBackends            int     `json:"total_backends"`
+	AvgConnectionsPerBackend float64 `json:"avg_connections_per_backend"`
+	RequestRate              float64 `json:"request_rate"`
+}
+
+// StatsResponse is the body served on /stats
+type StatsResponse struct {
+	SelectionLatency LatencySummary       `json:"selection_latency"`
+	Scaling          ScalingStats         `json:"scaling"`
+	ConnectionPool   map[string]PoolStats `json:"connection_pool"`
+	ClientWrites     ClientWriteStats     `json:"client_writes"`
+	Concurrency      ConcurrencyStats     `json:"concurrency"`
+	Runtime          *RuntimeStats        `json:"runtime,omitempty"`
+}
+
+// scalingStats derives aggregate load from the per-backend counters
+func (rp *ReverseProxy) scalingStats() ScalingStats {
+	backends := rp.loadBalancer.GetBackends()
+	stats := ScalingStats{
+		TotalBackends: len(backends),
+		RequestRate:   rp.requestRate.Rate(),
+	}
+
+	for _, backend := range backends {
+		stats.ActiveConnections += int64(atomic.LoadInt32(&backend.Connections))
+		if backend.Alive && backend.Ready {
+			stats.HealthyBackends++
+		}
+	}
+
+	if stats.HealthyBackends > 0 {
+		stats.AvgConnectionsPerBackend = float64(stats.ActiveConnections) / float64(stats.HealthyBackends)
+	}
+	return stats
+}
+
+// handleStats handles stats requests
+func (rp *ReverseProxy) handleStats(w http.ResponseWriter, r *http.Request) {
+	response := StatsResponse{
+		SelectionLatency: rp.selectionLatency.Summary(),
+		Scaling:          rp.scalingStats(),
+		ConnectionPool:   rp.poolStats.Snapshot(),
+		ClientWrites:     rp.clientWrites.Snapshot(),
+		Concurrency:      rp.concurrency.Snapshot(),
+	}
+	if rp.options.RuntimeMetrics {
+		runtime := runtimeStats()
+		response.Runtime = &runtime
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
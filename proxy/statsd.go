@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"go-load-balancer/statsd"
+	"sync/atomic"
+	"time"
+)
+
+// ReportBackendMetrics periodically pushes backend gauges to StatsD
+func ReportBackendMetrics(client *statsd.Client, lb balancer.LoadBalancer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		healthyCount := 0
+		for _, backend := range lb.GetBackends() {
+			tag := "backend:" + backend.URL.Host
+
+			alive, ready := 0.0, 0.0
+			if backend.Alive {
+				alive = 1
+			}
+			if backend.Ready {
+				ready = 1
+			}
+			if backend.Alive && backend.Ready {
+				healthyCount++
+			}
+
+			client.Gauge("backend.alive", alive, tag)
+			client.Gauge("backend.ready", ready, tag)
+			client.Gauge("backend.connections", float64(atomic.LoadInt32(&backend.Connections)), tag)
+			client.Gauge("backend.success_count", float64(atomic.LoadInt32(&backend.SuccessCount)), tag)
+			client.Gauge("backend.error_count", float64(atomic.LoadInt32(&backend.ErrorCount)), tag)
+		}
+		client.Gauge("backends.healthy", float64(healthyCount))
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go-load-balancer/balancer"
+	"net/http"
+)
+
+// stickyBackend returns the alive backend named by the request's sticky
+// session cookie, or nil if sticky sessions are off, the cookie is missing or
+// its backend is gone, down, draining or at its connection cap. The backend's connection is counted
+// the way the route's balancer would have counted it in SelectBackend.
+func (rp *ReverseProxy) stickyBackend(route route, r *http.Request) *balancer.Backend {
+	if rp.options.StickyCookie == "" {
+		return nil
+	}
+
+	cookie, err := r.Cookie(rp.options.StickyCookie)
+	if err != nil {
+		return nil
+	}
+
+	// A client pinned to a failover backend moves back once a preferred tier recovers
+	backends := route.balancer.GetBackends()
+	priority := balancer.ActivePriority(backends)
+	for _, backend := range backends {
+		if backend.Priority != priority || !backend.Alive || !backend.Ready || backend.Draining || stickyValue(backend) != cookie.Value {
+			continue
+		}
+
+		// Claim the connection along with the cap check, so concurrent pinned
+		// requests can't push the backend past MaxConnections
+		if _, ok := route.balancer.(balancer.ConnectionTracker); ok {
+			if !backend.ReserveConnection() {
+				continue
+			}
+		} else if backend.AtCapacity() {
+			continue
+		}
+		return backend
+	}
+	return nil
+}
+
+// setStickyCookie adds a Set-Cookie header pinning the client to backend,
+// unless the request's cookie already names it
+func (rp *ReverseProxy) setStickyCookie(header http.Header, r *http.Request, backend *balancer.Backend) {
+	if rp.options.StickyCookie == "" {
+		return
+	}
+
+	value := stickyValue(backend)
+	if cookie, err := r.Cookie(rp.options.StickyCookie); err == nil && cookie.Value == value {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     rp.options.StickyCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	header.Add("Set-Cookie", cookie.String())
+}
+
+// stickyValue identifies a backend in the sticky session cookie. It hashes
+// the backend's key, so the cookie survives URL changes of a backend with an
+// ID without revealing backend addresses to clients.
+func stickyValue(backend *balancer.Backend) string {
+	sum := sha256.Sum256([]byte(backend.Key()))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"go-load-balancer/balancer"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStickyBackendRespectsCap(t *testing.T) {
+	backend := &balancer.Backend{URL: mustParseURL(t, "http://10.0.0.1:8080"), Alive: true, Ready: true, Weight: 1, MaxConnections: 3}
+	rp := newTestProxy(Options{StickyCookie: "lb"}, backend)
+	route, _ := rp.routeFor(httptest.NewRequest("GET", "/", nil))
+
+	// Run with -race: pinned requests claim the connection with the cap check
+	var pinned atomic.Int32
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: "lb", Value: stickyValue(backend)})
+			if rp.stickyBackend(route, r) != nil {
+				pinned.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := pinned.Load(); got != 3 {
+		t.Errorf("got %d pinned requests, want the cap of 3", got)
+	}
+	if backend.Connections != 3 {
+		t.Errorf("backend has %d connections, want 3", backend.Connections)
+	}
+}
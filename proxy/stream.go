@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+)
+
+// isStreaming reports whether a response is sent as it is produced, such as
+// a chunked body of unknown length or an event stream, so each part must be
+// flushed to the client as it arrives instead of waiting for a full buffer
+func isStreaming(resp *http.Response) bool {
+	if resp.ContentLength < 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// announceTrailers declares the backend's trailers on the client response,
+// which must happen before the header is written
+func announceTrailers(header http.Header, resp *http.Response) {
+	for name := range resp.Trailer {
+		header.Add("Trailer", name)
+	}
+}
+
+// copyTrailers relays the trailer values received after the backend's body.
+// The trailer prefix also sends trailers the backend did not announce.
+func copyTrailers(header http.Header, resp *http.Response) {
+	for name, values := range resp.Trailer {
+		for _, value := range values {
+			header.Add(http.TrailerPrefix+name, value)
+		}
+	}
+}
+
+// gzipFlushWriter flushes each write through the gzip writer, so compressed
+// streaming responses reach the client chunk by chunk
+type gzipFlushWriter struct {
+	gz *gzip.Writer
+}
+
+func (fw gzipFlushWriter) Write(p []byte) (int, error) {
+	n, err := fw.gz.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.gz.Flush()
+}
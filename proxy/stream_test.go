@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventStreamIsNotBuffered(t *testing.T) {
+	// The backend only sends the second event once the client got the first
+	next := make(chan struct{})
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-next:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("data: second\n\n"))
+	})
+
+	server := httptest.NewServer(newTestProxy(Options{ProxyTimeout: 5 * time.Second}, backend))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := make(chan string)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(events)
+				return
+			}
+			if line != "\n" {
+				events <- line
+			}
+		}
+	}()
+
+	for i, want := range []string{"data: first\n", "data: second\n"} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("got event %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q did not arrive before the rest of the stream", want)
+		}
+		if i == 0 {
+			close(next)
+		}
+	}
+}
+
+func TestTrailersAreRelayed(t *testing.T) {
+	backend := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("body"))
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Unannounced", "late")
+	})
+
+	server := httptest.NewServer(newTestProxy(Options{}, backend))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, ok := resp.Trailer["X-Checksum"]; !ok {
+		t.Errorf("got announced trailers %v, want X-Checksum", resp.Trailer)
+	}
+
+	// Trailer values are only known once the body has been read
+	if body, _ := io.ReadAll(resp.Body); string(body) != "body" {
+		t.Errorf("got body %q, want \"body\"", body)
+	}
+	for name, want := range map[string]string{"X-Checksum": "abc123", "X-Unannounced": "late"} {
+		if got := resp.Trailer.Get(name); got != want {
+			t.Errorf("got trailer %s %q, want %q", name, got, want)
+		}
+	}
+}
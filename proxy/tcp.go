@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"go-load-balancer/balancer"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTCPDialTimeout bounds connecting to a backend in TCP mode when none is configured
+const DefaultTCPDialTimeout = 10 * time.Second
+
+// ErrTCPProxyClosed is returned by Serve after Shutdown
+var ErrTCPProxyClosed = errors.New("tcp proxy closed")
+
+// TCPOptions holds optional TCP proxy settings
+type TCPOptions struct {
+	// DialTimeout bounds connecting to a backend (0 means DefaultTCPDialTimeout)
+	DialTimeout time.Duration
+}
+
+// TCPProxy forwards raw TCP connections to backends chosen by a load
+// balancer. Backends are addressed by the host and port of their URL; each
+// client connection counts as one connection on its backend for as long as
+// it is open.
+type TCPProxy struct {
+	loadBalancer  balancer.LoadBalancer
+	healthChecker balancer.HealthChecker
+	options       TCPOptions
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{} // client and backend connections, closed when Shutdown gives up
+	active    atomic.Int64          // client connections
+	done      chan struct{}
+	closing   atomic.Bool
+}
+
+// NewTCPProxy creates a TCP proxy balancing connections across lb's backends
+func NewTCPProxy(lb balancer.LoadBalancer, hc balancer.HealthChecker, options TCPOptions) *TCPProxy {
+	if options.DialTimeout <= 0 {
+		options.DialTimeout = DefaultTCPDialTimeout
+	}
+
+	return &TCPProxy{
+		loadBalancer:  lb,
+		healthChecker: hc,
+		options:       options,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[net.Conn]struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Serve accepts connections on listener and forwards each to a backend
+// until the listener fails or Shutdown is called
+func (tp *TCPProxy) Serve(listener net.Listener) error {
+	tp.mu.Lock()
+	if tp.closing.Load() {
+		tp.mu.Unlock()
+		listener.Close()
+		return ErrTCPProxyClosed
+	}
+	tp.listeners[listener] = struct{}{}
+	tp.mu.Unlock()
+
+	defer func() {
+		tp.mu.Lock()
+		delete(tp.listeners, listener)
+		tp.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if tp.closing.Load() {
+				return ErrTCPProxyClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("Error accepting connection: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !tp.track(conn) {
+			conn.Close()
+			continue
+		}
+		go tp.handle(conn)
+	}
+}
+
+// Active returns the number of client connections currently open
+func (tp *TCPProxy) Active() int64 {
+	return tp.active.Load()
+}
+
+// Shutdown stops accepting connections and waits for open ones to close.
+// If ctx expires first, the remaining connections are closed and ctx's
+// error is returned.
+func (tp *TCPProxy) Shutdown(ctx context.Context) error {
+	tp.mu.Lock()
+	tp.closing.Store(true)
+	for listener := range tp.listeners {
+		listener.Close()
+	}
+	idle := tp.active.Load() == 0
+	tp.mu.Unlock()
+
+	if idle {
+		return nil
+	}
+
+	select {
+	case <-tp.done:
+		return nil
+	case <-ctx.Done():
+		tp.mu.Lock()
+		for conn := range tp.conns {
+			conn.Close()
+		}
+		tp.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// track registers an accepted connection, refusing it once shutting down
+func (tp *TCPProxy) track(conn net.Conn) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if tp.closing.Load() {
+		return false
+	}
+	tp.conns[conn] = struct{}{}
+	tp.active.Add(1)
+	return true
+}
+
+// untrack forgets a closed connection, signalling Shutdown after the last one
+func (tp *TCPProxy) untrack(conn net.Conn) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	delete(tp.conns, conn)
+	if tp.active.Add(-1) == 0 && tp.closing.Load() {
+		close(tp.done)
+	}
+}
+
+// handle connects a client to a backend and relays bytes both ways. A
+// backend that cannot be reached counts as failed and the next one is tried.
+func (tp *TCPProxy) handle(clientConn net.Conn) {
+	defer tp.untrack(clientConn)
+	defer clientConn.Close()
+
+	// Balancers pick backends for requests; ip-hash uses the client address
+	request := (&http.Request{
+		Method:     "CONNECT",
+		Header:     make(http.Header),
+		RemoteAddr: clientConn.RemoteAddr().String(),
+	}).WithContext(context.Background())
+
+	var failed []*balancer.Backend
+	for {
+		backend := tp.loadBalancer.SelectBackend(balancer.WithExcludedBackends(request, failed))
+		if backend == nil {
+			log.Printf("No healthy backends available for connection from %s", request.RemoteAddr)
+			return
+		}
+
+		countConnection(tp.loadBalancer, backend)
+		backendConn, err := net.DialTimeout("tcp", balancer.DialAddr(backend.URL), tp.options.DialTimeout)
+		if err != nil {
+			log.Printf("Error connecting to backend %s: %v", backend.URL.String(), err)
+			uncountConnection(tp.loadBalancer, backend)
+			atomic.AddInt32(&backend.ErrorCount, 1)
+			tp.reportResult(backend, false)
+			failed = append(failed, backend)
+			continue
+		}
+
+		atomic.AddInt32(&backend.SuccessCount, 1)
+		tp.reportResult(backend, true)
+		tp.relay(clientConn, backendConn, backend)
+		uncountConnection(tp.loadBalancer, backend)
+		return
+	}
+}
+
+// reportResult feeds the outcome of a connection to the passive health
+// checks, if the proxy has a health checker
+func (tp *TCPProxy) reportResult(backend *balancer.Backend, success bool) {
+	if tp.healthChecker != nil {
+		tp.healthChecker.ReportResult(backend, success)
+	}
+}
+
+// relay copies bytes between a client and a backend until both directions
+// are done. When one side stops sending, the other is half-closed so it sees
+// the end of the stream but can still reply.
+func (tp *TCPProxy) relay(clientConn, backendConn net.Conn, backend *balancer.Backend) {
+	defer backendConn.Close()
+
+	// Shutdown closes client connections; that must end the backend side too
+	tp.mu.Lock()
+	tp.conns[backendConn] = struct{}{}
+	tp.mu.Unlock()
+	defer func() {
+		tp.mu.Lock()
+		delete(tp.conns, backendConn)
+		tp.mu.Unlock()
+	}()
+
+	start := time.Now()
+	log.Printf("Proxying connection from %s to backend %s", clientConn.RemoteAddr(), backend.URL.Host)
+
+	errc := make(chan error, 2)
+	copyHalf := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		if conn, ok := dst.(interface{ CloseWrite() error }); ok {
+			conn.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		errc <- err
+	}
+	go copyHalf(backendConn, clientConn)
+	go copyHalf(clientConn, backendConn)
+
+	err := <-errc
+	if second := <-errc; err == nil {
+		err = second
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Connection from %s to backend %s ended with error: %v", clientConn.RemoteAddr(), backend.URL.Host, err)
+		return
+	}
+
+	log.Printf("Connection from %s to backend %s closed after %s", clientConn.RemoteAddr(), backend.URL.Host, time.Since(start).Round(time.Millisecond))
+}
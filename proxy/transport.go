@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// newTransport builds the transport used for proxied requests
+func newTransport(options Options, stats *poolStats) http.RoundTripper {
+	if options.MaxConnAge > 0 {
+		return newRotatingTransport(options.MaxConnAge, func() *http.Transport {
+			return newHTTPTransport(options, stats)
+		})
+	}
+	return newHTTPTransport(options, stats)
+}
+
+// newHTTPTransport builds a connection-pooling transport from the proxy options
+func newHTTPTransport(options Options, stats *poolStats) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = stats.wrapDial(dialer.DialContext)
+	transport.Proxy = options.BackendProxy
+	transport.TLSClientConfig = options.BackendTLS.Clone()
+	transport.TLSHandshakeTimeout = options.TLSHandshakeTimeout
+	transport.IdleConnTimeout = options.IdleConnTimeout
+	transport.MaxIdleConns = options.MaxIdleConns
+	transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+
+	// HTTPS backends negotiate HTTP/2 through ALPN by default; when HTTP/2 is
+	// required, plain HTTP backends are spoken to in h2c with prior knowledge
+	if options.BackendHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	}
+	return transport
+}
+
+// rotatingTransport bounds backend connection lifetime by replacing its
+// underlying transport every maxAge. New requests always use the current
+// transport, so connections of a retired transport are only used to finish
+// requests already in flight and are closed once idle.
+type rotatingTransport struct {
+	maxAge       time.Duration
+	newTransport func() *http.Transport
+
+	mu      sync.Mutex
+	current *http.Transport
+	retired *http.Transport
+	created time.Time
+}
+
+func newRotatingTransport(maxAge time.Duration, newTransport func() *http.Transport) *rotatingTransport {
+	return &rotatingTransport{
+		maxAge:       maxAge,
+		newTransport: newTransport,
+		current:      newTransport(),
+		created:      time.Now(),
+	}
+}
+
+// RoundTrip sends the request on the current transport, rotating it first if it has expired
+func (rt *rotatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	if time.Since(rt.created) >= rt.maxAge {
+		// Connections that finished requests since the last rotation are idle by now
+		if rt.retired != nil {
+			rt.retired.CloseIdleConnections()
+		}
+		rt.retired = rt.current
+		rt.retired.CloseIdleConnections()
+
+		rt.current = rt.newTransport()
+		rt.created = time.Now()
+	}
+	transport := rt.current
+	rt.mu.Unlock()
+
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of the current and retired transports
+func (rt *rotatingTransport) CloseIdleConnections() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.current.CloseIdleConnections()
+	if rt.retired != nil {
+		rt.retired.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"fmt"
+	"go-load-balancer/balancer"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestBackendHTTP2(t *testing.T) {
+	// The backend accepts both HTTP/1.1 and h2c with prior knowledge
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+	backend := &balancer.Backend{URL: mustParseURL(t, server.URL), Alive: true, Ready: true, Weight: 1}
+
+	for _, tt := range []struct {
+		http2 bool
+		want  string
+	}{
+		{false, "HTTP/1.1"},
+		{true, "HTTP/2.0"},
+	} {
+		rp := newTestProxy(Options{BackendHTTP2: tt.http2}, backend)
+		if got := serve(rp, httptest.NewRequest("GET", "/", nil)).Body.String(); got != tt.want {
+			t.Errorf("with BackendHTTP2 %v the backend got %q, want %q", tt.http2, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkProxyIdleConns measures concurrent requests through the proxy to a
+// local backend with Go's default of 2 idle connections per host and with 32.
+// Too small an idle pool makes the proxy dial and tear down connections under
+// load instead of reusing them, which shows in dials/op and allocs/op:
+//
+//	go test ./proxy -run '^$' -bench ProxyIdleConns -cpu 4
+func BenchmarkProxyIdleConns(b *testing.B) {
+	// The proxy logs every request
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, idlePerHost := range []int{http.DefaultMaxIdleConnsPerHost, 32} {
+		b.Run(fmt.Sprintf("idle-per-host=%d", idlePerHost), func(b *testing.B) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+			}))
+			defer backend.Close()
+
+			rp := NewReverseProxy(newPool(&balancer.Backend{URL: mustParseURL(b, backend.URL), Alive: true, Ready: true, Weight: 1}), nil, Options{
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: idlePerHost,
+			})
+
+			b.ReportAllocs()
+			b.SetParallelism(16)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					rp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+				}
+			})
+
+			b.StopTimer()
+			var dials int64
+			for _, pool := range rp.poolStats.Snapshot() {
+				dials += pool.Dials
+			}
+			b.ReportMetric(float64(dials)/float64(b.N), "dials/op")
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// dialTunnel opens a tunnel to address through the backend proxy on conn,
+// with CONNECT for http and https proxies or the SOCKS5 CONNECT command
+func (rp *ReverseProxy) dialTunnel(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "http":
+		return connectTunnel(conn, proxyURL, address)
+	case "https":
+		tlsConfig := rp.options.BackendTLS.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.ServerName = proxyURL.Hostname()
+		return connectTunnel(tls.Client(conn, tlsConfig), proxyURL, address)
+	case "socks5":
+		return socksTunnel(conn, proxyURL, address)
+	}
+	return nil, fmt.Errorf("unsupported backend proxy scheme %q", proxyURL.Scheme)
+}
+
+// connectTunnel asks an HTTP proxy to open a tunnel with a CONNECT request
+func connectTunnel(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connectReq.Write(conn); err != nil {
+		return nil, err
+	}
+
+	// The proxy sends nothing past its response until the tunnel is used
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend proxy %s refused a tunnel to %s: %s", proxyURL.Host, address, resp.Status)
+	}
+	return conn, nil
+}
+
+// SOCKS5 protocol values used by socksTunnel (RFC 1928, RFC 1929)
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0
+	socksPasswordAuth    = 2
+	socksConnect         = 1
+	socksDomainAddress   = 3
+	socksIPv4Address     = 1
+	socksIPv6Address     = 4
+	socksSucceeded       = 0
+	socksPasswordVersion = 1
+)
+
+// socksTunnel asks a SOCKS5 proxy to connect to address, authenticating
+// with the proxy URL's user and password if it has them
+func socksTunnel(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %s", address)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host name %s is too long for SOCKS5", host)
+	}
+
+	method := byte(socksNoAuth)
+	if proxyURL.User != nil {
+		method = socksPasswordAuth
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != socksVersion || reply[1] != method {
+		return nil, fmt.Errorf("backend proxy %s does not accept SOCKS5 authentication method %d", proxyURL.Host, method)
+	}
+
+	if method == socksPasswordAuth {
+		username := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return nil, errors.New("SOCKS5 username and password must be at most 255 bytes")
+		}
+		auth := []byte{socksPasswordVersion, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply[1] != socksSucceeded {
+			return nil, fmt.Errorf("backend proxy %s rejected the SOCKS5 credentials", proxyURL.Host)
+		}
+	}
+
+	request := []byte{socksVersion, socksConnect, 0, socksDomainAddress, byte(len(host))}
+	request = append(request, host...)
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	// The reply ends with the address the proxy bound, which is not needed
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[1] != socksSucceeded {
+		return nil, fmt.Errorf("backend proxy %s failed to connect to %s: SOCKS5 reply %d", proxyURL.Host, address, header[1])
+	}
+	var boundLength int
+	switch header[3] {
+	case socksIPv4Address:
+		boundLength = net.IPv4len
+	case socksIPv6Address:
+		boundLength = net.IPv6len
+	case socksDomainAddress:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		boundLength = int(length[0])
+	default:
+		return nil, fmt.Errorf("backend proxy %s sent an unknown SOCKS5 address type %d", proxyURL.Host, header[3])
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(boundLength)+2); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
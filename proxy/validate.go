@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ResponseRules are checks a backend response must pass to be forwarded.
+// Responses that fail them are treated as backend errors.
+type ResponseRules struct {
+	// RequiredHeaders must all be present on every response
+	RequiredHeaders []string
+
+	// ContentTypes lists the allowed media types, such as "application/json"
+	// or "text/*". Responses without a body are not checked. Empty allows any.
+	ContentTypes []string
+}
+
+// validate returns an error describing the first rule the response breaks
+func (rr ResponseRules) validate(resp *http.Response) error {
+	for _, name := range rr.RequiredHeaders {
+		if resp.Header.Get(name) == "" {
+			return fmt.Errorf("invalid response: missing header %s", name)
+		}
+	}
+
+	if len(rr.ContentTypes) == 0 || !hasBody(resp) {
+		return nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid response: bad Content-Type %q", contentType)
+	}
+	for _, allowed := range rr.ContentTypes {
+		if matchMediaType(allowed, mediaType) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid response: Content-Type %s not allowed", mediaType)
+}
+
+// hasBody reports whether a response is allowed to carry a body
+func hasBody(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode < 200, resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusNotModified:
+		return false
+	case resp.Request != nil && resp.Request.Method == http.MethodHead:
+		return false
+	}
+	return true
+}
+
+// matchMediaType matches a media type against an allowed type, where a
+// subtype of "*" allows every subtype
+func matchMediaType(allowed, mediaType string) bool {
+	allowed = strings.ToLower(allowed)
+	if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return allowed == mediaType
+}
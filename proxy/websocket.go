@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"go-load-balancer/balancer"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upgradeDialTimeout bounds connecting to a backend for an upgraded connection
+const upgradeDialTimeout = 30 * time.Second
+
+// isUpgradeRequest reports whether a request asks to switch protocols, as
+// WebSocket handshakes do with Connection: Upgrade and Upgrade: websocket
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveUpgrade proxies a protocol upgrade such as a WebSocket handshake. The
+// handshake is sent to the backend on a dedicated connection; if the backend
+// switches protocols, the client connection is hijacked and bytes are copied
+// both ways until either side closes or, with WebSocketIdleTimeout, no bytes
+// pass for that long. The backend counts the connection for the whole
+// lifetime of the socket.
+func (rp *ReverseProxy) serveUpgrade(w http.ResponseWriter, r *http.Request, route route, backend *balancer.Backend, start time.Time) {
+	rp.acquireConnection(route.balancer, backend)
+	defer rp.releaseConnection(route.balancer, backend)
+
+	backendTag := "backend:" + backend.URL.Host
+	logRequest(r, "Proxying upgrade request %s %s to backend %s", r.Method, r.URL.Path, backend.URL.String())
+
+	upgradeReq := r.Clone(r.Context())
+	upgradeReq.URL = backendURL(route, backend, r)
+	upgradeReq.Host = ""
+	if rp.options.PreserveHost {
+		upgradeReq.Host = r.Host
+	}
+	upgradeReq.RequestURI = ""
+	upgradeReq.Body = nil
+	upgradeReq.ContentLength = 0
+	setForwardedHeaders(upgradeReq.Header, r)
+	rp.options.RequestHeaders.apply(upgradeReq.Header)
+
+	// The proxy timeout bounds the handshake; the socket itself may stay open
+	// indefinitely once the backend switches protocols
+	var deadline time.Time
+	if rp.options.ProxyTimeout > 0 {
+		deadline = time.Now().Add(rp.options.ProxyTimeout)
+	}
+
+	backendConn, err := rp.dialBackend(upgradeReq, deadline)
+	if err != nil {
+		rp.reportResult(backend, false)
+		rp.writeResponse(w, r, backend, nil, err, start)
+		return
+	}
+	defer backendConn.Close()
+
+	if err := upgradeReq.Write(backendConn); err != nil {
+		rp.reportResult(backend, false)
+		rp.writeResponse(w, r, backend, nil, err, start)
+		return
+	}
+
+	backendReader := bufio.NewReader(backendConn)
+	resp, err := http.ReadResponse(backendReader, upgradeReq)
+	if err != nil {
+		rp.reportResult(backend, false)
+		rp.writeResponse(w, r, backend, nil, err, start)
+		return
+	}
+	rp.reportResult(backend, resp.StatusCode < 500)
+
+	// The backend declined the upgrade; relay its answer as a normal response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		rp.writeResponse(w, r, backend, resp, nil, start)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		rp.writeResponse(w, r, backend, nil, fmt.Errorf("connection does not support upgrades"), start)
+		return
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		rp.writeResponse(w, r, backend, nil, err, start)
+		return
+	}
+	defer clientConn.Close()
+
+	// Deadlines set for the handshake must not cut the socket short
+	clientConn.SetDeadline(time.Time{})
+	backendConn.SetDeadline(time.Time{})
+
+	rp.setStickyCookie(resp.Header, r, backend)
+	rp.setRequestID(resp.Header, r)
+	rp.setServedBy(resp.Header, backend)
+	rp.options.ResponseHeaders.apply(resp.Header)
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		logRequest(r, "Error writing upgrade response: %v", err)
+		atomic.AddInt32(&backend.ErrorCount, 1)
+		rp.options.StatsD.Count("requests.errors", 1, backendTag)
+		return
+	}
+
+	atomic.AddInt32(&backend.SuccessCount, 1)
+	rp.options.StatsD.Count("requests", 1, backendTag, "status:101")
+
+	// Traffic either way keeps the socket from going idle
+	idle := &idleDeadline{timeout: rp.options.WebSocketIdleTimeout, conns: []net.Conn{clientConn, backendConn}}
+	idle.extend()
+
+	// Pings go to the client between the backend's frames, never inside one
+	var clientMu sync.Mutex
+	pinging := rp.options.WebSocketPingInterval > 0 && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	stopPings := make(chan struct{})
+	if pinging {
+		go sendPings(clientConn, &clientMu, rp.options.WebSocketPingInterval, stopPings)
+	}
+
+	// Either side closing ends the socket; closing both unblocks the other copy
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(backendConn, idleReader{clientBuf, idle})
+		errc <- err
+	}()
+	go func() {
+		if pinging {
+			errc <- copyFrames(clientConn, idleReader{backendReader, idle}, &clientMu)
+			return
+		}
+		_, err := io.Copy(clientConn, idleReader{backendReader, idle})
+		errc <- err
+	}()
+	<-errc
+	close(stopPings)
+	clientConn.Close()
+	backendConn.Close()
+	<-errc
+
+	logRequest(r, "Upgraded connection to backend %s closed after %s", backend.URL.String(), time.Since(start).Round(time.Millisecond))
+}
+
+// idleDeadline ends upgraded connections that see no traffic for a while by
+// pushing back the read deadline of both connections whenever either reads
+type idleDeadline struct {
+	timeout time.Duration
+	conns   []net.Conn
+}
+
+// extend moves the read deadlines a full timeout from now
+func (d *idleDeadline) extend() {
+	if d.timeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(d.timeout)
+	for _, conn := range d.conns {
+		conn.SetReadDeadline(deadline)
+	}
+}
+
+// idleReader extends an idle deadline each time a read returns data
+type idleReader struct {
+	io.Reader
+	idle *idleDeadline
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.idle.extend()
+	}
+	return n, err
+}
+
+// pingFrame is an unmasked WebSocket ping without payload, as sent by servers
+var pingFrame = []byte{0x89, 0x00}
+
+// sendPings writes a ping frame to conn every interval until stop is closed
+// or a write fails. mu serializes the writes with whole relayed frames.
+func sendPings(conn net.Conn, mu *sync.Mutex, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			mu.Lock()
+			_, err := conn.Write(pingFrame)
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// copyFrames relays WebSocket frames from src to dst, writing each frame
+// while holding mu so that pings are only ever sent between frames
+func copyFrames(dst io.Writer, src io.Reader, mu *sync.Mutex) error {
+	// At most 2 fixed bytes, 8 bytes of extended length and a 4-byte mask
+	header := make([]byte, 14)
+	for {
+		if _, err := io.ReadFull(src, header[:2]); err != nil {
+			return err
+		}
+
+		size := 2
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			size += 2
+		case 127:
+			size += 8
+		}
+		if header[1]&0x80 != 0 {
+			size += 4
+		}
+		if _, err := io.ReadFull(src, header[2:size]); err != nil {
+			return err
+		}
+		switch length {
+		case 126:
+			length = uint64(binary.BigEndian.Uint16(header[2:4]))
+		case 127:
+			length = binary.BigEndian.Uint64(header[2:10])
+		}
+
+		mu.Lock()
+		_, err := dst.Write(header[:size])
+		if err == nil {
+			_, err = io.CopyN(dst, src, int64(length))
+		}
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dialBackend opens a connection to the backend of an upgrade request,
+// tunnelling through the backend proxy if BackendProxy picks one and using
+// TLS for https backends. A non-zero deadline bounds dialing and the tunnel
+// and TLS handshakes, and stays set on the returned connection.
+func (rp *ReverseProxy) dialBackend(req *http.Request, deadline time.Time) (conn net.Conn, err error) {
+	var proxyURL *url.URL
+	if rp.options.BackendProxy != nil {
+		if proxyURL, err = rp.options.BackendProxy(req); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   upgradeDialTimeout,
+		Deadline:  deadline,
+		KeepAlive: 30 * time.Second,
+	}
+	address := balancer.DialAddr(req.URL)
+	if proxyURL != nil {
+		conn, err = dialer.DialContext(req.Context(), "tcp", balancer.DialAddr(proxyURL))
+	} else {
+		conn, err = dialer.DialContext(req.Context(), "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	if proxyURL != nil {
+		tunnel, err := rp.dialTunnel(conn, proxyURL, address)
+		if err != nil {
+			return nil, err
+		}
+		conn = tunnel
+	}
+
+	if req.URL.Scheme == "https" {
+		tlsConfig := rp.options.BackendTLS.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.ServerName = req.URL.Hostname()
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.HandshakeContext(req.Context()); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
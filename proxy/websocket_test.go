@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bufio"
+	"go-load-balancer/balancer"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEchoUpgradeBackend returns a backend that switches protocols on every
+// request and then echoes whatever the client sends
+func newEchoUpgradeBackend(t *testing.T) *balancer.Backend {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		buf.Flush()
+		io.Copy(conn, buf)
+	})
+}
+
+// upgrade sends an upgrade request to the server at address and returns the
+// connection with its reader and the response status
+func upgrade(t *testing.T, address string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	request, _ := http.NewRequest("GET", "http://"+address+"/socket", nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	if err := request.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, resp.StatusCode
+}
+
+func TestUpgradeThroughBackendProxy(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+
+	// A forward proxy that only tunnels, counting CONNECT requests
+	var tunnels atomic.Int32
+	forwardProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		tunnels.Add(1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		buf.Flush()
+		go io.Copy(upstream, buf)
+		io.Copy(conn, upstream)
+	}))
+	defer forwardProxy.Close()
+
+	rp := newTestProxy(Options{BackendProxy: http.ProxyURL(mustParseURL(t, forwardProxy.URL))}, backend)
+	front := httptest.NewServer(rp)
+	defer front.Close()
+
+	conn, reader, status := upgrade(t, front.Listener.Addr().String())
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", status)
+	}
+	conn.Write([]byte("hello"))
+	echoed := make([]byte, 5)
+	if _, err := io.ReadFull(reader, echoed); err != nil || string(echoed) != "hello" {
+		t.Fatalf("got echo %q, %v", echoed, err)
+	}
+	if tunnels.Load() != 1 {
+		t.Errorf("got %d tunnels through the backend proxy, want 1", tunnels.Load())
+	}
+}
+
+func TestUpgradeHandshakeTimesOut(t *testing.T) {
+	// A backend that accepts connections but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	backend := &balancer.Backend{URL: mustParseURL(t, "http://"+listener.Addr().String()), Alive: true, Ready: true, Weight: 1}
+	rp := newTestProxy(Options{ProxyTimeout: 100 * time.Millisecond}, backend)
+	front := httptest.NewServer(rp)
+	defer front.Close()
+
+	start := time.Now()
+	_, _, status := upgrade(t, front.Listener.Addr().String())
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("got status %d, want 504", status)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("handshake took %v, want it cut off after the proxy timeout", elapsed)
+	}
+}
+
+func TestUpgradeIdleTimeout(t *testing.T) {
+	rp := newTestProxy(Options{WebSocketIdleTimeout: 200 * time.Millisecond}, newEchoUpgradeBackend(t))
+	front := httptest.NewServer(rp)
+	defer front.Close()
+
+	conn, reader, status := upgrade(t, front.Listener.Addr().String())
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", status)
+	}
+
+	// Traffic within the timeout keeps the socket open
+	echoed := make([]byte, 2)
+	for range 3 {
+		time.Sleep(100 * time.Millisecond)
+		conn.Write([]byte("hi"))
+		if _, err := io.ReadFull(reader, echoed); err != nil {
+			t.Fatalf("socket closed while in use: %v", err)
+		}
+	}
+
+	// A quiet socket is closed
+	start := time.Now()
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Fatalf("got %v reading from an idle socket, want EOF", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("idle socket closed after %v, want about 200ms", elapsed)
+	}
+}
+
+func TestUpgradeSendsPingsBetweenFrames(t *testing.T) {
+	rp := newTestProxy(Options{WebSocketPingInterval: 10 * time.Millisecond}, newEchoUpgradeBackend(t))
+	front := httptest.NewServer(rp)
+	defer front.Close()
+
+	conn, reader, status := upgrade(t, front.Listener.Addr().String())
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", status)
+	}
+
+	// A masked text frame whose payload is "hello", echoed back as is
+	frame := []byte{0x81, 0x85, 1, 2, 3, 4}
+	for i, b := range []byte("hello") {
+		frame = append(frame, b^byte(i%4+1))
+	}
+
+	pings := 0
+	for range 20 {
+		conn.Write(frame)
+		header := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(reader, header); err != nil {
+				t.Fatal(err)
+			}
+			if header[0] != 0x89 {
+				break
+			}
+			if header[1] != 0 {
+				t.Fatalf("got ping with payload length %d, want 0", header[1])
+			}
+			pings++
+		}
+
+		rest := make([]byte, len(frame)-2)
+		if _, err := io.ReadFull(reader, rest); err != nil {
+			t.Fatal(err)
+		}
+		if got := append(header, rest...); string(got) != string(frame) {
+			t.Fatalf("got frame %x, want %x", got, frame)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pings == 0 {
+		t.Error("got no pings")
+	}
+}
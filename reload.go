@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-load-balancer/balancer"
+	"log"
+	"sort"
+	"strings"
+)
+
+// reloadBackends re-reads the backends and pools from the config file and
+// applies the differences to the running balancers. Every backend is parsed
+// and validated before anything changes, so a bad file leaves the current
+// backends in place. Unchanged backends keep their health state and open
+// connections; settings such as weights are updated in place, new backends
+// enter rotation once they pass a health check and removed ones finish their
+// in-flight requests. Backends and pools set on the command line take
+// precedence over the file, as at startup.
+func reloadBackends(config *Config, loadBalancer balancer.LoadBalancer, pools map[string]balancer.LoadBalancer, healthChecker balancer.HealthChecker) error {
+	if config.ConfigFile == "" {
+		return errors.New("no -config file to reload")
+	}
+
+	skip := setOnCommandLine()
+	settings, err := readConfigFile(config.ConfigFile, skip)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.name] = setting.value
+	}
+
+	// Work out the new backends of every balancer before changing any of them
+	wanted := make(map[balancer.LoadBalancer][]*balancer.Backend)
+	if !skip["backends"] && config.BackendsDNS == "" {
+		backends, err := parseReloadedBackends(splitBackends(values["backends"]), config.Mode)
+		if err != nil {
+			return err
+		}
+		if len(backends) == 0 && !config.AllowEmptyBackends {
+			return errors.New("no backends specified (use -allow-empty-backends to allow this)")
+		}
+		wanted[loadBalancer] = backends
+	}
+	if !skip["pools"] && len(pools) > 0 {
+		poolSpecs, err := parsePools(values["pools"])
+		if err != nil {
+			return err
+		}
+		if !samePoolNames(poolSpecs, pools) {
+			return errors.New("pools can't be added or removed by a reload, restart to change them")
+		}
+		for name, specs := range poolSpecs {
+			backends, err := parseReloadedBackends(specs, "http")
+			if err != nil {
+				return fmt.Errorf("pool %s: %v", name, err)
+			}
+			wanted[pools[name]] = backends
+		}
+	}
+
+	if len(wanted) == 0 {
+		log.Printf("No backends or pools to reload from %s", config.ConfigFile)
+		return nil
+	}
+
+	var added, removed, updated int
+	for lb, backends := range wanted {
+		a, r, u := applyBackends(lb, backends, healthChecker)
+		added, removed, updated = added+a, removed+r, updated+u
+	}
+	log.Printf("Reloaded backends from %s: %d added, %d removed, %d updated", config.ConfigFile, added, removed, updated)
+	return nil
+}
+
+// splitBackends splits a comma-separated backend list, as given to -backends
+func splitBackends(list string) []string {
+	var specs []string
+	for _, spec := range strings.Split(list, ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// parseReloadedBackends parses and validates the backends of one balancer
+func parseReloadedBackends(specs []string, mode string) ([]*balancer.Backend, error) {
+	seen := make(map[string]bool)
+	backends := make([]*balancer.Backend, 0, len(specs))
+	for _, spec := range specs {
+		backend, err := parseBackendSpec(spec)
+		if err == nil {
+			err = validateBackendScheme(backend.URL, mode)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend %s: %v", spec, err)
+		}
+
+		backend.ID = backend.URL.String()
+		if seen[backend.ID] {
+			return nil, fmt.Errorf("duplicate backend %s", backend.ID)
+		}
+		seen[backend.ID] = true
+		backends = append(backends, backend)
+	}
+	return backends, nil
+}
+
+// samePoolNames reports whether the reloaded pools are the running ones
+func samePoolNames(poolSpecs map[string][]string, pools map[string]balancer.LoadBalancer) bool {
+	if len(poolSpecs) != len(pools) {
+		return false
+	}
+	for name := range poolSpecs {
+		if _, ok := pools[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// applyBackends makes a balancer's configured backends match the wanted
+// ones, returning how many were added, removed and updated. Dynamic backends,
+// added through the admin API, are kept unless removed the same way.
+func applyBackends(lb balancer.LoadBalancer, wanted []*balancer.Backend, healthChecker balancer.HealthChecker) (added, removed, updated int) {
+	current := make(map[string]*balancer.Backend)
+	for _, backend := range lb.GetBackends() {
+		current[backend.Key()] = backend
+	}
+
+	for _, backend := range wanted {
+		existing, ok := current[backend.ID]
+		if !ok {
+			// Like backends added via the admin API, new ones start out of rotation until checked
+			lb.AddBackend(backend)
+			alive := healthChecker.CheckHealth(backend)
+			lb.UpdateBackendStatus(backend, alive)
+			log.Printf("Added backend: %s (alive: %t)", backend.URL.String(), alive)
+			added++
+			continue
+		}
+
+		delete(current, backend.ID)
+		if settings := backend.Settings(); !existing.Settings().Equal(settings) {
+			lb.UpdateBackendSettings(existing, settings)
+			log.Printf("Updated backend: %s (weight: %d)", existing.URL.String(), settings.Weight)
+			updated++
+		}
+	}
+
+	keys := make([]string, 0, len(current))
+	for key, backend := range current {
+		if !backend.Dynamic {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lb.RemoveBackend(current[key])
+		log.Printf("Removed backend: %s", current[key].URL.String())
+		removed++
+	}
+	return added, removed, updated
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"go-load-balancer/balancer"
+	"net/url"
+	"testing"
+)
+
+func TestApplyBackendsKeepsDynamicBackends(t *testing.T) {
+	lb := balancer.NewRoundRobinBalancer()
+	for _, backend := range []struct {
+		url     string
+		dynamic bool
+	}{
+		{"http://10.0.0.1:8080", false},
+		{"http://10.0.0.2:8080", false},
+		{"http://10.0.0.3:8080", true},
+	} {
+		backendURL, _ := url.Parse(backend.url)
+		lb.AddBackend(&balancer.Backend{ID: backend.url, URL: backendURL, Alive: true, Ready: true, Weight: 1, Dynamic: backend.dynamic})
+	}
+
+	// The reloaded file only lists the first backend
+	wanted, err := parseReloadedBackends([]string{"http://10.0.0.1:8080"}, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, _ := applyBackends(lb, wanted, nil)
+	if added != 0 || removed != 1 {
+		t.Errorf("got %d added and %d removed, want 0 and 1", added, removed)
+	}
+
+	if lb.GetBackend("http://10.0.0.2:8080") != nil {
+		t.Error("configured backend missing from the file was kept")
+	}
+	if lb.GetBackend("http://10.0.0.3:8080") == nil {
+		t.Error("backend added through the admin API was removed")
+	}
+}
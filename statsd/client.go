@@ -0,0 +1,140 @@
+// Package statsd implements a minimal StatsD client with DogStatsD-style tags.
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPacketSize keeps packets below a typical Ethernet MTU after IP/UDP headers
+const maxPacketSize = 1432
+
+// flushInterval bounds how long buffered metrics wait before being sent
+const flushInterval = time.Second
+
+// Client buffers metrics and sends them to a StatsD server over UDP.
+// All methods are safe to call on a nil *Client, which discards metrics.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+
+	mu     sync.Mutex
+	buffer bytes.Buffer
+	done   chan struct{}
+}
+
+// New creates a client sending to addr (host:port). Prefix is prepended to
+// every metric name and tags (key:value) are attached to every metric.
+func New(addr, prefix string, tags []string) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:   conn,
+		prefix: prefix,
+		tags:   tags,
+		done:   make(chan struct{}),
+	}
+	go c.flushLoop()
+	return c, nil
+}
+
+// Count adds delta to a counter
+func (c *Client) Count(name string, delta int64, tags ...string) {
+	c.send(name, strconv.FormatInt(delta, 10), "c", tags)
+}
+
+// Gauge sets a gauge to value
+func (c *Client) Gauge(name string, value float64, tags ...string) {
+	c.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Timing records a duration in milliseconds
+func (c *Client) Timing(name string, d time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms", tags)
+}
+
+// Close flushes buffered metrics and closes the connection
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	close(c.done)
+	c.Flush()
+	return c.conn.Close()
+}
+
+// Flush sends any buffered metrics
+func (c *Client) Flush() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+func (c *Client) send(name, value, kind string, tags []string) {
+	if c == nil {
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(c.prefix)
+	line.WriteString(name)
+	line.WriteByte(':')
+	line.WriteString(value)
+	line.WriteByte('|')
+	line.WriteString(kind)
+
+	if len(c.tags) > 0 || len(tags) > 0 {
+		line.WriteString("|#")
+		line.WriteString(strings.Join(append(c.tags[:len(c.tags):len(c.tags)], tags...), ","))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.buffer.Len() > 0 && c.buffer.Len()+1+line.Len() > maxPacketSize {
+		c.flushLocked()
+	}
+	if c.buffer.Len() > 0 {
+		c.buffer.WriteByte('\n')
+	}
+	c.buffer.WriteString(line.String())
+}
+
+func (c *Client) flushLocked() {
+	if c.buffer.Len() == 0 {
+		return
+	}
+
+	if _, err := c.conn.Write(c.buffer.Bytes()); err != nil {
+		log.Printf("StatsD write failed: %v", err)
+	}
+	c.buffer.Reset()
+}
+
+func (c *Client) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.Flush()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+	"strings"
+)
+
+// syslogFacilities maps facility names accepted by -syslog-facility to syslog priorities
+var syslogFacilities = map[string]syslog.Priority{
+	"daemon": syslog.LOG_DAEMON,
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// setupSyslog redirects the standard logger to a local or remote syslog server
+func setupSyslog(addr, facility string) error {
+	priority, ok := syslogFacilities[facility]
+	if !ok {
+		return fmt.Errorf("invalid syslog facility: %s", facility)
+	}
+
+	// An empty network and address connects to the local syslog daemon
+	network := ""
+	if addr != "" {
+		network = "udp"
+		if scheme, rest, found := strings.Cut(addr, "://"); found {
+			network, addr = scheme, rest
+		}
+	}
+
+	// The standard logger has no levels, so everything is sent as informational
+	writer, err := syslog.Dial(network, addr, priority|syslog.LOG_INFO, "go-load-balancer")
+	if err != nil {
+		return err
+	}
+
+	// Syslog stamps its own timestamps
+	log.SetFlags(0)
+	log.SetOutput(writer)
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// syslogFacilities lists the facility names accepted by -syslog-facility
+var syslogFacilities = map[string]struct{}{
+	"daemon": {}, "user": {},
+	"local0": {}, "local1": {}, "local2": {}, "local3": {},
+	"local4": {}, "local5": {}, "local6": {}, "local7": {},
+}
+
+// setupSyslog always fails because log/syslog is unavailable on this platform
+func setupSyslog(addr, facility string) error {
+	return errors.New("syslog is not supported on this platform")
+}